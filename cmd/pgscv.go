@@ -21,8 +21,10 @@ func main() {
 		showVersion = kingpin.Flag("version", "show version and exit").Default().Bool()
 		logLevel    = kingpin.Flag("log-level", "set log level: debug, info, warn, error").Default("info").Envar("LOG_LEVEL").String()
 		configFile  = kingpin.Flag("config-file", "path to config file").Default("").Envar("PGSCV_CONFIG_FILE").String()
+		watchConfig = kingpin.Flag("watch-config", "reload configuration when config file is changed").Default("false").Envar("PGSCV_WATCH_CONFIG").Bool()
 		doBootstrap = kingpin.Flag("bootstrap", "run bootstrap, requires root privileges").Default("false").Envar("PGSCV_BOOTSTRAP").Bool()
 		doUninstall = kingpin.Flag("uninstall", "run uninstall, requires root privileges").Default("false").Envar("PGSCV_UNINSTALL").Bool()
+		checkConfig = kingpin.Flag("check-config", "check config, run discovery and every collector once, print report and exit").Default("false").Bool()
 	)
 	kingpin.Parse()
 	log.SetLevel(*logLevel)
@@ -60,29 +62,47 @@ func main() {
 		os.Exit(1)
 	}
 
+	config.ConfigFile = *configFile
+	config.WatchConfig = *watchConfig
+
 	if err := config.Validate(); err != nil {
 		log.Errorln("validate config failed: ", err)
 		os.Exit(1)
 	}
 
+	if *checkConfig {
+		os.Exit(pgscv.RunCheck(context.Background(), config, os.Stdout))
+	}
+
 	config.BinaryPath = os.Args[0]
 	config.BinaryVersion = gitTag
 
 	ctx := context.Background()
 	ctx, cancel := context.WithCancel(ctx)
 
-	var doExit = make(chan error, 2)
+	var doExit = make(chan error, 1)
 	go func() {
 		doExit <- listenSignals()
-		cancel()
 	}()
 
+	var startErr = make(chan error, 1)
 	go func() {
-		doExit <- pgscv.Start(ctx, config)
-		cancel()
+		startErr <- pgscv.Start(ctx, config)
 	}()
 
-	log.Warnf("shutdown: %s", <-doExit)
+	select {
+	case err := <-doExit:
+		log.Warnf("shutdown: %s", err)
+
+		// Application drains in-flight work after context cancelling, wait for it.
+		cancel()
+		if err := <-startErr; err != nil {
+			log.Errorln("stop application failed: ", err)
+		}
+	case err := <-startErr:
+		cancel()
+		log.Warnf("shutdown: %s", err)
+	}
 }
 
 func listenSignals() error {
@@ -4,17 +4,22 @@ go 1.16
 
 require (
 	github.com/StackExchange/wmi v0.0.0-20190523213315-cbe66965904d // indirect
+	github.com/fsnotify/fsnotify v1.4.7
 	github.com/go-ole/go-ole v1.2.4 // indirect
+	github.com/golang/snappy v0.0.1
 	github.com/jackc/pgproto3/v2 v2.0.2
 	github.com/jackc/pgx/v4 v4.8.0
 	github.com/nxadm/tail v1.4.4
 	github.com/prometheus/client_golang v1.7.1
+	github.com/prometheus/client_model v0.2.0
+	github.com/prometheus/common v0.10.0
 	github.com/rs/zerolog v1.15.0
 	github.com/shirou/gopsutil v2.20.6+incompatible
 	github.com/stretchr/testify v1.5.1
-	golang.org/x/crypto v0.0.0-20200709230013-948cd5f35899 // indirect
+	golang.org/x/crypto v0.0.0-20200709230013-948cd5f35899
 	golang.org/x/net v0.0.0-20190813141303-74dc4d7220e7
 	golang.org/x/sys v0.0.0-20200615200032-f1bc736245b1
+	google.golang.org/protobuf v1.23.0
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
 	gopkg.in/yaml.v2 v2.2.5
 )
@@ -0,0 +1,237 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/weaponry/pgscv/internal/log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	// OverflowActionDrop defines series over the limits are dropped.
+	OverflowActionDrop = "drop"
+	// OverflowActionAggregate defines values of gauges over the limits are summed into single series per metric,
+	// which labels values are replaced with overflowLabelValue. Other series over the limits are dropped.
+	OverflowActionAggregate = "aggregate"
+
+	// overflowLabelValue is the value of labels of the series aggregated from series over the limits.
+	overflowLabelValue = "other"
+)
+
+// CardinalityLimits defines limits of number of series produced by service's collectors during single scrape.
+type CardinalityLimits struct {
+	// MaxSeriesPerMetric defines maximum number of series with the same metric name. Zero means no limit.
+	MaxSeriesPerMetric int `yaml:"max_series_per_metric"`
+	// MaxSeriesPerService defines maximum number of series of all metrics of the service. Zero means no limit.
+	MaxSeriesPerService int `yaml:"max_series_per_service"`
+	// OverflowAction defines what to do with series over the limits: 'drop' or 'aggregate'.
+	OverflowAction string `yaml:"overflow_action"`
+}
+
+// Validate checks limits have valid values and sets defaults.
+func (l *CardinalityLimits) Validate() error {
+	if l.MaxSeriesPerMetric < 0 || l.MaxSeriesPerService < 0 {
+		return fmt.Errorf("cardinality limits should not be negative")
+	}
+
+	if l.OverflowAction == "" {
+		l.OverflowAction = OverflowActionDrop
+	}
+
+	if l.OverflowAction != OverflowActionDrop && l.OverflowAction != OverflowActionAggregate {
+		return fmt.Errorf("unknown overflow_action '%s', supported: %s, %s", l.OverflowAction, OverflowActionDrop, OverflowActionAggregate)
+	}
+
+	return nil
+}
+
+// enabled returns true if any limit is set.
+func (l CardinalityLimits) enabled() bool {
+	return l.MaxSeriesPerMetric > 0 || l.MaxSeriesPerService > 0
+}
+
+// cardinalityGuard keeps state of series limiting which lives between scrapes: counters of dropped series and
+// metrics which exceeded limits have been already reported.
+type cardinalityGuard struct {
+	limits      CardinalityLimits
+	constLabels prometheus.Labels // labels which identify the service, they are kept in aggregated series
+	mu          sync.Mutex
+	dropped     map[string]float64 // number of dropped series per metric name
+	warned      map[string]bool    // metrics names which exceeding of limits has been logged
+}
+
+// newCardinalityGuard creates guard for passed limits. Returns nil if limits are not set.
+func newCardinalityGuard(limits CardinalityLimits, labels prometheus.Labels) *cardinalityGuard {
+	if !limits.enabled() {
+		return nil
+	}
+
+	return &cardinalityGuard{
+		limits:      limits,
+		constLabels: labels,
+		dropped:     map[string]float64{},
+		warned:      map[string]bool{},
+	}
+}
+
+// limit applies limits to metric families gathered during single scrape. Series over the limits are counted as
+// dropped and, depending on overflow action, aggregated. Self-instrumentation metrics are never limited. Nil guard
+// passes all series.
+//
+// Series are kept deterministically, so the same series are kept at every scrape while set of series is not changed:
+// families are processed in order of names and series of each family in order of labels.
+func (g *cardinalityGuard) limit(families []*dto.MetricFamily) []*dto.MetricFamily {
+	if g == nil {
+		return families
+	}
+
+	sort.Slice(families, func(i, j int) bool { return families[i].GetName() < families[j].GetName() })
+
+	var total int
+	result := make([]*dto.MetricFamily, 0, len(families)+1)
+	for _, mf := range families {
+		if strings.HasPrefix(mf.GetName(), "pgscv_") {
+			result = append(result, mf)
+			continue
+		}
+
+		// Relabeling might change order of series.
+		sort.Slice(mf.Metric, func(i, j int) bool { return lessLabelPairs(mf.Metric[i].GetLabel(), mf.Metric[j].GetLabel()) })
+
+		var kept, over []*dto.Metric
+		for _, m := range mf.GetMetric() {
+			if (g.limits.MaxSeriesPerMetric == 0 || len(kept) < g.limits.MaxSeriesPerMetric) &&
+				(g.limits.MaxSeriesPerService == 0 || total < g.limits.MaxSeriesPerService) {
+				kept = append(kept, m)
+				total++
+				continue
+			}
+			over = append(over, m)
+		}
+
+		if len(over) > 0 {
+			g.drop(mf.GetName(), len(over))
+
+			if g.limits.OverflowAction == OverflowActionAggregate {
+				if m := g.aggregate(mf.GetType(), over); m != nil {
+					kept = append(kept, m)
+				}
+			}
+		}
+
+		// Families without series are not allowed in exposition.
+		if len(kept) > 0 {
+			mf.Metric = kept
+			result = append(result, mf)
+		}
+	}
+
+	if mf := g.droppedFamily(); mf != nil {
+		result = append(result, mf)
+		sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+	}
+
+	return result
+}
+
+// aggregate sums values of gauges over the limits into single series, nil is returned for other types. Set of series
+// over the limits changes when series appear or disappear, hence sum of counters would not be monotonic. Histograms
+// and summaries can't be aggregated.
+func (g *cardinalityGuard) aggregate(t dto.MetricType, metrics []*dto.Metric) *dto.Metric {
+	if t != dto.MetricType_GAUGE {
+		return nil
+	}
+
+	var value float64
+	for _, m := range metrics {
+		value += m.GetGauge().GetValue()
+	}
+
+	// Constant labels which identify the service are kept, values of variable labels are replaced.
+	labels := map[string]string{}
+	for _, lp := range metrics[0].GetLabel() {
+		labels[lp.GetName()] = overflowLabelValue
+		if v, ok := g.constLabels[lp.GetName()]; ok {
+			labels[lp.GetName()] = v
+		}
+	}
+
+	return &dto.Metric{Label: newLabelPairs(labels), Gauge: &dto.Gauge{Value: &value}}
+}
+
+// drop counts dropped series of the metric, exceeding of limits is logged once per metric.
+func (g *cardinalityGuard) drop(name string, n int) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.dropped[name] += float64(n)
+
+	if !g.warned[name] {
+		g.warned[name] = true
+		log.Warnf("cardinality limit exceeded by metric %s, extra series are handled with '%s' action", name, g.limits.OverflowAction)
+	}
+}
+
+// droppedFamily returns counters of dropped series. Returns nil if no series have been dropped.
+func (g *cardinalityGuard) droppedFamily() *dto.MetricFamily {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if len(g.dropped) == 0 {
+		return nil
+	}
+
+	names := make([]string, 0, len(g.dropped))
+	for name := range g.dropped {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	name, help, t := "pgscv_series_dropped_total", "Total number of series dropped or aggregated because of exceeded cardinality limits.", dto.MetricType_COUNTER
+	mf := &dto.MetricFamily{Name: &name, Help: &help, Type: &t}
+	for _, metric := range names {
+		labels := map[string]string{"metric": metric}
+		for k, v := range g.constLabels {
+			labels[k] = v
+		}
+
+		value := g.dropped[metric]
+		mf.Metric = append(mf.Metric, &dto.Metric{Label: newLabelPairs(labels), Counter: &dto.Counter{Value: &value}})
+	}
+
+	return mf
+}
+
+// newLabelPairs converts labels to label pairs sorted by names.
+func newLabelPairs(labels map[string]string) []*dto.LabelPair {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	pairs := make([]*dto.LabelPair, len(names))
+	for i := range names {
+		k, v := names[i], labels[names[i]]
+		pairs[i] = &dto.LabelPair{Name: &k, Value: &v}
+	}
+
+	return pairs
+}
+
+// lessLabelPairs compares label pairs sorted by names, pairs are compared by names and then by values.
+func lessLabelPairs(a, b []*dto.LabelPair) bool {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if a[i].GetName() != b[i].GetName() {
+			return a[i].GetName() < b[i].GetName()
+		}
+		if a[i].GetValue() != b[i].GetValue() {
+			return a[i].GetValue() < b[i].GetValue()
+		}
+	}
+
+	return len(a) < len(b)
+}
@@ -0,0 +1,205 @@
+package collector
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestCardinalityLimits_Validate(t *testing.T) {
+	var testcases = []struct {
+		valid bool
+		in    CardinalityLimits
+		want  string
+	}{
+		{valid: true, in: CardinalityLimits{}, want: OverflowActionDrop},
+		{valid: true, in: CardinalityLimits{MaxSeriesPerMetric: 100, OverflowAction: "aggregate"}, want: OverflowActionAggregate},
+		{valid: false, in: CardinalityLimits{MaxSeriesPerMetric: -1}},
+		{valid: false, in: CardinalityLimits{MaxSeriesPerService: -1}},
+		{valid: false, in: CardinalityLimits{OverflowAction: "unknown"}},
+	}
+
+	for _, tc := range testcases {
+		err := tc.in.Validate()
+		if tc.valid {
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, tc.in.OverflowAction)
+		} else {
+			assert.Error(t, err)
+		}
+	}
+}
+
+// newTestFamily creates gauge family with series which have passed values of the 'relname' label and service's labels.
+func newTestFamily(name string, labels map[string]string, relnames ...string) *dto.MetricFamily {
+	t := dto.MetricType_GAUGE
+	mf := &dto.MetricFamily{Name: &name, Type: &t}
+	for i, relname := range relnames {
+		l := map[string]string{"relname": relname}
+		for k, v := range labels {
+			l[k] = v
+		}
+		value := float64(i + 1)
+		mf.Metric = append(mf.Metric, &dto.Metric{Label: newLabelPairs(l), Gauge: &dto.Gauge{Value: &value}})
+	}
+	return mf
+}
+
+func Test_cardinalityGuard_limit(t *testing.T) {
+	assert.Nil(t, newCardinalityGuard(CardinalityLimits{}, nil))
+
+	labels := prometheus.Labels{"instance": "test", "service_id": "postgres:5432"}
+
+	newFamilies := func() []*dto.MetricFamily {
+		return []*dto.MetricFamily{
+			newTestFamily("pgscv_collector_success", labels, "postgres/tables"),
+			newTestFamily("postgres_index_size_bytes", labels, "i1", "i2"),
+			newTestFamily("postgres_table_size_bytes", labels, "t1", "t2", "t3", "t4"),
+		}
+	}
+
+	testcases := []struct {
+		name   string
+		limits CardinalityLimits
+		want   map[string]float64 // series, where key is name and value of the first label
+	}{
+		{
+			name:   "per-metric limit with drop",
+			limits: CardinalityLimits{MaxSeriesPerMetric: 2, OverflowAction: OverflowActionDrop},
+			want: map[string]float64{
+				"postgres_table_size_bytes/t1": 1, "postgres_table_size_bytes/t2": 2,
+				"postgres_index_size_bytes/i1": 1, "postgres_index_size_bytes/i2": 2,
+				"pgscv_collector_success/postgres/tables":              1,
+				"pgscv_series_dropped_total/postgres_table_size_bytes": 2,
+			},
+		},
+		{
+			name:   "per-service limit with aggregate",
+			limits: CardinalityLimits{MaxSeriesPerService: 3, OverflowAction: OverflowActionAggregate},
+			want: map[string]float64{
+				"postgres_index_size_bytes/i1": 1, "postgres_index_size_bytes/i2": 2, "postgres_table_size_bytes/t1": 1,
+				"postgres_table_size_bytes/other":                      9,
+				"pgscv_collector_success/postgres/tables":              1,
+				"pgscv_series_dropped_total/postgres_table_size_bytes": 3,
+			},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			families := newCardinalityGuard(tc.limits, labels).limit(newFamilies())
+
+			got := map[string]float64{}
+			for i, mf := range families {
+				if i > 0 {
+					assert.Less(t, families[i-1].GetName(), mf.GetName())
+				}
+
+				for _, m := range mf.GetMetric() {
+					var key string
+					for _, lp := range m.GetLabel() {
+						if lp.GetName() != "instance" && lp.GetName() != "service_id" {
+							key = mf.GetName() + "/" + lp.GetValue()
+						}
+					}
+					assert.Len(t, m.GetLabel(), 3)
+
+					if m.Gauge != nil {
+						got[key] = m.GetGauge().GetValue()
+					} else {
+						got[key] = m.GetCounter().GetValue()
+					}
+				}
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func Test_cardinalityGuard_limit_dropFamily(t *testing.T) {
+	labels := prometheus.Labels{"instance": "test", "service_id": "postgres:5432"}
+	guard := newCardinalityGuard(CardinalityLimits{MaxSeriesPerService: 1, OverflowAction: OverflowActionDrop}, labels)
+
+	// Families which lost all series are removed.
+	families := guard.limit([]*dto.MetricFamily{
+		newTestFamily("postgres_index_size_bytes", labels, "i1"),
+		newTestFamily("postgres_table_size_bytes", labels, "t1", "t2"),
+	})
+	assert.Len(t, families, 2)
+	assert.Equal(t, "pgscv_series_dropped_total", families[0].GetName())
+	assert.Equal(t, "postgres_index_size_bytes", families[1].GetName())
+
+	// Counters of dropped series are accumulated between scrapes.
+	families = guard.limit([]*dto.MetricFamily{newTestFamily("postgres_table_size_bytes", labels, "t1", "t2")})
+	assert.Len(t, families, 2)
+	assert.Equal(t, float64(3), families[0].GetMetric()[0].GetCounter().GetValue())
+}
+
+func Test_cardinalityGuard_aggregateConstLabels(t *testing.T) {
+	labels := prometheus.Labels{"instance": "test", "service_id": "postgres:5432", "cluster": "main", "role": "leader"}
+	guard := newCardinalityGuard(CardinalityLimits{MaxSeriesPerMetric: 1, OverflowAction: OverflowActionAggregate}, labels)
+
+	families := guard.limit([]*dto.MetricFamily{newTestFamily("postgres_table_size_bytes", labels, "t1", "t2", "t3")})
+	assert.Len(t, families, 2) // counter of dropped series and limited family
+	assert.Len(t, families[1].GetMetric(), 2)
+
+	// Labels which identify the service are kept in aggregated series.
+	m := families[1].GetMetric()[1]
+	assert.Equal(t, float64(5), m.GetGauge().GetValue())
+
+	got := map[string]string{}
+	for _, lp := range m.GetLabel() {
+		got[lp.GetName()] = lp.GetValue()
+	}
+	assert.Equal(t, map[string]string{"instance": "test", "service_id": "postgres:5432", "cluster": "main", "role": "leader", "relname": "other"}, got)
+}
+
+func Test_cardinalityGuard_limit_deterministic(t *testing.T) {
+	labels := prometheus.Labels{"instance": "test", "service_id": "postgres:5432"}
+	limits := CardinalityLimits{MaxSeriesPerMetric: 2, MaxSeriesPerService: 3, OverflowAction: OverflowActionDrop}
+
+	kept := func(families []*dto.MetricFamily) []string {
+		var res []string
+		for _, mf := range newCardinalityGuard(limits, labels).limit(families) {
+			for _, m := range mf.GetMetric() {
+				for _, lp := range m.GetLabel() {
+					if lp.GetName() == "relname" {
+						res = append(res, mf.GetName()+"/"+lp.GetValue())
+					}
+				}
+			}
+		}
+		return res
+	}
+
+	// Same series are kept regardless of order of families and series.
+	want := []string{"postgres_index_size_bytes/i1", "postgres_index_size_bytes/i2", "postgres_table_size_bytes/t1"}
+	assert.Equal(t, want, kept([]*dto.MetricFamily{
+		newTestFamily("postgres_index_size_bytes", labels, "i1", "i2", "i3"),
+		newTestFamily("postgres_table_size_bytes", labels, "t1", "t2"),
+	}))
+	assert.Equal(t, want, kept([]*dto.MetricFamily{
+		newTestFamily("postgres_table_size_bytes", labels, "t2", "t1"),
+		newTestFamily("postgres_index_size_bytes", labels, "i3", "i1", "i2"),
+	}))
+}
+
+func Test_cardinalityGuard_aggregateCounters(t *testing.T) {
+	labels := prometheus.Labels{"instance": "test", "service_id": "postgres:5432"}
+	guard := newCardinalityGuard(CardinalityLimits{MaxSeriesPerMetric: 1, OverflowAction: OverflowActionAggregate}, labels)
+
+	mf := newTestFamily("postgres_table_seq_scan_total", labels, "t1", "t2", "t3")
+	counter := dto.MetricType_COUNTER
+	mf.Type = &counter
+	for _, m := range mf.Metric {
+		m.Counter, m.Gauge = &dto.Counter{Value: m.Gauge.Value}, nil
+	}
+
+	// Counters over the limits are dropped, because their sum is not monotonic.
+	families := guard.limit([]*dto.MetricFamily{mf})
+	assert.Len(t, families, 2)
+	assert.Equal(t, float64(2), families[0].GetMetric()[0].GetCounter().GetValue())
+	assert.Len(t, families[1].GetMetric(), 1)
+	assert.Equal(t, "t1", families[1].GetMetric()[0].GetLabel()[1].GetValue())
+}
@@ -0,0 +1,134 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"sort"
+)
+
+const (
+	// CheckStatusOK defines the collector has been run successfully.
+	CheckStatusOK = "ok"
+	// CheckStatusSkipped defines the collector has not been run, because it is not applicable to the service.
+	CheckStatusSkipped = "skipped"
+	// CheckStatusPermissionDenied defines the collector has not enough privileges.
+	CheckStatusPermissionDenied = "permission denied"
+	// CheckStatusMissingExtension defines the collector requires extension (or relation, function) which is not available.
+	CheckStatusMissingExtension = "missing extension"
+	// CheckStatusVersionTooOld defines the collector requires newer version of the service.
+	CheckStatusVersionTooOld = "version too old"
+	// CheckStatusFailed defines the collector has failed due to other reasons.
+	CheckStatusFailed = "failed"
+)
+
+// CheckResult describes result of the single run of the collector.
+type CheckResult struct {
+	// Name is the name of the collector.
+	Name string
+	// Status is the one of CheckStatus* values.
+	Status string
+	// Err describes the reason of status, nil for successful run.
+	Err error
+}
+
+// Failed returns true if the collector is not able to collect metrics.
+func (r CheckResult) Failed() bool {
+	return r.Status != CheckStatusOK && r.Status != CheckStatusSkipped
+}
+
+// Check runs every collector once and returns results sorted by collectors names. Collected metrics are discarded.
+func (n PgscvCollector) Check(ctx context.Context) []CheckResult {
+	names := make([]string, 0, len(n.Collectors))
+	for name := range n.Collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	results := make([]CheckResult, 0, len(names))
+	for _, name := range names {
+		if status, err := checkPreconditions(name, n.Config); status != "" {
+			results = append(results, CheckResult{Name: name, Status: status, Err: err})
+			continue
+		}
+
+		ch := make(chan prometheus.Metric)
+		done := make(chan struct{})
+		go func() {
+			for range ch {
+			}
+			close(done)
+		}()
+
+		err := checkCollector(ctx, name, n.Config, n.Collectors[name], ch)
+		close(ch)
+		<-done
+
+		results = append(results, CheckResult{Name: name, Status: checkStatus(err), Err: err})
+	}
+
+	return results
+}
+
+// checkCollector runs the collector respecting its timeout.
+func checkCollector(ctx context.Context, name string, config Config, c Collector, ch chan<- prometheus.Metric) error {
+	if timeout := config.Settings[name].Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	return c.Update(ctx, config, ch)
+}
+
+// checkPreconditions returns status of collectors which silently do nothing when service doesn't satisfy their
+// requirements. Empty status is returned when collector should be run.
+func checkPreconditions(name string, config Config) (string, error) {
+	switch name {
+	case "postgres/statements":
+		if !config.PgStatStatements {
+			return CheckStatusSkipped, fmt.Errorf("optional pg_stat_statements is not loaded with shared_preload_libraries or not created in any database")
+		}
+	case "postgres/logs":
+		if config.ServerVersionNum < PostgresV10 {
+			return CheckStatusVersionTooOld, fmt.Errorf("requires Postgres 10 or newer")
+		}
+		if !config.LoggingCollector {
+			return CheckStatusSkipped, fmt.Errorf("logging_collector is disabled")
+		}
+	case "postgres/patroni":
+		if config.PatroniURL == "" {
+			return CheckStatusSkipped, fmt.Errorf("patroni_url is not specified")
+		}
+	case "postgres/storage":
+		if config.ServerVersionNum < PostgresV10 {
+			return CheckStatusVersionTooOld, fmt.Errorf("requires Postgres 10 or newer")
+		}
+	}
+
+	return "", nil
+}
+
+// checkStatus converts error returned by collector into check status using SQLSTATE codes of Postgres errors.
+func checkStatus(err error) string {
+	if err == nil {
+		return CheckStatusOK
+	}
+
+	var pgErr interface{ SQLState() string }
+	if !errors.As(err, &pgErr) {
+		return CheckStatusFailed
+	}
+
+	switch pgErr.SQLState() {
+	case "42501": // insufficient_privilege
+		return CheckStatusPermissionDenied
+	case "42P01", "42883", "58P01": // undefined_table, undefined_function, undefined_file
+		return CheckStatusMissingExtension
+	case "42703", "0A000": // undefined_column, feature_not_supported
+		return CheckStatusVersionTooOld
+	default:
+		return CheckStatusFailed
+	}
+}
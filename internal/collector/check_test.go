@@ -0,0 +1,84 @@
+package collector
+
+import (
+	"context"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// testSQLStateError is the error which carries SQLSTATE code like errors returned by Postgres.
+type testSQLStateError struct {
+	code string
+}
+
+func (e testSQLStateError) Error() string    { return "ERROR: test (SQLSTATE " + e.code + ")" }
+func (e testSQLStateError) SQLState() string { return e.code }
+
+func TestPgscvCollector_Check(t *testing.T) {
+	desc := typedDesc{
+		desc: prometheus.NewDesc("test_metric", "Test metric.", []string{"num"}, nil), valueType: prometheus.GaugeValue,
+	}
+
+	c := PgscvCollector{
+		Config: Config{PostgresServiceConfig: PostgresServiceConfig{ServerVersionNum: 130000}},
+		Collectors: map[string]Collector{
+			"test/ok":             &testCollector{n: 3, desc: desc},
+			"test/denied":         &testCollector{n: 1, desc: desc, err: fmt.Errorf("query failed: %w", testSQLStateError{"42501"})},
+			"test/failed":         &testCollector{err: fmt.Errorf("failed")},
+			"postgres/logs":       &testCollector{},
+			"postgres/statements": &testCollector{},
+		},
+	}
+
+	results := c.Check(context.Background())
+	assert.Len(t, results, 5)
+
+	var statuses []string
+	for _, r := range results {
+		statuses = append(statuses, r.Name+": "+r.Status)
+	}
+	assert.Equal(t, []string{
+		"postgres/logs: skipped",
+		"postgres/statements: skipped",
+		"test/denied: permission denied",
+		"test/failed: failed",
+		"test/ok: ok",
+	}, statuses)
+
+	assert.False(t, results[0].Failed())
+	assert.False(t, results[1].Failed())
+	assert.True(t, results[2].Failed())
+	assert.False(t, results[4].Failed())
+	assert.NoError(t, results[4].Err)
+}
+
+func Test_checkPreconditions(t *testing.T) {
+	status, err := checkPreconditions("postgres/storage", Config{PostgresServiceConfig: PostgresServiceConfig{ServerVersionNum: 90600}})
+	assert.Equal(t, CheckStatusVersionTooOld, status)
+	assert.Error(t, err)
+
+	status, err = checkPreconditions("postgres/storage", Config{PostgresServiceConfig: PostgresServiceConfig{ServerVersionNum: 130000}})
+	assert.Equal(t, "", status)
+	assert.NoError(t, err)
+}
+
+func Test_checkStatus(t *testing.T) {
+	testcases := []struct {
+		err  error
+		want string
+	}{
+		{err: nil, want: CheckStatusOK},
+		{err: fmt.Errorf("connection refused"), want: CheckStatusFailed},
+		{err: testSQLStateError{"42501"}, want: CheckStatusPermissionDenied},
+		{err: testSQLStateError{"42P01"}, want: CheckStatusMissingExtension},
+		{err: fmt.Errorf("wrapped: %w", testSQLStateError{"42883"}), want: CheckStatusMissingExtension},
+		{err: testSQLStateError{"42703"}, want: CheckStatusVersionTooOld},
+		{err: testSQLStateError{"57014"}, want: CheckStatusFailed},
+	}
+
+	for _, tc := range testcases {
+		assert.Equal(t, tc.want, checkStatus(tc.err))
+	}
+}
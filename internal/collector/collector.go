@@ -1,10 +1,17 @@
 package collector
 
 import (
+	"context"
+	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/model"
+	"github.com/weaponry/pgscv/internal/store"
 	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // Factories defines collector functions which used for collecting metrics.
@@ -57,6 +64,7 @@ func (f Factories) RegisterPostgresCollectors(disabled []string) {
 		"postgres/functions":         NewPostgresFunctionsCollector,
 		"postgres/locks":             NewPostgresLocksCollector,
 		"postgres/logs":              NewPostgresLogsCollector,
+		"postgres/patroni":           NewPostgresPatroniCollector,
 		"postgres/replication":       NewPostgresReplicationCollector,
 		"postgres/replication_slots": NewPostgresReplicationSlotsCollector,
 		"postgres/statements":        NewPostgresStatementsCollector,
@@ -101,6 +109,18 @@ func (f Factories) RegisterPgbouncerCollectors(disabled []string) {
 	}
 }
 
+// UnregisterLocalCollectors removes collectors which read files of the service on the local filesystem using paths
+// reported by the service, e.g. data directory and logfiles. These paths are meaningless for services which files are
+// not accessible at the same paths, e.g. remote services or services running in containers.
+func (f Factories) UnregisterLocalCollectors() {
+	for _, name := range []string{"postgres/logs", "postgres/storage"} {
+		if _, ok := f[name]; ok {
+			log.Debugln("disable local ", name)
+			delete(f, name)
+		}
+	}
+}
+
 // register is the generic routine which register any kind of collectors.
 func (f Factories) register(collector string, factory func(prometheus.Labels) (Collector, error)) {
 	f[collector] = factory
@@ -108,8 +128,18 @@ func (f Factories) register(collector string, factory func(prometheus.Labels) (C
 
 // Collector is the interface a collector has to implement.
 type Collector interface {
-	// Get new metrics and expose them via prometheus registry.
-	Update(config Config, ch chan<- prometheus.Metric) error
+	// Get new metrics and expose them via prometheus registry. Collecting should be stopped when context is done.
+	Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error
+}
+
+// closer is implemented by collectors which keep resources (e.g. background goroutines) between scrapes.
+type closer interface {
+	Close()
+}
+
+// labelsWatcher is implemented by collectors which notice changes of the service's labels.
+type labelsWatcher interface {
+	labelsChanged() bool
 }
 
 // Collector implements the prometheus.Collector interface.
@@ -118,6 +148,14 @@ type PgscvCollector struct {
 	Collectors map[string]Collector
 	// anchorDesc is a metric descriptor used for distinguishing collectors when unregister is required.
 	anchorDesc typedDesc
+	// configChanges is a metric descriptor of number of service's properties changes.
+	configChanges typedDesc
+	// stats keeps collectors' runtime statistics used for self-instrumentation metrics.
+	stats *collectorStats
+	// cache keeps last results of collectors which have collection interval.
+	cache *collectorCache
+	// cardinality keeps state of series limiting, nil if limits are not set.
+	cardinality *cardinalityGuard
 }
 
 // NewPgscvCollector accepts Factories and creates per-service instance of Collector.
@@ -128,7 +166,11 @@ func NewPgscvCollector(serviceID string, factories Factories, config Config) (*P
 	}
 
 	collectors := make(map[string]Collector)
-	constLabels := prometheus.Labels{"instance": hostname, "service_id": serviceID}
+	constLabels := prometheus.Labels{}
+	for name, value := range config.ConstLabels {
+		constLabels[name] = value
+	}
+	constLabels["instance"], constLabels["service_id"] = hostname, serviceID
 
 	for key := range factories {
 		collector, err := factories[key](constLabels)
@@ -148,7 +190,23 @@ func NewPgscvCollector(serviceID string, factories Factories, config Config) (*P
 		), valueType: prometheus.GaugeValue,
 	}
 
-	return &PgscvCollector{Config: config, Collectors: collectors, anchorDesc: desc}, nil
+	configChanges := typedDesc{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName("pgscv", "service", "config_changes_total"),
+			"Total number of times the service's properties have been changed and its collectors have been re-created.",
+			nil, constLabels,
+		), valueType: prometheus.CounterValue,
+	}
+
+	return &PgscvCollector{
+		Config:        config,
+		Collectors:    collectors,
+		anchorDesc:    desc,
+		configChanges: configChanges,
+		stats:         newCollectorStats(constLabels),
+		cache:         newCollectorCache(),
+		cardinality:   newCardinalityGuard(config.CardinalityLimits, constLabels),
+	}, nil
 }
 
 // Describe implements the prometheus.Collector interface.
@@ -158,6 +216,11 @@ func (n PgscvCollector) Describe(ch chan<- *prometheus.Desc) {
 
 // Collect implements the prometheus.Collector interface.
 func (n PgscvCollector) Collect(out chan<- prometheus.Metric) {
+	n.CollectContext(context.Background(), out)
+}
+
+// CollectContext collects metrics from all collectors, collectors are stopped when context is done.
+func (n PgscvCollector) CollectContext(ctx context.Context, out chan<- prometheus.Metric) {
 	wgCollector := sync.WaitGroup{}
 	wgSender := sync.WaitGroup{}
 
@@ -165,10 +228,13 @@ func (n PgscvCollector) Collect(out chan<- prometheus.Metric) {
 	pipelineIn := make(chan prometheus.Metric)
 
 	// Run collectors.
+	var authFailed int32
 	wgCollector.Add(len(n.Collectors))
 	for name, c := range n.Collectors {
 		go func(name string, c Collector) {
-			collect(name, n.Config, c, pipelineIn)
+			if err := collect(ctx, name, n.Config, c, pipelineIn, n.stats, n.cache); store.IsAuthError(err) {
+				atomic.StoreInt32(&authFailed, 1)
+			}
 			wgCollector.Done()
 		}(name, c)
 	}
@@ -180,12 +246,77 @@ func (n PgscvCollector) Collect(out chan<- prometheus.Metric) {
 		wgSender.Done()
 	}()
 
+	// Properties of Postgres services are re-read periodically, send number of their changes.
+	if n.Config.ServiceType == model.ServiceTypePostgresql {
+		pipelineIn <- n.configChanges.mustNewConstMetric(float64(n.Config.ConfigChanges))
+	}
+
 	// Wait until all collectors have been finished. Close the channel and allow to sender to send metrics.
 	wgCollector.Wait()
 	close(pipelineIn)
 
 	// Wait until metrics have been sent.
 	wgSender.Wait()
+
+	// Credentials might have been rotated, let the owner of the collector re-read them.
+	if atomic.LoadInt32(&authFailed) == 1 && n.Config.OnAuthFailure != nil {
+		n.Config.OnAuthFailure()
+	}
+
+	// Labels of the service might have been changed, let the owner of the collector re-create it.
+	if n.Config.OnLabelsChange != nil && n.labelsChanged() {
+		n.Config.OnLabelsChange()
+	}
+}
+
+// Gather collects metrics using passed context and applies relabeling rules and cardinality limits of the service
+// to collected metrics. Metrics collected despite of errors are returned with the error.
+func (n PgscvCollector) Gather(ctx context.Context) ([]*dto.MetricFamily, error) {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(&contextCollector{ctx: ctx, collector: n})
+
+	families, err := registry.Gather()
+
+	if len(n.Config.RelabelConfigs) > 0 {
+		families = n.Config.RelabelConfigs.ProcessFamilies(families)
+	}
+
+	// Series limiting is applied after relabeling, because relabeling could drop or merge series.
+	return n.cardinality.limit(families), err
+}
+
+// contextCollector collects metrics of the service using specified context.
+type contextCollector struct {
+	ctx       context.Context
+	collector PgscvCollector
+}
+
+// Describe implements prometheus.Collector interface. Collector lives only during single gathering, hence it is unchecked.
+func (c *contextCollector) Describe(_ chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector interface.
+func (c *contextCollector) Collect(ch chan<- prometheus.Metric) {
+	c.collector.CollectContext(c.ctx, ch)
+}
+
+// labelsChanged returns true if any collector noticed labels of the service have been changed.
+func (n PgscvCollector) labelsChanged() bool {
+	for _, c := range n.Collectors {
+		if w, ok := c.(labelsWatcher); ok && w.labelsChanged() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Close releases resources kept by collectors. Collector should not be used after closing.
+func (n PgscvCollector) Close() {
+	for _, c := range n.Collectors {
+		if cl, ok := c.(closer); ok {
+			cl.Close()
+		}
+	}
 }
 
 // send acts like a middleware between metric collector functions which produces metrics and Prometheus who accepts metrics.
@@ -198,10 +329,210 @@ func send(in <-chan prometheus.Metric, out chan<- prometheus.Metric) {
 	}
 }
 
-// collect runs metric collection function and wraps it into instrumenting logic.
-func collect(name string, config Config, c Collector, ch chan<- prometheus.Metric) {
-	err := c.Update(config, ch)
-	if err != nil {
+// collect runs metric collection function and wraps it into instrumenting logic. Collector's metrics are passed
+// further only when collector has finished in time, partial results of timed out collectors are dropped. Collectors
+// with collection interval are not run until interval is elapsed, their last results are sent from cache instead.
+// Returns error of the collector's run.
+func collect(ctx context.Context, name string, config Config, c Collector, ch chan<- prometheus.Metric, stats *collectorStats, cache *collectorCache) error {
+	interval := config.Settings[name].Interval
+	if interval > 0 && cache != nil {
+		if metrics, ts, ok := cache.get(name, interval); ok {
+			for _, m := range metrics {
+				ch <- m
+			}
+			if stats != nil {
+				ch <- stats.cacheAge.mustNewConstMetric(time.Since(ts).Seconds(), name)
+			}
+			return nil
+		}
+	}
+
+	if timeout := config.Settings[name].Timeout; timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// Accumulate collector's metrics in intermediate buffer, and pass them only after collector finished.
+	in := make(chan prometheus.Metric)
+	collected := make(chan []prometheus.Metric, 1)
+	go func() {
+		var metrics []prometheus.Metric
+		for m := range in {
+			metrics = append(metrics, m)
+		}
+		collected <- metrics
+	}()
+
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		// Metrics can't be created when labels of the service clash with labels of the collector's metrics, fail the
+		// collector instead of crashing whole program.
+		defer func() {
+			if r := recover(); r != nil {
+				errCh <- fmt.Errorf("collector panicked: %v", r)
+				close(in)
+			}
+		}()
+
+		errCh <- c.Update(ctx, config, in)
+		close(in)
+	}()
+
+	var err error
+	var metrics []prometheus.Metric
+
+	// Don't wait for collectors which don't respect the context, they will finish in background and their metrics
+	// will be dropped.
+	select {
+	case err = <-errCh:
+		metrics = <-collected
+	case <-ctx.Done():
+	}
+
+	duration := time.Since(start)
+
+	if ctx.Err() != nil {
+		log.Errorf("%s collector failed; %s, drop collected metrics", name, ctx.Err())
+		err, metrics = ctx.Err(), nil
+	} else if err != nil {
 		log.Errorf("%s collector failed; %s", name, err)
 	}
+
+	if stats != nil {
+		metrics = append(metrics, stats.update(name, duration, len(metrics), err, start)...)
+	}
+
+	// Only successful results are cached, failed collectors are retried at next scrape.
+	if interval > 0 && cache != nil && err == nil {
+		cache.put(name, metrics, start)
+	}
+
+	for _, m := range metrics {
+		ch <- m
+	}
+
+	if interval > 0 && stats != nil {
+		ch <- stats.cacheAge.mustNewConstMetric(0, name)
+	}
+
+	return err
+}
+
+// collectorStats defines self-instrumentation metrics of collectors and keeps state required for them.
+type collectorStats struct {
+	mu        sync.Mutex
+	statuses  map[string]CollectorStatus // results of the last run of each collector
+	duration  typedDesc
+	success   typedDesc
+	lastError typedDesc
+	metrics   typedDesc
+	cacheAge  typedDesc
+}
+
+// newCollectorStats creates collectors statistics with descriptors labelled with passed labels.
+func newCollectorStats(labels prometheus.Labels) *collectorStats {
+	return &collectorStats{
+		statuses: map[string]CollectorStatus{},
+		duration: typedDesc{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName("pgscv", "collector", "scrape_duration_seconds"),
+				"Duration of the collector's last scrape, in seconds.",
+				[]string{"collector"}, labels,
+			), valueType: prometheus.GaugeValue,
+		},
+		success: typedDesc{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName("pgscv", "collector", "success"),
+				"Whether the collector's last scrape succeeded.",
+				[]string{"collector"}, labels,
+			), valueType: prometheus.GaugeValue,
+		},
+		lastError: typedDesc{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName("pgscv", "collector", "last_error_timestamp"),
+				"Time of the collector's last failed scrape, in unixtime, zero if collector never failed.",
+				[]string{"collector"}, labels,
+			), valueType: prometheus.GaugeValue,
+		},
+		metrics: typedDesc{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName("pgscv", "collector", "scraped_metrics"),
+				"Number of metrics produced by the collector during the last scrape.",
+				[]string{"collector"}, labels,
+			), valueType: prometheus.GaugeValue,
+		},
+		cacheAge: typedDesc{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName("pgscv", "collector", "cache_age_seconds"),
+				"Age of the collector's cached results served instead of running the collector, in seconds.",
+				[]string{"collector"}, labels,
+			), valueType: prometheus.GaugeValue,
+		},
+	}
+}
+
+// update saves result of the collector's scrape and returns self-instrumentation metrics for the collector.
+func (s *collectorStats) update(name string, duration time.Duration, n int, err error, ts time.Time) []prometheus.Metric {
+	s.mu.Lock()
+	status := s.statuses[name]
+	status.Name, status.LastRun, status.Duration, status.Success, status.ScrapedMetrics = name, &ts, duration.Seconds(), err == nil, n
+	if err != nil {
+		status.LastError, status.LastErrorTime = err.Error(), &ts
+	}
+	s.statuses[name] = status
+	s.mu.Unlock()
+
+	var success, lastErrorTs float64
+	if err == nil {
+		success = 1
+	}
+	if status.LastErrorTime != nil {
+		lastErrorTs = float64(status.LastErrorTime.UnixNano()) / float64(time.Second)
+	}
+
+	return []prometheus.Metric{
+		s.duration.mustNewConstMetric(duration.Seconds(), name),
+		s.success.mustNewConstMetric(success, name),
+		s.lastError.mustNewConstMetric(lastErrorTs, name),
+		s.metrics.mustNewConstMetric(float64(n), name),
+	}
+}
+
+// collectorCache keeps last results of collectors.
+type collectorCache struct {
+	mu      sync.RWMutex
+	entries map[string]cacheEntry
+}
+
+// cacheEntry is the collector's results with time when they have been collected.
+type cacheEntry struct {
+	metrics []prometheus.Metric
+	ts      time.Time
+}
+
+// newCollectorCache creates empty collectors cache.
+func newCollectorCache() *collectorCache {
+	return &collectorCache{entries: map[string]cacheEntry{}}
+}
+
+// get returns cached collector's results and time when they have been collected, if results are younger than interval.
+func (c *collectorCache) get(name string, interval time.Duration) ([]prometheus.Metric, time.Time, bool) {
+	c.mu.RLock()
+	e, ok := c.entries[name]
+	c.mu.RUnlock()
+
+	if !ok || time.Since(e.ts) >= interval {
+		return nil, time.Time{}, false
+	}
+
+	return e.metrics, e.ts, true
+}
+
+// put saves collector's results.
+func (c *collectorCache) put(name string, metrics []prometheus.Metric, ts time.Time) {
+	c.mu.Lock()
+	c.entries[name] = cacheEntry{metrics: metrics, ts: ts}
+	c.mu.Unlock()
 }
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaponry/pgscv/internal/log"
 )
 
 // typedDesc is the descriptor wrapper with extra properties
@@ -21,3 +22,23 @@ func (d *typedDesc) mustNewConstMetric(value float64, labels ...string) promethe
 	}
 	return prometheus.MustNewConstMetric(d.desc, d.valueType, value, labels...)
 }
+
+// firstError returns the first non-nil error, other errors are logged. It is used by collectors which don't stop
+// collecting when particular queries fail, but report these failures.
+func firstError(errs []error) error {
+	var first error
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+
+		if first == nil {
+			first = err
+			continue
+		}
+
+		log.Errorln(err)
+	}
+
+	return first
+}
@@ -0,0 +1,15 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_firstError(t *testing.T) {
+	assert.NoError(t, firstError(nil))
+	assert.NoError(t, firstError([]error{nil, nil}))
+
+	err1, err2 := fmt.Errorf("first"), fmt.Errorf("second")
+	assert.Equal(t, err1, firstError([]error{nil, err1, nil, err2}))
+}
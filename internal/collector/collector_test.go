@@ -1,11 +1,34 @@
 package collector
 
 import (
+	"context"
+	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/model"
+	"github.com/weaponry/pgscv/internal/relabel"
+	"regexp"
 	"testing"
+	"time"
 )
 
+func TestFactories_UnregisterLocalCollectors(t *testing.T) {
+	f := Factories{}
+	f.RegisterPostgresCollectors(nil)
+	f.UnregisterLocalCollectors()
+
+	assert.NotContains(t, f, "postgres/logs")
+	assert.NotContains(t, f, "postgres/storage")
+	assert.Contains(t, f, "postgres/activity")
+
+	// Missing collectors are ignored.
+	f = Factories{}
+	f.RegisterPgbouncerCollectors(nil)
+	f.UnregisterLocalCollectors()
+	assert.Len(t, f, 4)
+}
+
 func TestPgscvCollector_Collect(t *testing.T) {
 	// Create test stuff - factory and collector, register system only metrics.
 	f := Factories{}
@@ -36,3 +59,278 @@ func TestPgscvCollector_Collect(t *testing.T) {
 	assert.NotNil(t, metrics)
 	assert.Greater(t, len(metrics), 0)
 }
+
+func TestNewPgscvCollector_constLabels(t *testing.T) {
+	f := Factories{}
+	f.RegisterSystemCollectors([]string{})
+	c, err := NewPgscvCollector("test:0", f, Config{ConstLabels: map[string]string{"cluster": "main", "service_id": "ignored"}})
+	assert.NoError(t, err)
+
+	desc := c.anchorDesc.desc.String()
+	assert.Contains(t, desc, `cluster="main"`)
+	assert.Contains(t, desc, `service_id="test:0"`)
+}
+
+func TestPgscvCollector_Gather(t *testing.T) {
+	configs := relabel.Configs{
+		{SourceLabels: []string{"__name__"}, Regex: "node_load(1|5)", Action: "drop"},
+		{SourceLabels: []string{"service_id"}, Regex: "test:(.+)", TargetLabel: "instance", Replacement: "test-$1"},
+	}
+	assert.NoError(t, configs.Compile())
+
+	f := Factories{"system/loadaverage": NewLoadAverageCollector}
+	c, err := NewPgscvCollector("test:0", f, Config{RelabelConfigs: configs, CardinalityLimits: CardinalityLimits{MaxSeriesPerService: 1}})
+	assert.NoError(t, err)
+
+	families, err := c.Gather(context.Background())
+	assert.NoError(t, err)
+
+	names := map[string]bool{}
+	for _, mf := range families {
+		names[mf.GetName()] = true
+
+		// Constant labels are relabeled too.
+		if mf.GetName() == "node_load15" {
+			assert.Len(t, mf.GetMetric(), 1)
+			assert.Equal(t, "instance", mf.GetMetric()[0].GetLabel()[0].GetName())
+			assert.Equal(t, "test-0", mf.GetMetric()[0].GetLabel()[0].GetValue())
+		}
+	}
+
+	assert.True(t, names["node_load15"])
+	assert.False(t, names["node_load1"])
+	assert.False(t, names["node_load5"])
+	assert.True(t, names["pgscv_collector_success"])
+	assert.False(t, names["pgscv_series_dropped_total"])
+}
+
+func TestPgscvCollector_CollectContext_configChanges(t *testing.T) {
+	collectChanges := func(serviceType string) []float64 {
+		c, err := NewPgscvCollector("test:0", Factories{}, Config{ServiceType: serviceType, ConfigChanges: 2})
+		assert.NoError(t, err)
+
+		ch := make(chan prometheus.Metric)
+		go func() {
+			c.CollectContext(context.Background(), ch)
+			close(ch)
+		}()
+
+		var values []float64
+		for m := range ch {
+			metric := &dto.Metric{}
+			assert.NoError(t, m.Write(metric))
+			assert.Contains(t, m.Desc().String(), "pgscv_service_config_changes_total")
+			values = append(values, metric.GetCounter().GetValue())
+		}
+		return values
+	}
+
+	assert.Equal(t, []float64{2}, collectChanges(model.ServiceTypePostgresql))
+	assert.Len(t, collectChanges(model.ServiceTypePgbouncer), 0)
+}
+
+func TestPgscvCollector_CollectContext_authFailure(t *testing.T) {
+	desc := typedDesc{
+		desc: prometheus.NewDesc("test_metric", "Test metric.", []string{"num"}, nil), valueType: prometheus.GaugeValue,
+	}
+
+	var calls int
+	c := PgscvCollector{
+		Config: Config{OnAuthFailure: func() { calls++ }},
+		Collectors: map[string]Collector{
+			"test/first":  &testCollector{n: 1, desc: desc, err: testAuthError{}},
+			"test/second": &testCollector{n: 1, desc: desc, err: testAuthError{}},
+		},
+	}
+
+	run := func() {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			c.CollectContext(context.Background(), ch)
+			close(ch)
+		}()
+		for range ch {
+		}
+	}
+
+	// Handler is called once per scrape regardless of number of failed collectors.
+	run()
+	assert.Equal(t, 1, calls)
+
+	// Handler is not called when collectors fail due to other reasons.
+	for _, tc := range c.Collectors {
+		tc.(*testCollector).err = fmt.Errorf("failed")
+	}
+	run()
+	assert.Equal(t, 1, calls)
+}
+
+// testAuthError imitates error returned by Postgres when password authentication failed.
+type testAuthError struct{}
+
+func (testAuthError) Error() string    { return "password authentication failed" }
+func (testAuthError) SQLState() string { return "28P01" }
+
+// testCollector is the collector which produces specified number of metrics, waits specified delay and returns specified error.
+type testCollector struct {
+	n     int
+	delay time.Duration
+	err   error
+	desc  typedDesc
+	runs  int // number of Update calls
+}
+
+// Update implements Collector interface.
+func (c *testCollector) Update(ctx context.Context, _ Config, ch chan<- prometheus.Metric) error {
+	c.runs++
+	for i := 0; i < c.n; i++ {
+		ch <- c.desc.mustNewConstMetric(1, fmt.Sprintf("%d", i))
+	}
+
+	select {
+	case <-time.After(c.delay):
+		return c.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func Test_collect(t *testing.T) {
+	stats := newCollectorStats(prometheus.Labels{"service_id": "test:0"})
+	desc := typedDesc{
+		desc: prometheus.NewDesc("test_metric", "Test metric.", []string{"num"}, nil), valueType: prometheus.GaugeValue,
+	}
+
+	config := Config{Settings: CollectorsSettings{"test/example": {Timeout: 100 * time.Millisecond}}}
+
+	testcases := []struct {
+		collector   *testCollector
+		wantMetrics float64
+		wantSuccess float64
+		wantFailed  bool
+	}{
+		{collector: &testCollector{n: 3, desc: desc}, wantMetrics: 3, wantSuccess: 1},
+		{collector: &testCollector{n: 1, err: fmt.Errorf("failed"), desc: desc}, wantMetrics: 1, wantSuccess: 0, wantFailed: true},
+		{collector: &testCollector{n: 2, desc: desc}, wantMetrics: 2, wantSuccess: 1, wantFailed: true},                     // last error is remembered
+		{collector: &testCollector{n: 2, delay: time.Second, desc: desc}, wantMetrics: 0, wantSuccess: 0, wantFailed: true}, // timed out
+	}
+
+	re := regexp.MustCompile(`fqName: "([a-zA-Z0-9_]+)"`)
+
+	for _, tc := range testcases {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			collect(context.Background(), "test/example", config, tc.collector, ch, stats, nil)
+			close(ch)
+		}()
+
+		values := map[string]float64{}
+		for m := range ch {
+			name := re.FindStringSubmatch(m.Desc().String())[1]
+			if name == "test_metric" {
+				values[name]++
+				continue
+			}
+
+			metric := &dto.Metric{}
+			assert.NoError(t, m.Write(metric))
+			assert.Equal(t, "test/example", metric.GetLabel()[0].GetValue())
+			values[name] = metric.GetGauge().GetValue()
+		}
+
+		assert.Equal(t, tc.wantMetrics, values["test_metric"])
+		assert.Equal(t, tc.wantMetrics, values["pgscv_collector_scraped_metrics"])
+		assert.Equal(t, tc.wantSuccess, values["pgscv_collector_success"])
+		assert.Contains(t, values, "pgscv_collector_scrape_duration_seconds")
+		if tc.wantFailed {
+			assert.Greater(t, values["pgscv_collector_last_error_timestamp"], float64(0))
+		} else {
+			assert.Equal(t, float64(0), values["pgscv_collector_last_error_timestamp"])
+		}
+	}
+}
+
+func Test_collect_labelsClash(t *testing.T) {
+	// Label of the service clashes with label of the collector's metric, metrics can't be created.
+	desc := typedDesc{
+		desc: prometheus.NewDesc("test_metric", "Test metric.", []string{"num"}, prometheus.Labels{"num": "1"}), valueType: prometheus.GaugeValue,
+	}
+
+	ch := make(chan prometheus.Metric)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- collect(context.Background(), "test/example", Config{}, &testCollector{n: 1, desc: desc}, ch, nil, nil)
+		close(ch)
+	}()
+
+	var n int
+	for range ch {
+		n++
+	}
+
+	// Collector fails, nothing is collected.
+	assert.Error(t, <-errCh)
+	assert.Equal(t, 0, n)
+}
+
+func Test_collect_interval(t *testing.T) {
+	stats := newCollectorStats(prometheus.Labels{"service_id": "test:0"})
+	cache := newCollectorCache()
+	desc := typedDesc{
+		desc: prometheus.NewDesc("test_metric", "Test metric.", []string{"num"}, nil), valueType: prometheus.GaugeValue,
+	}
+
+	config := Config{Settings: CollectorsSettings{"test/example": {Interval: 200 * time.Millisecond}}}
+	c := &testCollector{n: 3, desc: desc}
+
+	re := regexp.MustCompile(`fqName: "([a-zA-Z0-9_]+)"`)
+
+	run := func() map[string]float64 {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			collect(context.Background(), "test/example", config, c, ch, stats, cache)
+			close(ch)
+		}()
+
+		values := map[string]float64{}
+		for m := range ch {
+			name := re.FindStringSubmatch(m.Desc().String())[1]
+			if name == "test_metric" {
+				values[name]++
+				continue
+			}
+
+			metric := &dto.Metric{}
+			assert.NoError(t, m.Write(metric))
+			values[name] = metric.GetGauge().GetValue()
+		}
+		return values
+	}
+
+	// First run - results collected and cached.
+	values := run()
+	assert.Equal(t, 1, c.runs)
+	assert.Equal(t, float64(3), values["test_metric"])
+	assert.Equal(t, float64(1), values["pgscv_collector_success"])
+	assert.Equal(t, float64(0), values["pgscv_collector_cache_age_seconds"])
+
+	// Interval is not elapsed - results served from cache.
+	time.Sleep(50 * time.Millisecond)
+	values = run()
+	assert.Equal(t, 1, c.runs)
+	assert.Equal(t, float64(3), values["test_metric"])
+	assert.Equal(t, float64(1), values["pgscv_collector_success"])
+	assert.Greater(t, values["pgscv_collector_cache_age_seconds"], float64(0))
+
+	// Interval is elapsed - collector runs again.
+	time.Sleep(200 * time.Millisecond)
+	run()
+	assert.Equal(t, 2, c.runs)
+
+	// Failed results are not cached.
+	c.err = fmt.Errorf("failed")
+	time.Sleep(200 * time.Millisecond)
+	run()
+	run()
+	assert.Equal(t, 4, c.runs)
+}
@@ -2,12 +2,15 @@ package collector
 
 import (
 	"context"
+	"fmt"
 	"github.com/jackc/pgx/v4"
 	"github.com/weaponry/pgscv/internal/filter"
 	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/relabel"
 	"github.com/weaponry/pgscv/internal/store"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Config defines collector configuration settings
@@ -23,6 +26,70 @@ type Config struct {
 	PostgresServiceConfig
 	// Filters are user-defined regular expressions allow to include/exclude collecting various stats.
 	Filters map[string]filter.Filter
+	// Settings defines user-defined settings of particular collectors.
+	Settings CollectorsSettings
+	// RelabelConfigs defines user-defined relabeling rules applied to collected metrics.
+	RelabelConfigs relabel.Configs
+	// CardinalityLimits defines limits of number of series produced by collectors during single scrape.
+	CardinalityLimits CardinalityLimits
+	// ConstLabels defines extra labels attached to all metrics of the service.
+	ConstLabels map[string]string
+	// OnAuthFailure is called once per scrape when collectors failed to authenticate to the service. It allows to
+	// re-read credentials of the service, nil if credentials can't be re-read.
+	OnAuthFailure func()
+	// PatroniURL defines URL of Patroni REST API of the member which manages Postgres, empty if Postgres is not
+	// managed by Patroni.
+	PatroniURL string
+	// PatroniLabels defines labels of Patroni member read when the service has been set up.
+	PatroniLabels map[string]string
+	// OnLabelsChange is called once per scrape when collectors noticed labels of the service have been changed, e.g.
+	// role of Patroni member after switchover. It allows to re-create the collector with new labels.
+	OnLabelsChange func()
+	// ConfigChanges defines number of times properties of the service have been changed since start.
+	ConfigChanges int
+}
+
+// CollectorSettings defines settings of particular collector.
+type CollectorSettings struct {
+	// Timeout defines maximum duration of collector's run. When timeout is exceeded, collector's queries are canceled
+	// and collected metrics are dropped. Zero means the collector is limited only by the scrape timeout.
+	Timeout time.Duration `yaml:"timeout"`
+	// Interval defines minimal interval between collector's runs. Until interval is elapsed, collector's last results
+	// are served from cache. Zero means the collector runs at every scrape.
+	Interval time.Duration `yaml:"interval"`
+}
+
+// CollectorsSettings defines settings of collectors, where key is the collector's name.
+type CollectorsSettings map[string]CollectorSettings
+
+// Validate checks collectors settings contain known collectors and valid values.
+func (s CollectorsSettings) Validate() error {
+	for name, settings := range s {
+		if !IsKnown(name) {
+			return fmt.Errorf("unknown collector '%s'", name)
+		}
+
+		if settings.Timeout < 0 {
+			return fmt.Errorf("negative timeout of collector '%s'", name)
+		}
+
+		if settings.Interval < 0 {
+			return fmt.Errorf("negative interval of collector '%s'", name)
+		}
+	}
+
+	return nil
+}
+
+// IsKnown returns true if collector with specified name exists.
+func IsKnown(name string) bool {
+	known := Factories{}
+	known.RegisterSystemCollectors(nil)
+	known.RegisterPostgresCollectors(nil)
+	known.RegisterPgbouncerCollectors(nil)
+
+	_, ok := known[name]
+	return ok
 }
 
 // PostgresServiceConfig defines Postgres-specific stuff required during collecting Postgres metrics.
@@ -39,10 +106,18 @@ type PostgresServiceConfig struct {
 	PgStatStatements bool
 	// PgStatStatementsSource defines the database name where pg_stat_statements is available
 	PgStatStatementsSource string
+	// InRecovery defines Postgres is running in recovery mode, e.g. it is a standby.
+	InRecovery bool
 }
 
 // NewPostgresServiceConfig defines new config for Postgres-based collectors
 func NewPostgresServiceConfig(connStr string) (PostgresServiceConfig, error) {
+	return NewPostgresServiceConfigContext(context.Background(), connStr)
+}
+
+// NewPostgresServiceConfigContext defines new config for Postgres-based collectors, connecting and queries are
+// canceled when context is done.
+func NewPostgresServiceConfigContext(ctx context.Context, connStr string) (PostgresServiceConfig, error) {
 	var config = PostgresServiceConfig{}
 
 	pgconfig, err := pgx.ParseConfig(connStr)
@@ -50,7 +125,7 @@ func NewPostgresServiceConfig(connStr string) (PostgresServiceConfig, error) {
 		return config, err
 	}
 
-	conn, err := store.NewWithConfig(pgconfig)
+	conn, err := store.NewWithConfigContext(ctx, pgconfig)
 	if err != nil {
 		return config, err
 	}
@@ -59,7 +134,7 @@ func NewPostgresServiceConfig(connStr string) (PostgresServiceConfig, error) {
 	var setting string
 
 	// Get Postgres block size.
-	err = conn.Conn().QueryRow(context.Background(), "SELECT setting FROM pg_settings WHERE name = 'block_size'").Scan(&setting)
+	err = conn.Conn().QueryRow(ctx, "SELECT setting FROM pg_settings WHERE name = 'block_size'").Scan(&setting)
 	if err != nil {
 		return config, err
 	}
@@ -71,7 +146,7 @@ func NewPostgresServiceConfig(connStr string) (PostgresServiceConfig, error) {
 	config.BlockSize = bsize
 
 	// Get Postgres server version
-	err = conn.Conn().QueryRow(context.Background(), "SELECT setting FROM pg_settings WHERE name = 'server_version_num'").Scan(&setting)
+	err = conn.Conn().QueryRow(ctx, "SELECT setting FROM pg_settings WHERE name = 'server_version_num'").Scan(&setting)
 	if err != nil {
 		return config, err
 	}
@@ -87,7 +162,7 @@ func NewPostgresServiceConfig(connStr string) (PostgresServiceConfig, error) {
 	config.ServerVersionNum = version
 
 	// Get Postgres data directory
-	err = conn.Conn().QueryRow(context.Background(), "SELECT setting FROM pg_settings WHERE name = 'data_directory'").Scan(&setting)
+	err = conn.Conn().QueryRow(ctx, "SELECT setting FROM pg_settings WHERE name = 'data_directory'").Scan(&setting)
 	if err != nil {
 		return config, err
 	}
@@ -95,7 +170,7 @@ func NewPostgresServiceConfig(connStr string) (PostgresServiceConfig, error) {
 	config.DataDirectory = setting
 
 	// Get setting of 'logging_collector' GUC.
-	err = conn.Conn().QueryRow(context.Background(), "SELECT setting FROM pg_settings WHERE name = 'logging_collector'").Scan(&setting)
+	err = conn.Conn().QueryRow(ctx, "SELECT setting FROM pg_settings WHERE name = 'logging_collector'").Scan(&setting)
 	if err != nil {
 		return config, err
 	}
@@ -105,7 +180,7 @@ func NewPostgresServiceConfig(connStr string) (PostgresServiceConfig, error) {
 	}
 
 	// Get shared_preload_libraries (for inspecting enabled extensions).
-	err = conn.Conn().QueryRow(context.Background(), "SELECT setting FROM pg_settings WHERE name = 'shared_preload_libraries'").Scan(&setting)
+	err = conn.Conn().QueryRow(ctx, "SELECT setting FROM pg_settings WHERE name = 'shared_preload_libraries'").Scan(&setting)
 	if err != nil {
 		return config, err
 	}
@@ -118,5 +193,38 @@ func NewPostgresServiceConfig(connStr string) (PostgresServiceConfig, error) {
 		config.PgStatStatements = false
 	}
 
+	// Get recovery state, it changes after promotion of standby.
+	err = conn.Conn().QueryRow(ctx, "SELECT pg_is_in_recovery()").Scan(&config.InRecovery)
+	if err != nil {
+		return config, err
+	}
+
 	return config, nil
 }
+
+// Changes returns descriptions of properties which differ in other config. Source of pg_stat_statements is not compared,
+// it is defined by collector at runtime.
+func (c PostgresServiceConfig) Changes(other PostgresServiceConfig) []string {
+	var changes []string
+
+	if c.BlockSize != other.BlockSize {
+		changes = append(changes, fmt.Sprintf("block_size: %d -> %d", c.BlockSize, other.BlockSize))
+	}
+	if c.ServerVersionNum != other.ServerVersionNum {
+		changes = append(changes, fmt.Sprintf("server_version_num: %d -> %d", c.ServerVersionNum, other.ServerVersionNum))
+	}
+	if c.DataDirectory != other.DataDirectory {
+		changes = append(changes, fmt.Sprintf("data_directory: %s -> %s", c.DataDirectory, other.DataDirectory))
+	}
+	if c.LoggingCollector != other.LoggingCollector {
+		changes = append(changes, fmt.Sprintf("logging_collector: %t -> %t", c.LoggingCollector, other.LoggingCollector))
+	}
+	if c.PgStatStatements != other.PgStatStatements {
+		changes = append(changes, fmt.Sprintf("pg_stat_statements: %t -> %t", c.PgStatStatements, other.PgStatStatements))
+	}
+	if c.InRecovery != other.InRecovery {
+		changes = append(changes, fmt.Sprintf("in_recovery: %t -> %t", c.InRecovery, other.InRecovery))
+	}
+
+	return changes
+}
@@ -3,6 +3,7 @@ package collector
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestNewPostgresServiceConfig(t *testing.T) {
@@ -26,3 +27,47 @@ func TestNewPostgresServiceConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestPostgresServiceConfig_Changes(t *testing.T) {
+	config := PostgresServiceConfig{
+		BlockSize: 8192, ServerVersionNum: 130004, DataDirectory: "/var/lib/postgresql/13/main",
+		PgStatStatements: true, PgStatStatementsSource: "postgres", InRecovery: true,
+	}
+
+	// Source of pg_stat_statements is not compared.
+	other := config
+	other.PgStatStatementsSource = ""
+	assert.Nil(t, config.Changes(other))
+
+	// Promotion of standby.
+	other.InRecovery = false
+	assert.Equal(t, []string{"in_recovery: true -> false"}, config.Changes(other))
+
+	// Minor upgrade and removing pg_stat_statements from shared_preload_libraries.
+	other = config
+	other.ServerVersionNum = 130005
+	other.PgStatStatements = false
+	assert.Equal(t, []string{"server_version_num: 130004 -> 130005", "pg_stat_statements: true -> false"}, config.Changes(other))
+}
+
+func TestCollectorsSettings_Validate(t *testing.T) {
+	testcases := []struct {
+		valid    bool
+		settings CollectorsSettings
+	}{
+		{valid: true, settings: nil},
+		{valid: true, settings: CollectorsSettings{"postgres/schemas": {Timeout: 5 * time.Second}, "system/cpu": {}}},
+		{valid: false, settings: CollectorsSettings{"postgres/unknown": {Timeout: 5 * time.Second}}},
+		{valid: true, settings: CollectorsSettings{"postgres/storage": {Interval: time.Hour}}},
+		{valid: false, settings: CollectorsSettings{"postgres/schemas": {Timeout: -time.Second}}},
+		{valid: false, settings: CollectorsSettings{"postgres/storage": {Interval: -time.Hour}}},
+	}
+
+	for _, tc := range testcases {
+		if tc.valid {
+			assert.NoError(t, tc.settings.Validate())
+		} else {
+			assert.Error(t, tc.settings.Validate())
+		}
+	}
+}
@@ -3,6 +3,7 @@ package collector
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
@@ -83,7 +84,7 @@ func NewCPUCollector(labels prometheus.Labels) (Collector, error) {
 }
 
 // Update implements Collector and exposes cpu related metrics from /proc/stat and /sys/.../cpu/.
-func (c *cpuCollector) Update(_ Config, ch chan<- prometheus.Metric) error {
+func (c *cpuCollector) Update(_ context.Context, _ Config, ch chan<- prometheus.Metric) error {
 	stat, err := getCPUStat(c.systicks)
 	if err != nil {
 		return fmt.Errorf("collect cpu usage stats failed: %s; skip", err)
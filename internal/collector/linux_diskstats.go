@@ -3,6 +3,7 @@ package collector
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/filter"
@@ -127,7 +128,7 @@ func NewDiskstatsCollector(labels prometheus.Labels) (Collector, error) {
 	}, nil
 }
 
-func (c *diskstatsCollector) Update(config Config, ch chan<- prometheus.Metric) error {
+func (c *diskstatsCollector) Update(_ context.Context, config Config, ch chan<- prometheus.Metric) error {
 	stats, err := getDiskstats(config.Filters["diskstats/device"])
 	if err != nil {
 		return fmt.Errorf("get diskstats failed: %s", err)
@@ -55,7 +55,7 @@ func NewFilesystemCollector(labels prometheus.Labels) (Collector, error) {
 }
 
 // Update method collects filesystem usage statistics.
-func (c *filesystemCollector) Update(config Config, ch chan<- prometheus.Metric) error {
+func (c *filesystemCollector) Update(_ context.Context, config Config, ch chan<- prometheus.Metric) error {
 	stats, err := getFilesystemStats(config.Filters)
 	if err != nil {
 		return fmt.Errorf("get filesystem stats failed: %s", err)
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
@@ -43,7 +44,7 @@ func NewLoadAverageCollector(labels prometheus.Labels) (Collector, error) {
 }
 
 // Update implements Collector and exposes load average related metrics from /proc/loadavg.
-func (c *loadaverageCollector) Update(_ Config, ch chan<- prometheus.Metric) error {
+func (c *loadaverageCollector) Update(_ context.Context, _ Config, ch chan<- prometheus.Metric) error {
 	stats, err := getLoadAverageStats()
 	if err != nil {
 		return fmt.Errorf("get load average stats failed: %s", err)
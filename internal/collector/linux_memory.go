@@ -2,6 +2,7 @@ package collector
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
@@ -42,7 +43,7 @@ func NewMeminfoCollector(labels prometheus.Labels) (Collector, error) {
 }
 
 // Update method collects network interfaces statistics
-func (c *meminfoCollector) Update(_ Config, ch chan<- prometheus.Metric) error {
+func (c *meminfoCollector) Update(_ context.Context, _ Config, ch chan<- prometheus.Metric) error {
 	stats, err := getMeminfoStats()
 	if err != nil {
 		return fmt.Errorf("get /proc/meminfo stats failed: %s", err)
@@ -2,6 +2,7 @@ package collector
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/filter"
@@ -46,7 +47,7 @@ func NewNetdevCollector(labels prometheus.Labels) (Collector, error) {
 }
 
 // Update method collects network interfaces statistics
-func (c *netdevCollector) Update(config Config, ch chan<- prometheus.Metric) error {
+func (c *netdevCollector) Update(_ context.Context, config Config, ch chan<- prometheus.Metric) error {
 	stats, err := getNetdevStats(config.Filters["netdev/device"])
 	if err != nil {
 		return fmt.Errorf("get /proc/net/dev stats failed: %s", err)
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
@@ -32,7 +33,7 @@ func NewNetworkCollector(labels prometheus.Labels) (Collector, error) {
 	}, nil
 }
 
-func (c *networkCollector) Update(_ Config, ch chan<- prometheus.Metric) error {
+func (c *networkCollector) Update(_ context.Context, _ Config, ch chan<- prometheus.Metric) error {
 	addresses, err := net.InterfaceAddrs()
 	if err != nil {
 		return err
@@ -3,6 +3,7 @@ package collector
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
@@ -96,7 +97,7 @@ func NewSysconfigCollector(labels prometheus.Labels) (Collector, error) {
 }
 
 // Update method collects filesystem usage statistics.
-func (c *systemCollector) Update(_ Config, ch chan<- prometheus.Metric) error {
+func (c *systemCollector) Update(_ context.Context, _ Config, ch chan<- prometheus.Metric) error {
 	sysctls := readSysctls(c.sysctlList)
 
 	for name, value := range sysctls {
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
 	"github.com/weaponry/pgscv/internal/model"
@@ -47,14 +48,14 @@ func NewPgbouncerPoolsCollector(constLabels prometheus.Labels) (Collector, error
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *pgbouncerPoolsCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *pgbouncerPoolsCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	res, err := conn.Query(poolQuery)
+	res, err := conn.QueryContext(ctx, poolQuery)
 	if err != nil {
 		return err
 	}
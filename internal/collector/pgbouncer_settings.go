@@ -2,6 +2,7 @@ package collector
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
@@ -56,14 +57,14 @@ func NewPgbouncerSettingsCollector(constLabels prometheus.Labels) (Collector, er
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *pgbouncerSettingsCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *pgbouncerSettingsCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	res, err := conn.Query(settingsQuery)
+	res, err := conn.QueryContext(ctx, settingsQuery)
 	if err != nil {
 		return err
 	}
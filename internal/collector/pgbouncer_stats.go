@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
 	"github.com/weaponry/pgscv/internal/model"
@@ -57,14 +58,14 @@ func NewPgbouncerStatsCollector(constLabels prometheus.Labels) (Collector, error
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *pgbouncerStatsCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *pgbouncerStatsCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	res, err := conn.Query(pgbouncerStatsQuery)
+	res, err := conn.QueryContext(ctx, pgbouncerStatsQuery)
 	if err != nil {
 		return err
 	}
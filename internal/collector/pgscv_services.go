@@ -1,6 +1,9 @@
 package collector
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+)
 
 // pgscvServicesCollector defines metrics about discovered and monitored services.
 type pgscvServicesCollector struct {
@@ -20,7 +23,7 @@ func NewPgscvServicesCollector(labels prometheus.Labels) (Collector, error) {
 }
 
 // Update method is used for sending pgscvServicesCollector's metrics.
-func (c *pgscvServicesCollector) Update(config Config, ch chan<- prometheus.Metric) error {
+func (c *pgscvServicesCollector) Update(_ context.Context, config Config, ch chan<- prometheus.Metric) error {
 	ch <- c.service.mustNewConstMetric(1, config.ServiceType)
 
 	return nil
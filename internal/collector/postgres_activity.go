@@ -2,6 +2,7 @@ package collector
 
 import (
 	"context"
+	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
 	"github.com/weaponry/pgscv/internal/model"
@@ -113,15 +114,15 @@ func NewPostgresActivityCollector(constLabels prometheus.Labels) (Collector, err
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *postgresActivityCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *postgresActivityCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
 	// get pg_stat_activity stats
-	res, err := conn.Query(selectActivityQuery(config.ServerVersionNum))
+	res, err := conn.QueryContext(ctx, selectActivityQuery(config.ServerVersionNum))
 	if err != nil {
 		return err
 	}
@@ -129,11 +130,12 @@ func (c *postgresActivityCollector) Update(config Config, ch chan<- prometheus.M
 	// parse pg_stat_activity stats
 	stats := parsePostgresActivityStats(res, c.re)
 
-	// get pg_prepared_xacts stats
+	// get pg_prepared_xacts stats, failure is reported after activity stats are sent.
 	var count int
-	err = conn.Conn().QueryRow(context.Background(), postgresPreparedXactQuery).Scan(&count)
+	var preparedErr error
+	err = conn.Conn().QueryRow(ctx, postgresPreparedXactQuery).Scan(&count)
 	if err != nil {
-		log.Warnf("query pg_prepared_xacts failed: %s; skip", err)
+		preparedErr = fmt.Errorf("query pg_prepared_xacts failed: %w", err)
 	} else {
 		stats.prepared = float64(count)
 	}
@@ -231,7 +233,7 @@ func (c *postgresActivityCollector) Update(config Config, ch chan<- prometheus.M
 		ch <- c.vacuums.mustNewConstMetric(v, k)
 	}
 
-	return nil
+	return preparedErr
 }
 
 // queryRegexp used for keeping regexps for query classification.
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
 	"github.com/weaponry/pgscv/internal/model"
@@ -87,14 +88,14 @@ func NewPostgresBgwriterCollector(constLabels prometheus.Labels) (Collector, err
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *postgresBgwriterCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *postgresBgwriterCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	res, err := conn.Query(postgresBgwriterQuery)
+	res, err := conn.QueryContext(ctx, postgresBgwriterQuery)
 	if err != nil {
 		return err
 	}
@@ -87,9 +87,9 @@ func parsePostgresGenericStats(r *model.PGResult, labelNames []string) map[strin
 }
 
 // listDatabases returns slice with databases names
-func listDatabases(db *store.DB) ([]string, error) {
+func listDatabases(ctx context.Context, db *store.DB) ([]string, error) {
 	// getDBList returns the list of databases that allowed for connection
-	rows, err := db.Conn().Query(context.Background(), "SELECT datname FROM pg_database WHERE NOT datistemplate AND datallowconn")
+	rows, err := db.Conn().Query(ctx, "SELECT datname FROM pg_database WHERE NOT datistemplate AND datallowconn")
 	if err != nil {
 		return nil, err
 	}
@@ -107,12 +107,12 @@ func listDatabases(db *store.DB) ([]string, error) {
 }
 
 // isExtensionAvailable returns true if extension with specified name exists and available
-func isExtensionAvailable(db *store.DB, name string) bool {
+func isExtensionAvailable(ctx context.Context, db *store.DB, name string) bool {
 	log.Debugf("check %s availability", name)
 
 	var exists bool
 	err := db.Conn().
-		QueryRow(context.Background(), "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = $1)", name).
+		QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM pg_extension WHERE extname = $1)", name).
 		Scan(&exists)
 	if err != nil {
 		log.Errorln("failed to check extensions in pg_extension: ", err)
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"database/sql"
 	"github.com/jackc/pgproto3/v2"
 	"github.com/stretchr/testify/assert"
@@ -59,7 +60,7 @@ func Test_parsePostgresGenericStats(t *testing.T) {
 func Test_listDatabases(t *testing.T) {
 	conn := store.NewTest(t)
 
-	databases, err := listDatabases(conn)
+	databases, err := listDatabases(context.Background(), conn)
 	assert.NoError(t, err)
 	assert.Greater(t, len(databases), 0)
 	conn.Close()
@@ -68,7 +69,7 @@ func Test_listDatabases(t *testing.T) {
 func Test_isExtensionAvailable(t *testing.T) {
 	conn := store.NewTest(t)
 
-	assert.True(t, isExtensionAvailable(conn, "plpgsql"))
-	assert.False(t, isExtensionAvailable(conn, "invalid"))
+	assert.True(t, isExtensionAvailable(context.Background(), conn, "plpgsql"))
+	assert.False(t, isExtensionAvailable(context.Background(), conn, "invalid"))
 	conn.Close()
 }
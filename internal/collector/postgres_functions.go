@@ -1,6 +1,8 @@
 package collector
 
 import (
+	"context"
+	"fmt"
 	"github.com/jackc/pgx/v4"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
@@ -51,13 +53,13 @@ func NewPostgresFunctionsCollector(constLabels prometheus.Labels) (Collector, er
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *postgresFunctionsCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *postgresFunctionsCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 
-	databases, err := listDatabases(conn)
+	databases, err := listDatabases(ctx, conn)
 	if err != nil {
 		return err
 	}
@@ -69,17 +71,19 @@ func (c *postgresFunctionsCollector) Update(config Config, ch chan<- prometheus.
 		return err
 	}
 
+	// Failures of particular databases don't stop collecting, they are reported when all databases are walked through.
+	var errs []error
 	for _, d := range databases {
 		pgconfig.Database = d
-		conn, err := store.NewWithConfig(pgconfig)
+		conn, err := store.NewWithConfigContext(ctx, pgconfig)
 		if err != nil {
 			return err
 		}
 
-		res, err := conn.Query(postgresFunctionsQuery)
+		res, err := conn.QueryContext(ctx, postgresFunctionsQuery)
 		conn.Close()
 		if err != nil {
-			log.Warnf("get functions stat of database %s failed: %s", d, err)
+			errs = append(errs, fmt.Errorf("get functions stat of database %s failed: %w", d, err))
 			continue
 		}
 
@@ -92,7 +96,7 @@ func (c *postgresFunctionsCollector) Update(config Config, ch chan<- prometheus.
 		}
 	}
 
-	return nil
+	return firstError(errs)
 }
 
 // postgresFunctionStat represents Postgres function stats based pg_stat_user_functions.
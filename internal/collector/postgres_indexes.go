@@ -1,6 +1,8 @@
 package collector
 
 import (
+	"context"
+	"fmt"
 	"github.com/jackc/pgx/v4"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
@@ -73,13 +75,13 @@ func NewPostgresIndexesCollector(constLabels prometheus.Labels) (Collector, erro
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *postgresIndexesCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *postgresIndexesCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 
-	databases, err := listDatabases(conn)
+	databases, err := listDatabases(ctx, conn)
 	if err != nil {
 		return err
 	}
@@ -91,17 +93,19 @@ func (c *postgresIndexesCollector) Update(config Config, ch chan<- prometheus.Me
 		return err
 	}
 
+	// Failures of particular databases don't stop collecting, they are reported when all databases are walked through.
+	var errs []error
 	for _, d := range databases {
 		pgconfig.Database = d
-		conn, err := store.NewWithConfig(pgconfig)
+		conn, err := store.NewWithConfigContext(ctx, pgconfig)
 		if err != nil {
 			return err
 		}
 
-		res, err := conn.Query(userIndexesQuery)
+		res, err := conn.QueryContext(ctx, userIndexesQuery)
 		conn.Close()
 		if err != nil {
-			log.Warnf("get indexes stat of database %s failed: %s", d, err)
+			errs = append(errs, fmt.Errorf("get indexes stat of database %s failed: %w", d, err))
 			continue
 		}
 
@@ -128,7 +132,7 @@ func (c *postgresIndexesCollector) Update(config Config, ch chan<- prometheus.Me
 		}
 	}
 
-	return nil
+	return firstError(errs)
 }
 
 // postgresIndexStat is per-index store for metrics related to how indexes are accessed.
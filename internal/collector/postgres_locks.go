@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
 	"github.com/weaponry/pgscv/internal/model"
@@ -31,15 +32,15 @@ func NewPostgresLocksCollector(constLabels prometheus.Labels) (Collector, error)
 }
 
 // Update method collects locks metrics.
-func (c *postgresLocksCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *postgresLocksCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
 	// get pg_stat_activity stats
-	res, err := conn.Query(postgresLocksQuery)
+	res, err := conn.QueryContext(ctx, postgresLocksQuery)
 	if err != nil {
 		return err
 	}
@@ -22,13 +22,15 @@ type syncKV struct {
 }
 
 type postgresLogsCollector struct {
-	updateLogfile   chan string // updateLogfile used for notify tail/collect goroutine when logfile has been changed.
-	currentLogfile  string      // currentLogfile contains logfile name currently tailed and used for collecting stat.
-	totals          syncKV      // totals contains collected stats about total number of log messages.
-	panics          syncKV      // panics contains all collected messages with PANIC severity.
-	fatals          syncKV      // fatals contains all collected messages with FATAL severity.
-	errors          syncKV      // errors contains all collected messages with ERROR severity.
-	warnings        syncKV      // warnings contains all collected messages with WARNING severity.
+	updateLogfile   chan string   // updateLogfile used for notify tail/collect goroutine when logfile has been changed.
+	done            chan struct{} // done is closed when collector is closed and tail/collect goroutine should stop.
+	closeOnce       sync.Once     // closeOnce protects done from closing twice.
+	currentLogfile  string        // currentLogfile contains logfile name currently tailed and used for collecting stat.
+	totals          syncKV        // totals contains collected stats about total number of log messages.
+	panics          syncKV        // panics contains all collected messages with PANIC severity.
+	fatals          syncKV        // fatals contains all collected messages with FATAL severity.
+	errors          syncKV        // errors contains all collected messages with ERROR severity.
+	warnings        syncKV        // warnings contains all collected messages with WARNING severity.
 	messagesTotal   typedDesc
 	panicMessages   typedDesc
 	fatalMessages   typedDesc
@@ -40,6 +42,7 @@ type postgresLogsCollector struct {
 func NewPostgresLogsCollector(constLabels prometheus.Labels) (Collector, error) {
 	collector := &postgresLogsCollector{
 		updateLogfile: make(chan string),
+		done:          make(chan struct{}),
 		totals: syncKV{
 			store: map[string]float64{
 				"log":     0,
@@ -109,7 +112,7 @@ func NewPostgresLogsCollector(constLabels prometheus.Labels) (Collector, error)
 }
 
 // Update method generates metrics based on collected log messages.
-func (c *postgresLogsCollector) Update(config Config, ch chan<- prometheus.Metric) error {
+func (c *postgresLogsCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
 	if !config.LoggingCollector {
 		return nil
 	}
@@ -120,14 +123,20 @@ func (c *postgresLogsCollector) Update(config Config, ch chan<- prometheus.Metri
 	}
 
 	// Notify log collector goroutine if logfile has been changed.
-	logfile, err := queryCurrentLogfile(config.ConnString)
+	logfile, err := queryCurrentLogfile(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 
 	if logfile != c.currentLogfile {
-		c.currentLogfile = logfile
-		c.updateLogfile <- logfile
+		select {
+		case c.updateLogfile <- logfile:
+			c.currentLogfile = logfile
+		case <-c.done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
 	}
 
 	// Read collected stats and create metrics.
@@ -170,34 +179,51 @@ func (c *postgresLogsCollector) Update(config Config, ch chan<- prometheus.Metri
 	return nil
 }
 
-// runTailLoop accepts logfile names over channel and run tail/collect functions.
+// Close stops tailing of logfile.
+func (c *postgresLogsCollector) Close() {
+	c.closeOnce.Do(func() { close(c.done) })
+}
+
+// runTailLoop accepts logfile names over channel and run tail/collect functions until collector is closed.
 func runTailLoop(c *postgresLogsCollector) {
 	var ctx context.Context
 	var cancel context.CancelFunc
 	var wg sync.WaitGroup
 
+	var logfile string
+	select {
+	case logfile = <-c.updateLogfile:
+	case <-c.done:
+		return
+	}
+
 	// Run initial tail, it reads logfile from the end.
 	ctx, cancel = context.WithCancel(context.Background())
-	logfile := <-c.updateLogfile
 	wg.Add(1)
 	go func() {
 		tailCollect(ctx, logfile, true, &wg, c)
 	}()
 
 	// Polling logfile changes. When it change, stop initial tail and start tail a new one.
-	for logfile := range c.updateLogfile {
-		log.Infoln("logfile changed, stopping current tailing")
-		cancel()
-		wg.Wait()
-		ctx, cancel = context.WithCancel(context.Background())
-
-		wg.Add(1)
-		go func(logfile string) {
-			tailCollect(ctx, logfile, false, &wg, c)
-		}(logfile)
+	for {
+		select {
+		case logfile := <-c.updateLogfile:
+			log.Infoln("logfile changed, stopping current tailing")
+			cancel()
+			wg.Wait()
+			ctx, cancel = context.WithCancel(context.Background())
+
+			wg.Add(1)
+			go func(logfile string) {
+				tailCollect(ctx, logfile, false, &wg, c)
+			}(logfile)
+		case <-c.done:
+			log.Infoln("logs collector closed, stopping current tailing")
+			cancel()
+			wg.Wait()
+			return
+		}
 	}
-
-	cancel()
 }
 
 // tailCollect accepts logfile and tail it. Collected stats are based on received and parsed lines.
@@ -237,14 +263,14 @@ func tailCollect(ctx context.Context, logfile string, init bool, wg *sync.WaitGr
 }
 
 // queryCurrentLogfile returns path to logfile used by database.
-func queryCurrentLogfile(conninfo string) (string, error) {
-	conn, err := store.New(conninfo)
+func queryCurrentLogfile(ctx context.Context, conninfo string) (string, error) {
+	conn, err := store.NewContext(ctx, conninfo)
 	if err != nil {
 		return "", err
 	}
 
 	var logfile string
-	err = conn.Conn().QueryRow(context.TODO(), "SELECT pg_current_logfile()").Scan(&logfile)
+	err = conn.Conn().QueryRow(ctx, "SELECT pg_current_logfile()").Scan(&logfile)
 	if err != nil {
 		return "", err
 	}
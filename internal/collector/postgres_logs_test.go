@@ -4,6 +4,7 @@ import (
 	"bufio"
 	"context"
 	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/weaponry/pgscv/internal/store"
 	"os"
@@ -12,6 +13,32 @@ import (
 	"time"
 )
 
+func TestPostgresLogsCollector_Close(t *testing.T) {
+	c, err := NewPostgresLogsCollector(nil)
+	assert.NoError(t, err)
+	lc := c.(*postgresLogsCollector)
+
+	lc.Close()
+	lc.Close() // closing twice should not panic
+
+	// Closed collector should not wait for tail loop.
+	config := Config{ConnString: store.TestPostgresConnStr}
+	config.LoggingCollector = true
+	config.ServerVersionNum = PostgresV10
+	ch := make(chan prometheus.Metric, 100)
+	done := make(chan struct{})
+	go func() {
+		_ = lc.Update(context.Background(), config, ch)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "update of closed collector hangs")
+	}
+}
+
 func Test_runTailLoop(t *testing.T) {
 	c, err := NewPostgresLogsCollector(nil)
 	assert.NoError(t, err)
@@ -139,11 +166,11 @@ func Test_tailCollect(t *testing.T) {
 }
 
 func Test_queryCurrentLogfile(t *testing.T) {
-	got, err := queryCurrentLogfile(store.TestPostgresConnStr)
+	got, err := queryCurrentLogfile(context.Background(), store.TestPostgresConnStr)
 	assert.NoError(t, err)
 	assert.NotEqual(t, got, "")
 
-	got, err = queryCurrentLogfile("host=127.0.0.1 port=1 user=invalid dbname=invalid")
+	got, err = queryCurrentLogfile(context.Background(), "host=127.0.0.1 port=1 user=invalid dbname=invalid")
 	assert.Error(t, err)
 	assert.Equal(t, got, "")
 }
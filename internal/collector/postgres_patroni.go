@@ -0,0 +1,114 @@
+package collector
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/patroni"
+	"sync/atomic"
+)
+
+type postgresPatroniCollector struct {
+	info           typedDesc
+	timeline       typedDesc
+	pendingRestart typedDesc
+	paused         typedDesc
+	lag            typedDesc
+	// changed is set when labels of the member differ from labels the service was set up with.
+	changed int32
+}
+
+// NewPostgresPatroniCollector returns a new Collector exposing state of the Patroni member which manages Postgres.
+// For details see https://patroni.readthedocs.io/en/latest/rest_api.html
+func NewPostgresPatroniCollector(constLabels prometheus.Labels) (Collector, error) {
+	return &postgresPatroniCollector{
+		info: typedDesc{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName("patroni", "", "info"),
+				"Labeled information about Patroni member.",
+				[]string{"version", "state"}, constLabels,
+			), valueType: prometheus.GaugeValue,
+		},
+		timeline: typedDesc{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName("patroni", "", "timeline"),
+				"Current timeline of Postgres managed by Patroni.",
+				nil, constLabels,
+			), valueType: prometheus.GaugeValue,
+		},
+		pendingRestart: typedDesc{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName("patroni", "", "pending_restart"),
+				"Value is 1 if Postgres should be restarted to apply changed settings, 0 otherwise.",
+				nil, constLabels,
+			), valueType: prometheus.GaugeValue,
+		},
+		paused: typedDesc{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName("patroni", "cluster", "paused"),
+				"Value is 1 if the cluster is in maintenance mode, 0 otherwise.",
+				nil, constLabels,
+			), valueType: prometheus.GaugeValue,
+		},
+		lag: typedDesc{
+			desc: prometheus.NewDesc(
+				prometheus.BuildFQName("patroni", "replication", "lag_bytes"),
+				"Replication lag of the member behind the leader, in bytes.",
+				nil, constLabels,
+			), valueType: prometheus.GaugeValue,
+		},
+	}, nil
+}
+
+// Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
+func (c *postgresPatroniCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	if config.PatroniURL == "" {
+		log.Debugln("[postgres patroni collector]: Patroni URL is not specified, skip")
+		return nil
+	}
+
+	client := patroni.NewClient(config.PatroniURL)
+
+	status, err := client.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	cluster, err := client.Cluster(ctx)
+	if err != nil {
+		return err
+	}
+
+	ch <- c.info.mustNewConstMetric(1, status.Patroni.Version, status.State)
+	ch <- c.timeline.mustNewConstMetric(float64(status.Timeline))
+	ch <- c.pendingRestart.mustNewConstMetric(boolToFloat(status.PendingRestart))
+	ch <- c.paused.mustNewConstMetric(boolToFloat(status.Pause || cluster.Pause))
+
+	if m, ok := cluster.Member(status.Patroni.Name); ok {
+		if lag, ok := m.LagBytes(); ok {
+			ch <- c.lag.mustNewConstMetric(lag)
+		}
+	}
+
+	// Role of the member changes after switchover or failover, metrics of the service should be re-labeled.
+	labels := patroni.NewLabels(status, cluster)
+	if !labelsEqual(labels, config.PatroniLabels) {
+		log.Infof("[postgres patroni collector]: member labels changed from %v to %v", config.PatroniLabels, labels)
+		atomic.StoreInt32(&c.changed, 1)
+	}
+
+	return nil
+}
+
+// labelsChanged returns true if labels of the member differ from labels the service was set up with.
+func (c *postgresPatroniCollector) labelsChanged() bool {
+	return atomic.LoadInt32(&c.changed) == 1
+}
+
+// boolToFloat converts boolean value to 1 or 0.
+func boolToFloat(v bool) float64 {
+	if v {
+		return 1
+	}
+	return 0
+}
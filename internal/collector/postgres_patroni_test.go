@@ -0,0 +1,78 @@
+package collector
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/patroni"
+	"regexp"
+	"testing"
+)
+
+func TestPostgresPatroniCollector_Update(t *testing.T) {
+	srv := patroni.NewTestServer(patroni.TestLeaderStatus, patroni.TestCluster)
+	defer srv.Close()
+
+	c, err := NewPostgresPatroniCollector(prometheus.Labels{"cluster": "demo", "member": "node1", "role": "leader"})
+	assert.NoError(t, err)
+
+	config := Config{PatroniURL: srv.URL, PatroniLabels: map[string]string{"cluster": "demo", "member": "node1", "role": "leader"}}
+
+	names := collectPatroniMetrics(t, c, config)
+	assert.Equal(t, []string{"patroni_info", "patroni_timeline", "patroni_pending_restart", "patroni_cluster_paused"}, names)
+	assert.False(t, c.(*postgresPatroniCollector).labelsChanged())
+
+	// Switchover, member becomes replica.
+	srv.Set(patroni.TestReplicaStatus, patroni.TestClusterSwitched)
+	names = collectPatroniMetrics(t, c, config)
+	assert.Equal(t, []string{"patroni_info", "patroni_timeline", "patroni_pending_restart", "patroni_cluster_paused", "patroni_replication_lag_bytes"}, names)
+	assert.True(t, c.(*postgresPatroniCollector).labelsChanged())
+
+	// Patroni URL is not specified.
+	names = collectPatroniMetrics(t, c, Config{})
+	assert.Len(t, names, 0)
+
+	// Patroni is not available.
+	assert.Error(t, c.Update(context.Background(), Config{PatroniURL: "http://127.0.0.1:1"}, make(chan prometheus.Metric, 10)))
+}
+
+// collectPatroniMetrics runs the collector and returns names of collected metrics.
+func collectPatroniMetrics(t *testing.T, c Collector, config Config) []string {
+	ch := make(chan prometheus.Metric, 10)
+	assert.NoError(t, c.Update(context.Background(), config, ch))
+	close(ch)
+
+	re := regexp.MustCompile(`fqName: "([a-zA-Z0-9_]+)"`)
+	var names []string
+	for m := range ch {
+		names = append(names, re.FindStringSubmatch(m.Desc().String())[1])
+	}
+
+	return names
+}
+
+func TestPgscvCollector_CollectContext_labelsChange(t *testing.T) {
+	srv := patroni.NewTestServer(patroni.TestReplicaStatus, patroni.TestClusterSwitched)
+	defer srv.Close()
+
+	var called int
+	config := Config{
+		PatroniURL:     srv.URL,
+		PatroniLabels:  map[string]string{"cluster": "demo", "member": "node1", "role": "leader"},
+		OnLabelsChange: func() { called++ },
+	}
+
+	factories := Factories{"postgres/patroni": NewPostgresPatroniCollector}
+	mc, err := NewPgscvCollector("postgres:5432", factories, config)
+	assert.NoError(t, err)
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		mc.CollectContext(context.Background(), ch)
+		close(ch)
+	}()
+	for range ch {
+	}
+
+	assert.Equal(t, 1, called)
+}
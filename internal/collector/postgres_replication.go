@@ -2,6 +2,7 @@ package collector
 
 import (
 	"context"
+	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
 	"github.com/weaponry/pgscv/internal/model"
@@ -103,26 +104,27 @@ func NewPostgresReplicationCollector(constLabels prometheus.Labels) (Collector,
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *postgresReplicationCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *postgresReplicationCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	// Get recovery state.
+	// Get recovery state, failure is reported after replication stats are sent.
 	var recovery int
 	var walBytes int64
-	err = conn.Conn().QueryRow(context.TODO(), selectWalQuery(config.ServerVersionNum)).Scan(&recovery, &walBytes)
+	var recoveryErr error
+	err = conn.Conn().QueryRow(ctx, selectWalQuery(config.ServerVersionNum)).Scan(&recovery, &walBytes)
 	if err != nil {
-		log.Warnf("get recovery state failed: %s; skip", err)
+		recoveryErr = fmt.Errorf("get recovery state failed: %w", err)
 	} else {
 		ch <- c.recovery.mustNewConstMetric(float64(recovery))
 		ch <- c.wal.mustNewConstMetric(float64(walBytes))
 	}
 
 	// Get replication stats.
-	res, err := conn.Query(selectReplicationQuery(config.ServerVersionNum))
+	res, err := conn.QueryContext(ctx, selectReplicationQuery(config.ServerVersionNum))
 	if err != nil {
 		return err
 	}
@@ -160,7 +162,7 @@ func (c *postgresReplicationCollector) Update(config Config, ch chan<- prometheu
 		}
 	}
 
-	return nil
+	return recoveryErr
 }
 
 // postgresReplicationStat represents per-replica stats based on pg_stat_replication.
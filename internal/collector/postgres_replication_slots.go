@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
 	"github.com/weaponry/pgscv/internal/model"
@@ -41,14 +42,14 @@ func NewPostgresReplicationSlotsCollector(constLabels prometheus.Labels) (Collec
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *postgresReplicationSlotCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *postgresReplicationSlotCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 	defer conn.Close()
 
-	res, err := conn.Query(selectReplicationSlotQuery(config.ServerVersionNum))
+	res, err := conn.QueryContext(ctx, selectReplicationSlotQuery(config.ServerVersionNum))
 	if err != nil {
 		return err
 	}
@@ -1,11 +1,12 @@
 package collector
 
 import (
+	"context"
+	"fmt"
 	"github.com/jackc/pgx/v4"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
 	"github.com/weaponry/pgscv/internal/store"
-	"golang.org/x/net/context"
 	"strings"
 )
 
@@ -84,13 +85,13 @@ func NewPostgresSchemasCollector(constLabels prometheus.Labels) (Collector, erro
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *postgresSchemaCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *postgresSchemaCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 
-	databases, err := listDatabases(conn)
+	databases, err := listDatabases(ctx, conn)
 	if err != nil {
 		return err
 	}
@@ -102,35 +103,38 @@ func (c *postgresSchemaCollector) Update(config Config, ch chan<- prometheus.Met
 		return err
 	}
 
+	// Failures of particular queries don't stop collecting, they are reported when all databases are walked through.
+	var errs []error
+
 	// walk through all databases, connect to it and collect schema-specific stats
 	for _, d := range databases {
 		pgconfig.Database = d
-		conn, err := store.NewWithConfig(pgconfig)
+		conn, err := store.NewWithConfigContext(ctx, pgconfig)
 		if err != nil {
 			return err
 		}
 
 		// 1. get system catalog size in bytes.
-		collectSystemCatalogSize(conn, ch, c.syscatalog)
+		errs = append(errs, collectSystemCatalogSize(ctx, conn, ch, c.syscatalog))
 
 		// 2. collect metrics related to tables with no primary/unique key constraints.
-		collectSchemaNonPKTables(conn, ch, c.nonpktables)
+		errs = append(errs, collectSchemaNonPKTables(ctx, conn, ch, c.nonpktables))
 
 		// Functions below uses queries with casting to regnamespace data type, which is introduced in Postgres 9.5.
 		if config.ServerVersionNum >= PostgresV95 {
 			log.Debugln("[postgres schema collector]: some system data types are not available, required Postgres 9.5 or newer")
 
 			// 3. collect metrics related to invalid indexes.
-			collectSchemaInvalidIndexes(conn, ch, c.invalididx)
+			errs = append(errs, collectSchemaInvalidIndexes(ctx, conn, ch, c.invalididx))
 
 			// 4. collect metrics related to non indexed foreign key constraints.
-			collectSchemaNonIndexedFK(conn, ch, c.nonidxfkey)
+			errs = append(errs, collectSchemaNonIndexedFK(ctx, conn, ch, c.nonidxfkey))
 
 			// 5. collect metric related to redundant indexes.
-			collectSchemaRedundantIndexes(conn, ch, c.redundantidx)
+			errs = append(errs, collectSchemaRedundantIndexes(ctx, conn, ch, c.redundantidx))
 
 			// 6. collect metrics related to foreign key constraints with different data types.
-			collectSchemaFKDatatypeMismatch(conn, ch, c.difftypefkey)
+			errs = append(errs, collectSchemaFKDatatypeMismatch(ctx, conn, ch, c.difftypefkey))
 		}
 
 		// Function below uses queries pg_sequences which is introduced in Postgres 10.
@@ -138,46 +142,46 @@ func (c *postgresSchemaCollector) Update(config Config, ch chan<- prometheus.Met
 			log.Debugln("[postgres schema collector]: some system views are not available, required Postgres 10 or newer")
 
 			// 7. collect metrics related to sequences (available since Postgres 10).
-			collectSchemaSequences(conn, ch, c.sequences)
+			errs = append(errs, collectSchemaSequences(ctx, conn, ch, c.sequences))
 		}
 
 		conn.Close()
 	}
 
-	return nil
+	return firstError(errs)
 }
 
 // collectSystemCatalogSize collects system catalog size metrics.
-func collectSystemCatalogSize(conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) {
+func collectSystemCatalogSize(ctx context.Context, conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) error {
 	datname := conn.Conn().Config().Database
-	size, err := getSystemCatalogSize(conn)
+	size, err := getSystemCatalogSize(ctx, conn)
 	if err != nil {
-		log.Errorf("get system catalog size of database %s failed: %s; skip", datname, err)
-		return
+		return fmt.Errorf("get system catalog size of database %s failed: %w", datname, err)
 	}
 
 	if size > 0 {
 		ch <- desc.mustNewConstMetric(size, datname)
 	}
+
+	return nil
 }
 
 // getSystemCatalogSize returns size of system catalog in bytes.
-func getSystemCatalogSize(conn *store.DB) (float64, error) {
+func getSystemCatalogSize(ctx context.Context, conn *store.DB) (float64, error) {
 	var query = `SELECT sum(pg_total_relation_size(relname::regclass)) AS bytes FROM pg_stat_sys_tables WHERE schemaname = 'pg_catalog'`
 	var size int64 = 0
-	if err := conn.Conn().QueryRow(context.Background(), query).Scan(&size); err != nil {
+	if err := conn.Conn().QueryRow(ctx, query).Scan(&size); err != nil {
 		return 0, err
 	}
 	return float64(size), nil
 }
 
 // collectSchemaNonPKTables collects metrics related to non-PK tables.
-func collectSchemaNonPKTables(conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) {
+func collectSchemaNonPKTables(ctx context.Context, conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) error {
 	datname := conn.Conn().Config().Database
-	tables, err := getSchemaNonPKTables(conn)
+	tables, err := getSchemaNonPKTables(ctx, conn)
 	if err != nil {
-		log.Errorf("collect non-pk tables in database %s failed: %s; skip", datname, err)
-		return
+		return fmt.Errorf("collect non-pk tables in database %s failed: %w", datname, err)
 	}
 
 	for _, t := range tables {
@@ -189,16 +193,18 @@ func collectSchemaNonPKTables(conn *store.DB, ch chan<- prometheus.Metric, desc
 		}
 		ch <- desc.mustNewConstMetric(1, datname, parts[0], parts[1])
 	}
+
+	return nil
 }
 
 // getSchemaNonPKTables searches tables with no PRIMARY or UNIQUE keys in the database and return its names.
-func getSchemaNonPKTables(conn *store.DB) ([]string, error) {
+func getSchemaNonPKTables(ctx context.Context, conn *store.DB) ([]string, error) {
 	var query = "SELECT n.nspname AS schemaname, c.relname AS relname " +
 		"FROM pg_class c JOIN pg_namespace n ON c.relnamespace = n.oid " +
 		"WHERE NOT EXISTS (SELECT 1 FROM pg_index i WHERE c.oid = i.indrelid AND (i.indisprimary OR i.indisunique)) " +
 		"AND c.relkind = 'r' AND n.nspname NOT IN ('pg_catalog', 'information_schema', 'pg_toast')"
 
-	rows, err := conn.Conn().Query(context.Background(), query)
+	rows, err := conn.Conn().Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -223,12 +229,11 @@ func getSchemaNonPKTables(conn *store.DB) ([]string, error) {
 }
 
 // collectSchemaInvalidIndexes collects metrics related to invalid indexes.
-func collectSchemaInvalidIndexes(conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) {
+func collectSchemaInvalidIndexes(ctx context.Context, conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) error {
 	datname := conn.Conn().Config().Database
-	stats, err := getSchemaInvalidIndexes(conn)
+	stats, err := getSchemaInvalidIndexes(ctx, conn)
 	if err != nil {
-		log.Errorf("get invalid indexes stats of database %s failed: %s; skip", datname, err)
-		return
+		return fmt.Errorf("get invalid indexes stats of database %s failed: %w", datname, err)
 	}
 
 	for k, s := range stats {
@@ -246,14 +251,16 @@ func collectSchemaInvalidIndexes(conn *store.DB, ch chan<- prometheus.Metric, de
 
 		ch <- desc.mustNewConstMetric(value, datname, schemaname, relname, indexrelname)
 	}
+
+	return nil
 }
 
 // getSchemaInvalidIndexes searches invalid indexes in the database and return its names if such indexes have been found.
-func getSchemaInvalidIndexes(conn *store.DB) (map[string]postgresGenericStat, error) {
+func getSchemaInvalidIndexes(ctx context.Context, conn *store.DB) (map[string]postgresGenericStat, error) {
 	var query = "SELECT c1.relnamespace::regnamespace::text AS schemaname, c2.relname AS relname, c1.relname AS indexrelname, " +
 		"pg_relation_size(c1.relname::regclass) AS bytes " +
 		"FROM pg_index i JOIN pg_class c1 ON i.indexrelid = c1.oid JOIN pg_class c2 ON i.indrelid = c2.oid WHERE NOT i.indisvalid"
-	res, err := conn.Query(query)
+	res, err := conn.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -262,12 +269,11 @@ func getSchemaInvalidIndexes(conn *store.DB) (map[string]postgresGenericStat, er
 }
 
 // collectSchemaNonIndexedFK collects metrics related to non indexed foreign key constraints.
-func collectSchemaNonIndexedFK(conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) {
+func collectSchemaNonIndexedFK(ctx context.Context, conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) error {
 	datname := conn.Conn().Config().Database
-	stats, err := getSchemaNonIndexedFK(conn)
+	stats, err := getSchemaNonIndexedFK(ctx, conn)
 	if err != nil {
-		log.Errorf("get non-indexed fkeys stats of database %s failed: %s; skip", datname, err)
-		return
+		return fmt.Errorf("get non-indexed fkeys stats of database %s failed: %w", datname, err)
 	}
 
 	for k, s := range stats {
@@ -286,10 +292,12 @@ func collectSchemaNonIndexedFK(conn *store.DB, ch chan<- prometheus.Metric, desc
 
 		ch <- desc.mustNewConstMetric(1, datname, schemaname, relname, colnames, constraint, referenced)
 	}
+
+	return nil
 }
 
 // getSchemaNonIndexedFK searches non indexes foreign key constraints and return its names.
-func getSchemaNonIndexedFK(conn *store.DB) (map[string]postgresGenericStat, error) {
+func getSchemaNonIndexedFK(ctx context.Context, conn *store.DB) (map[string]postgresGenericStat, error) {
 	var query = "SELECT c.connamespace::regnamespace::text AS schemaname, s.relname AS relname, " +
 		"string_agg(a.attname, ',' ORDER BY x.n) AS colnames, c.conname AS constraint, " +
 		"c.confrelid::regclass::text AS referenced " +
@@ -300,7 +308,7 @@ func getSchemaNonIndexedFK(conn *store.DB) (map[string]postgresGenericStat, erro
 		"AND c.contype = 'f' " +
 		"GROUP BY c.connamespace,s.relname,c.conname,c.confrelid"
 
-	res, err := conn.Query(query)
+	res, err := conn.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -309,12 +317,11 @@ func getSchemaNonIndexedFK(conn *store.DB) (map[string]postgresGenericStat, erro
 }
 
 // collectSchemaRedundantIndexes collects metrics related to invalid indexes
-func collectSchemaRedundantIndexes(conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) {
+func collectSchemaRedundantIndexes(ctx context.Context, conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) error {
 	datname := conn.Conn().Config().Database
-	stats, err := getSchemaRedundantIndexes(conn)
+	stats, err := getSchemaRedundantIndexes(ctx, conn)
 	if err != nil {
-		log.Errorf("get redundant indexes stats of database %s failed: %s; skip", datname, err)
-		return
+		return fmt.Errorf("get redundant indexes stats of database %s failed: %w", datname, err)
 	}
 
 	for k, s := range stats {
@@ -334,10 +341,12 @@ func collectSchemaRedundantIndexes(conn *store.DB, ch chan<- prometheus.Metric,
 
 		ch <- desc.mustNewConstMetric(value, datname, schemaname, relname, indexrelname, indexdef, redundantdef)
 	}
+
+	return nil
 }
 
 // getSchemaRedundantIndexes searches redundant indexes and returns its sizes
-func getSchemaRedundantIndexes(conn *store.DB) (map[string]postgresGenericStat, error) {
+func getSchemaRedundantIndexes(ctx context.Context, conn *store.DB) (map[string]postgresGenericStat, error) {
 	var query = "WITH index_data AS (SELECT *, string_to_array(indkey::text,' ') AS key_array, array_length(string_to_array(indkey::text,' '),1) AS nkeys FROM pg_index) " +
 		"SELECT c1.relnamespace::regnamespace::text AS schemaname, c1.relname AS relname, c2.relname AS indexrelname, " +
 		"pg_get_indexdef(i1.indexrelid) AS indexdef, pg_get_indexdef(i2.indexrelid) AS redundantdef, " +
@@ -351,7 +360,7 @@ func getSchemaRedundantIndexes(conn *store.DB) (map[string]postgresGenericStat,
 		"OR (NOT i1.indisunique AND NOT i2.indisunique AND (i1.indexrelid>i2.indexrelid)) " +
 		"OR (i1.indisunique AND NOT i2.indisunique)))) AND i1.key_array[1:i2.nkeys]=i2.key_array"
 
-	res, err := conn.Query(query)
+	res, err := conn.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -360,12 +369,11 @@ func getSchemaRedundantIndexes(conn *store.DB) (map[string]postgresGenericStat,
 }
 
 // collectSchemaSequences collects metrics related to sequences attached to poor-typed columns.
-func collectSchemaSequences(conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) {
+func collectSchemaSequences(ctx context.Context, conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) error {
 	datname := conn.Conn().Config().Database
-	stats, err := getSchemaSequences(conn)
+	stats, err := getSchemaSequences(ctx, conn)
 	if err != nil {
-		log.Errorf("get sequences stats of database %s failed: %s; skip", datname, err)
-		return
+		return fmt.Errorf("get sequences stats of database %s failed: %w", datname, err)
 	}
 
 	for k, s := range stats {
@@ -382,13 +390,15 @@ func collectSchemaSequences(conn *store.DB, ch chan<- prometheus.Metric, desc ty
 
 		ch <- desc.mustNewConstMetric(value, datname, schemaname, seqname)
 	}
+
+	return nil
 }
 
 // getSchemaSequences searches sequences attached to the poor-typed columns with risk of exhaustion.
-func getSchemaSequences(conn *store.DB) (map[string]postgresGenericStat, error) {
+func getSchemaSequences(ctx context.Context, conn *store.DB) (map[string]postgresGenericStat, error) {
 	var query = `SELECT schemaname, sequencename AS seqname, coalesce(last_value, 0) / max_value::float AS ratio FROM pg_sequences`
 
-	res, err := conn.Query(query)
+	res, err := conn.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -397,12 +407,11 @@ func getSchemaSequences(conn *store.DB) (map[string]postgresGenericStat, error)
 }
 
 // collectSchemaFKDatatypeMismatch collects metrics related to foreign key constraints with different data types.
-func collectSchemaFKDatatypeMismatch(conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) {
+func collectSchemaFKDatatypeMismatch(ctx context.Context, conn *store.DB, ch chan<- prometheus.Metric, desc typedDesc) error {
 	datname := conn.Conn().Config().Database
-	stats, err := getSchemaFKDatatypeMismatch(conn)
+	stats, err := getSchemaFKDatatypeMismatch(ctx, conn)
 	if err != nil {
-		log.Errorf("get foreign keys data types stats of database %s failed: %s; skip", datname, err)
-		return
+		return fmt.Errorf("get foreign keys data types stats of database %s failed: %w", datname, err)
 	}
 
 	for k, s := range stats {
@@ -422,10 +431,12 @@ func collectSchemaFKDatatypeMismatch(conn *store.DB, ch chan<- prometheus.Metric
 
 		ch <- desc.mustNewConstMetric(1, datname, schemaname, relname, colname, refschemaname, refrelname, refcolname)
 	}
+
+	return nil
 }
 
 // getSchemaFKDatatypeMismatch searches foreign key constraints with different data types.
-func getSchemaFKDatatypeMismatch(conn *store.DB) (map[string]postgresGenericStat, error) {
+func getSchemaFKDatatypeMismatch(ctx context.Context, conn *store.DB) (map[string]postgresGenericStat, error) {
 	var query = "SELECT c1.relnamespace::regnamespace::text AS schemaname, c1.relname AS relname, a1.attname||'::'||t1.typname AS colname, " +
 		"c2.relnamespace::regnamespace::text AS refschemaname, c2.relname AS refrelname, a2.attname||'::'||t2.typname AS refcolname " +
 		"FROM pg_constraint JOIN pg_class c1 ON c1.oid = conrelid JOIN pg_class c2 ON c2.oid = confrelid " +
@@ -435,7 +446,7 @@ func getSchemaFKDatatypeMismatch(conn *store.DB) (map[string]postgresGenericStat
 		"JOIN pg_type t2 ON t2.oid = a2.atttypid " +
 		"WHERE a1.atttypid <> a2.atttypid AND contype = 'f'"
 
-	res, err := conn.Query(query)
+	res, err := conn.QueryContext(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"fmt"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
@@ -43,8 +44,8 @@ func NewPostgresSettingsCollector(constLabels prometheus.Labels) (Collector, err
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *postgresSettingsCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *postgresSettingsCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
@@ -53,7 +54,7 @@ func (c *postgresSettingsCollector) Update(config Config, ch chan<- prometheus.M
 	// For complete list of displayable names of GUC's sources types check guc.c (see GucSource_Names[]).
 	query := "SELECT name, setting, unit, vartype FROM pg_show_all_settings() " +
 		"WHERE source IN ('default','configuration file','override','environment variable','command line','global')"
-	res, err := conn.Query(query)
+	res, err := conn.QueryContext(ctx, query)
 	if err != nil {
 		return err
 	}
@@ -65,7 +66,7 @@ func (c *postgresSettingsCollector) Update(config Config, ch chan<- prometheus.M
 	}
 
 	query = `SELECT name, setting FROM pg_show_all_settings() WHERE name IN ('config_file','hba_file','ident_file','data_directory')`
-	res, err = conn.Query(query)
+	res, err = conn.QueryContext(ctx, query)
 	if err != nil {
 		return err
 	}
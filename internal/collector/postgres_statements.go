@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"crypto/md5" // #nosec G501
 	"fmt"
 	"github.com/jackc/pgx/v4"
@@ -211,20 +212,20 @@ func NewPostgresStatementsCollector(constLabels prometheus.Labels) (Collector, e
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *postgresStatementsCollector) Update(config Config, ch chan<- prometheus.Metric) error {
+func (c *postgresStatementsCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
 	// nothing to do, pg_stat_statements not found in shared_preload_libraries
 	if !config.PgStatStatements {
 		return nil
 	}
 
 	// looking for source database where pg_stat_statements is installed
-	conn, err := NewDBWithPgStatStatements(&config)
+	conn, err := NewDBWithPgStatStatements(ctx, &config)
 	if err != nil {
 		return err
 	}
 
 	// get pg_stat_statements stats
-	res, err := conn.Query(selectStatementsQuery(config.ServerVersionNum))
+	res, err := conn.QueryContext(ctx, selectStatementsQuery(config.ServerVersionNum))
 	if err != nil {
 		return err
 	}
@@ -535,7 +536,7 @@ func (c normalizationChain) normalize(query string) string {
 // NewDBWithPgStatStatements returns connection to the database where pg_stat_statements available for getting stats.
 // Executing this function supposes pg_stat_statements is already available in shared_preload_libraries (checked when
 // setting up service).
-func NewDBWithPgStatStatements(config *Config) (*store.DB, error) {
+func NewDBWithPgStatStatements(ctx context.Context, config *Config) (*store.DB, error) {
 	pgconfig, err := pgx.ParseConfig(config.ConnString)
 	if err != nil {
 		return nil, err
@@ -547,13 +548,13 @@ func NewDBWithPgStatStatements(config *Config) (*store.DB, error) {
 	}
 
 	// Establish connection using config.
-	conn, err := store.NewWithConfig(pgconfig)
+	conn, err := store.NewWithConfigContext(ctx, pgconfig)
 	if err != nil {
 		return nil, err
 	}
 
 	// Check for pg_stat_statements.
-	if isExtensionAvailable(conn, "pg_stat_statements") {
+	if isExtensionAvailable(ctx, conn, "pg_stat_statements") {
 		// Set up pg_stat_statements source. It's unnecessary here, because it's already set on previous execution of that
 		// function in pessimistic case, but do it explicitly.
 		config.PgStatStatementsSource = conn.Conn().Config().Database
@@ -567,7 +568,7 @@ func NewDBWithPgStatStatements(config *Config) (*store.DB, error) {
 	config.PgStatStatementsSource = ""
 
 	// Get databases list from current connection.
-	databases, err := listDatabases(conn)
+	databases, err := listDatabases(ctx, conn)
 	if err != nil {
 		conn.Close()
 		return nil, err
@@ -579,14 +580,14 @@ func NewDBWithPgStatStatements(config *Config) (*store.DB, error) {
 	// Establish connection to each database in the list and check where pg_stat_statements is installed.
 	for _, d := range databases {
 		pgconfig.Database = d
-		conn, err := store.NewWithConfig(pgconfig)
+		conn, err := store.NewWithConfigContext(ctx, pgconfig)
 		if err != nil {
 			log.Warnf("connect to database '%s' failed: %s; skip", pgconfig.Database, err)
 			continue
 		}
 
 		// If pg_stat_statements found, update source and return connection.
-		if isExtensionAvailable(conn, "pg_stat_statements") {
+		if isExtensionAvailable(ctx, conn, "pg_stat_statements") {
 			config.PgStatStatementsSource = conn.Conn().Config().Database
 			return conn, nil
 		}
@@ -62,7 +62,7 @@ func NewPostgresStorageCollector(constLabels prometheus.Labels) (Collector, erro
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *postgresStorageCollector) Update(config Config, ch chan<- prometheus.Metric) error {
+func (c *postgresStorageCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
 	// Following directory listing functions are available since:
 	// - pg_ls_dir(), pg_ls_waldir() since Postgres 10
 	// - pg_ls_tmpdir() since Postgres 12
@@ -71,7 +71,7 @@ func (c *postgresStorageCollector) Update(config Config, ch chan<- prometheus.Me
 		return nil
 	}
 
-	conn, err := store.New(config.ConnString)
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
@@ -79,7 +79,7 @@ func (c *postgresStorageCollector) Update(config Config, ch chan<- prometheus.Me
 
 	// Collecting in-flight temp only since Postgres 12.
 	if config.ServerVersionNum >= PostgresV12 {
-		res, err := conn.Query(postgresTempFilesInflightQuery)
+		res, err := conn.QueryContext(ctx, postgresTempFilesInflightQuery)
 		if err == nil {
 			stats := parsePostgresTempFileInflght(res)
 
@@ -94,7 +94,7 @@ func (c *postgresStorageCollector) Update(config Config, ch chan<- prometheus.Me
 	}
 
 	// Collecting other server-directories stats (DATADIR, WALDIR, LOGDIR, TEMPDIR).
-	dirstats, err := newPostgresDirStat(conn, config.DataDirectory, config.LoggingCollector, config.ServerVersionNum)
+	dirstats, err := newPostgresDirStat(ctx, conn, config.DataDirectory, config.LoggingCollector, config.ServerVersionNum)
 	if err != nil {
 		return err
 	}
@@ -204,7 +204,7 @@ type postgresDirStat struct {
 }
 
 // newPostgresDirStat returns sizes of Postgres server directories.
-func newPostgresDirStat(conn *store.DB, datadir string, logcollector bool, version int) (*postgresDirStat, error) {
+func newPostgresDirStat(ctx context.Context, conn *store.DB, datadir string, logcollector bool, version int) (*postgresDirStat, error) {
 	// Get directories mountpoints.
 	mounts, err := getMountpoints()
 	if err != nil {
@@ -218,19 +218,19 @@ func newPostgresDirStat(conn *store.DB, datadir string, logcollector bool, versi
 	}
 
 	// Get WALDIR properties.
-	waldirDevice, waldirPath, waldirMountpoint, waldirSize, err := getWaldirStat(conn, mounts)
+	waldirDevice, waldirPath, waldirMountpoint, waldirSize, err := getWaldirStat(ctx, conn, mounts)
 	if err != nil {
 		log.Errorln(err)
 	}
 
 	// Get LOGDIR properties.
-	logdirDevice, logdirPath, logdirMountpoint, logdirSize, err := getLogdirStat(conn, logcollector, datadir, mounts)
+	logdirDevice, logdirPath, logdirMountpoint, logdirSize, err := getLogdirStat(ctx, conn, logcollector, datadir, mounts)
 	if err != nil {
 		log.Errorln(err)
 	}
 
 	// Get temp files and directories properties.
-	tmpfilesSize, err := getTempfilesStat(conn, version)
+	tmpfilesSize, err := getTempfilesStat(ctx, conn, version)
 	if err != nil {
 		log.Errorln(err)
 	}
@@ -272,11 +272,11 @@ func getDatadirStat(datadir string, mounts []mount) (string, string, int64, erro
 }
 
 // getWaldirStat returns filesystem info related to WALDIR.
-func getWaldirStat(conn *store.DB, mounts []mount) (string, string, string, int64, error) {
+func getWaldirStat(ctx context.Context, conn *store.DB, mounts []mount) (string, string, string, int64, error) {
 	var path string
 	var size int64
 	err := conn.Conn().
-		QueryRow(context.Background(), "SELECT current_setting('data_directory')||'/pg_wal' AS path, sum(size) AS bytes FROM pg_ls_waldir()").
+		QueryRow(ctx, "SELECT current_setting('data_directory')||'/pg_wal' AS path, sum(size) AS bytes FROM pg_ls_waldir()").
 		Scan(&path, &size)
 	if err != nil {
 		return "", "", "", 0, fmt.Errorf("get WAL directory size failed: %s", err)
@@ -293,7 +293,7 @@ func getWaldirStat(conn *store.DB, mounts []mount) (string, string, string, int6
 }
 
 // getLogdirStat returns filesystem info related to LOGDIR.
-func getLogdirStat(conn *store.DB, logcollector bool, datadir string, mounts []mount) (string, string, string, int64, error) {
+func getLogdirStat(ctx context.Context, conn *store.DB, logcollector bool, datadir string, mounts []mount) (string, string, string, int64, error) {
 	if !logcollector {
 		// Disabled logging_collector means all logs are written to stdout.
 		// There is no reliable way to understand file location of stdout (it can be a symlink from /proc/pid/fd/1 -> somewhere)
@@ -303,7 +303,7 @@ func getLogdirStat(conn *store.DB, logcollector bool, datadir string, mounts []m
 	var size int64
 	var path string
 	err := conn.Conn().
-		QueryRow(context.Background(), "SELECT current_setting('log_directory') AS path, coalesce(sum(size), 0) AS bytes FROM pg_ls_logdir()").
+		QueryRow(ctx, "SELECT current_setting('log_directory') AS path, coalesce(sum(size), 0) AS bytes FROM pg_ls_logdir()").
 		Scan(&path, &size)
 	if err != nil {
 		return "", "", "", 0, fmt.Errorf("get log directory size failed: %s", err)
@@ -326,14 +326,14 @@ func getLogdirStat(conn *store.DB, logcollector bool, datadir string, mounts []m
 }
 
 // getTempfilesStat returns filesystem info related to temp files and directories.
-func getTempfilesStat(conn *store.DB, version int) (int64, error) {
+func getTempfilesStat(ctx context.Context, conn *store.DB, version int) (int64, error) {
 	if version < PostgresV12 {
 		return 0, nil
 	}
 
 	var size int64
 	err := conn.Conn().
-		QueryRow(context.Background(), "SELECT coalesce(sum(size), 0) AS total_bytes FROM (SELECT (pg_ls_tmpdir(oid)).size FROM pg_tablespace WHERE spcname != 'pg_global') tablespaces").
+		QueryRow(ctx, "SELECT coalesce(sum(size), 0) AS total_bytes FROM (SELECT (pg_ls_tmpdir(oid)).size FROM pg_tablespace WHERE spcname != 'pg_global') tablespaces").
 		Scan(&size)
 	if err != nil {
 		return 0, fmt.Errorf("get total size of temp files failed: %s", err)
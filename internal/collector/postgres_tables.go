@@ -1,6 +1,8 @@
 package collector
 
 import (
+	"context"
+	"fmt"
 	"github.com/jackc/pgx/v4"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/weaponry/pgscv/internal/log"
@@ -183,13 +185,13 @@ func NewPostgresTablesCollector(constLabels prometheus.Labels) (Collector, error
 }
 
 // Update method collects statistics, parse it and produces metrics that are sent to Prometheus.
-func (c *postgresTablesCollector) Update(config Config, ch chan<- prometheus.Metric) error {
-	conn, err := store.New(config.ConnString)
+func (c *postgresTablesCollector) Update(ctx context.Context, config Config, ch chan<- prometheus.Metric) error {
+	conn, err := store.NewContext(ctx, config.ConnString)
 	if err != nil {
 		return err
 	}
 
-	databases, err := listDatabases(conn)
+	databases, err := listDatabases(ctx, conn)
 	if err != nil {
 		return err
 	}
@@ -201,17 +203,19 @@ func (c *postgresTablesCollector) Update(config Config, ch chan<- prometheus.Met
 		return err
 	}
 
+	// Failures of particular databases don't stop collecting, they are reported when all databases are walked through.
+	var errs []error
 	for _, d := range databases {
 		pgconfig.Database = d
-		conn, err := store.NewWithConfig(pgconfig)
+		conn, err := store.NewWithConfigContext(ctx, pgconfig)
 		if err != nil {
 			return err
 		}
 
-		res, err := conn.Query(userTablesQuery)
+		res, err := conn.QueryContext(ctx, userTablesQuery)
 		conn.Close()
 		if err != nil {
-			log.Warnf("get tables stat of database '%s' failed: %s; skip", d, err)
+			errs = append(errs, fmt.Errorf("get tables stat of database '%s' failed: %w", d, err))
 			continue
 		}
 
@@ -285,7 +289,7 @@ func (c *postgresTablesCollector) Update(config Config, ch chan<- prometheus.Met
 		}
 	}
 
-	return nil
+	return firstError(errs)
 }
 
 // postgresTableStat is per-table store for metrics related to how tables are accessed.
@@ -0,0 +1,57 @@
+package collector
+
+import (
+	"sort"
+	"time"
+)
+
+// CollectorStatus describes results of the collector's last run.
+type CollectorStatus struct {
+	// Name is the name of the collector.
+	Name string `json:"name"`
+	// LastRun is the time of the collector's last run, nil if collector has not been run yet.
+	LastRun *time.Time `json:"last_run,omitempty"`
+	// Duration is the duration of the collector's last run, in seconds.
+	Duration float64 `json:"duration_seconds"`
+	// Success defines whether the collector's last run succeeded.
+	Success bool `json:"success"`
+	// ScrapedMetrics is the number of metrics produced by the collector during the last run.
+	ScrapedMetrics int `json:"scraped_metrics"`
+	// LastError is the error of the collector's last failed run.
+	LastError string `json:"last_error,omitempty"`
+	// LastErrorTime is the time of the collector's last failed run, nil if collector never failed.
+	LastErrorTime *time.Time `json:"last_error_time,omitempty"`
+}
+
+// Status returns statuses of all enabled collectors sorted by names.
+func (n PgscvCollector) Status() []CollectorStatus {
+	names := make([]string, 0, len(n.Collectors))
+	for name := range n.Collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	statuses := make([]CollectorStatus, len(names))
+	for i, name := range names {
+		statuses[i] = n.stats.status(name)
+	}
+
+	return statuses
+}
+
+// status returns results of the collector's last run. Collectors which have not been run yet have only name.
+func (s *collectorStats) status(name string) CollectorStatus {
+	if s == nil {
+		return CollectorStatus{Name: name}
+	}
+
+	s.mu.Lock()
+	status, ok := s.statuses[name]
+	s.mu.Unlock()
+
+	if !ok {
+		return CollectorStatus{Name: name}
+	}
+
+	return status
+}
@@ -0,0 +1,29 @@
+package collector
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestPgscvCollector_Status(t *testing.T) {
+	c := PgscvCollector{
+		Collectors: map[string]Collector{"test/b": &testCollector{}, "test/a": &testCollector{}, "test/c": &testCollector{}},
+		stats:      newCollectorStats(nil),
+	}
+
+	ts1, ts2 := time.Unix(1600000000, 0), time.Unix(1600000060, 0)
+	c.stats.update("test/a", time.Second, 3, nil, ts1)
+	c.stats.update("test/b", time.Second, 0, fmt.Errorf("failed"), ts1)
+	c.stats.update("test/b", 2*time.Second, 5, nil, ts2)
+
+	assert.Equal(t, []CollectorStatus{
+		{Name: "test/a", LastRun: &ts1, Duration: 1, Success: true, ScrapedMetrics: 3},
+		{Name: "test/b", LastRun: &ts2, Duration: 2, Success: true, ScrapedMetrics: 5, LastError: "failed", LastErrorTime: &ts1},
+		{Name: "test/c"},
+	}, c.Status())
+
+	// Collector without stats reports only names.
+	assert.Equal(t, []CollectorStatus{{Name: "test/a"}}, PgscvCollector{Collectors: map[string]Collector{"test/a": &testCollector{}}}.Status())
+}
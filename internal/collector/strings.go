@@ -9,3 +9,18 @@ func stringsContains(ss []string, s string) bool {
 	}
 	return false
 }
+
+// labelsEqual returns true if label sets are the same.
+func labelsEqual(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for k, v := range a {
+		if bv, ok := b[k]; !ok || bv != v {
+			return false
+		}
+	}
+
+	return true
+}
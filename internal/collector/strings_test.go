@@ -12,3 +12,10 @@ func Test_stringsContains(t *testing.T) {
 	assert.False(t, stringsContains(ss, "unknown_string"))
 	assert.False(t, stringsContains(nil, "example"))
 }
+
+func Test_labelsEqual(t *testing.T) {
+	assert.True(t, labelsEqual(nil, map[string]string{}))
+	assert.True(t, labelsEqual(map[string]string{"role": "leader"}, map[string]string{"role": "leader"}))
+	assert.False(t, labelsEqual(map[string]string{"role": "leader"}, map[string]string{"role": "replica"}))
+	assert.False(t, labelsEqual(map[string]string{"role": "leader"}, map[string]string{"scope": "main"}))
+}
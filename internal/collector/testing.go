@@ -1,6 +1,7 @@
 package collector
 
 import (
+	"context"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 	"github.com/weaponry/pgscv/internal/log"
@@ -46,7 +47,7 @@ func pipeline(t *testing.T, input pipelineInput) {
 	}
 
 	go func() {
-		err := collector.Update(config, ch)
+		err := collector.Update(context.Background(), config, ch)
 		assert.NoError(t, err)
 		close(ch)
 	}()
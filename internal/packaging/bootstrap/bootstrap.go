@@ -25,9 +25,13 @@ send_metrics_url: "{{ .SendMetricsURL }}"
 autoupdate: {{ .AutoUpdate }}
 defaults:
     postgres_username: "pgscv"
-    postgres_password: "{{ .DefaultPostgresPassword }}"
+{{- if .DefaultPostgresPassword }}
+    postgres_password_file: "{{ .PostgresPasswordFile }}"
+{{- end }}
     pgbouncer_username: "pgscv"
-    pgbouncer_password: "{{ .DefaultPgbouncerPassword }}"
+{{- if .DefaultPgbouncerPassword }}
+    pgbouncer_password_file: "{{ .PgbouncerPasswordFile }}"
+{{- end }}
 `
 
 const unitTemplate = `
@@ -45,6 +49,9 @@ Group={{ .RunAsUser }}
 # Start the agent process
 ExecStart=/usr/bin/{{ .ExecutableName }} --config-file=/etc/{{ .ExecutableName }}.yaml
 
+# Reload the agent configuration
+ExecReload=/bin/kill -HUP $MAINPID
+
 # Only kill the agent process
 KillMode=process
 
@@ -71,6 +78,8 @@ type Config struct {
 	APIKey                   string
 	DefaultPostgresPassword  string
 	DefaultPgbouncerPassword string
+	PostgresPasswordFile     string // file where default Postgres password is written to
+	PgbouncerPasswordFile    string // file where default Pgbouncer password is written to
 	//
 	configPathPrefix  string // path prefix for configuration file
 	systemdPathPrefix string // path prefix for systemd units
@@ -197,6 +206,17 @@ func createConfigFile(config *Config) error {
 		return fmt.Errorf("failed get user's uid/gid: %s", err)
 	}
 
+	// write passwords into separate files, config file refers to them
+	config.PostgresPasswordFile = fmt.Sprintf("%s/%s.postgres.password", config.configPathPrefix, config.ExecutableName)
+	if err := createPasswordFile(config.PostgresPasswordFile, config.DefaultPostgresPassword, uid, gid); err != nil {
+		return err
+	}
+
+	config.PgbouncerPasswordFile = fmt.Sprintf("%s/%s.pgbouncer.password", config.configPathPrefix, config.ExecutableName)
+	if err := createPasswordFile(config.PgbouncerPasswordFile, config.DefaultPgbouncerPassword, uid, gid); err != nil {
+		return err
+	}
+
 	// create config-file with proper permissions
 	conffile := fmt.Sprintf("%s/%s.yaml", config.configPathPrefix, config.ExecutableName)
 	f, err := os.Create(conffile)
@@ -229,6 +249,34 @@ func createConfigFile(config *Config) error {
 	return nil
 }
 
+// createPasswordFile creates file readable only by owner and writes password into it, nothing is created for empty password
+func createPasswordFile(filename string, password string, uid, gid int) error {
+	if password == "" {
+		return nil
+	}
+
+	f, err := os.OpenFile(filepath.Clean(filename), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("create password file failed: %s", err)
+	}
+	// Close file when chown or write fail, error of the repeated close on success path is ignored.
+	defer func() { _ = f.Close() }()
+
+	if err = f.Chown(uid, gid); err != nil {
+		return fmt.Errorf("change file ownership failed: %s", err)
+	}
+
+	if _, err = f.WriteString(password); err != nil {
+		return fmt.Errorf("write password file failed: %s", err)
+	}
+
+	if err = f.Close(); err != nil {
+		log.Warnln("close file failed, ignore it; ", err)
+	}
+
+	return nil
+}
+
 // creates systemd unit in system path
 func createSystemdUnit(config *Config) error {
 	log.Info("Create systemd unit")
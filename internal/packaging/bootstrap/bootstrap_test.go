@@ -131,6 +131,36 @@ func Test_createConfigFile(t *testing.T) {
 	}
 }
 
+func Test_createConfigFile_passwords(t *testing.T) {
+	var user string
+	if user = os.Getenv("USER"); user == "" {
+		user = "root"
+	}
+
+	config := Config{
+		ExecutableName: "testexec", configPathPrefix: "/tmp",
+		RunAsUser: user, APIKey: "TEST1234TEST-TEST-1234-TEST1234",
+		SendMetricsURL: "http://127.0.0.1:9091", AutoUpdateEnv: "true",
+		DefaultPostgresPassword: "secret",
+	}
+
+	assert.NoError(t, createConfigFile(&config))
+
+	content, err := os.ReadFile("/tmp/testexec.yaml")
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `postgres_password_file: "/tmp/testexec.postgres.password"`)
+	assert.NotContains(t, string(content), "secret")
+	assert.NotContains(t, string(content), "pgbouncer_password")
+
+	password, err := os.ReadFile("/tmp/testexec.postgres.password")
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(password))
+	assert.NoFileExists(t, "/tmp/testexec.pgbouncer.password")
+
+	assert.NoError(t, os.Remove("/tmp/testexec.yaml"))
+	assert.NoError(t, os.Remove("/tmp/testexec.postgres.password"))
+}
+
 func Test_createSystemdUnit(t *testing.T) {
 	var user string
 	if user = os.Getenv("USER"); user == "" {
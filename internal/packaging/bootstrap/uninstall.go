@@ -60,9 +60,16 @@ func removeServiceUnit() error {
 	return os.Remove(filename)
 }
 
-// removeConfig removes configuration file
+// removeConfig removes configuration file and password files
 func removeConfig() error {
 	log.Info("Remove config file")
+	for _, name := range []string{"postgres.password", "pgbouncer.password"} {
+		err := os.Remove(filepath.Clean(fmt.Sprintf("%s/%s.%s", defaultConfigPathPrefix, defaultExecutableName, name)))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
 	return os.Remove(filepath.Clean(fmt.Sprintf("%s/%s.yaml", defaultConfigPathPrefix, defaultExecutableName)))
 }
 
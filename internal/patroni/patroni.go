@@ -0,0 +1,184 @@
+package patroni
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// RoleLeader is the role of the member which runs primary Postgres.
+	RoleLeader = "leader"
+	// RoleStandbyLeader is the role of the member which leads the standby cluster.
+	RoleStandbyLeader = "standby_leader"
+	// RoleReplica is the role of the member which runs replica of Postgres, including synchronous replicas.
+	RoleReplica = "replica"
+
+	// defaultTimeout defines maximum duration of the request to Patroni REST API.
+	defaultTimeout = 5 * time.Second
+)
+
+// Status describes state of the member returned by '/patroni' endpoint of Patroni REST API.
+type Status struct {
+	State          string `json:"state"`
+	Role           string `json:"role"`
+	ServerVersion  int    `json:"server_version"`
+	Timeline       int    `json:"timeline"`
+	PendingRestart bool   `json:"pending_restart"`
+	Pause          bool   `json:"pause"`
+	Patroni        struct {
+		Version string `json:"version"`
+		Scope   string `json:"scope"`
+		Name    string `json:"name"`
+	} `json:"patroni"`
+}
+
+// Member describes the member of the cluster returned by '/cluster' endpoint of Patroni REST API.
+type Member struct {
+	Name     string `json:"name"`
+	Role     string `json:"role"`
+	State    string `json:"state"`
+	Timeline int    `json:"timeline"`
+	// Lag is the replication lag in bytes, it might be a number, 'unknown' or missing.
+	Lag interface{} `json:"lag"`
+}
+
+// LagBytes returns replication lag of the member in bytes, false if lag is unknown.
+func (m Member) LagBytes() (float64, bool) {
+	v, ok := m.Lag.(float64)
+	return v, ok
+}
+
+// Cluster describes the cluster returned by '/cluster' endpoint of Patroni REST API.
+type Cluster struct {
+	Scope   string   `json:"scope"`
+	Pause   bool     `json:"pause"`
+	Members []Member `json:"members"`
+}
+
+// Member returns the member of the cluster with specified name.
+func (c Cluster) Member(name string) (Member, bool) {
+	for _, m := range c.Members {
+		if m.Name == name {
+			return m, true
+		}
+	}
+
+	return Member{}, false
+}
+
+// Client is the client of Patroni REST API.
+type Client struct {
+	baseURL string
+	client  *http.Client
+}
+
+// NewClient creates new client of Patroni REST API available at specified URL.
+func NewClient(baseURL string) *Client {
+	return &Client{
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		client:  &http.Client{Timeout: defaultTimeout},
+	}
+}
+
+// Status returns state of the member.
+func (c *Client) Status(ctx context.Context) (Status, error) {
+	var s Status
+	err := c.get(ctx, "/patroni", &s)
+	return s, err
+}
+
+// Cluster returns state of the cluster.
+func (c *Client) Cluster(ctx context.Context) (Cluster, error) {
+	var cl Cluster
+	err := c.get(ctx, "/cluster", &cl)
+	return cl, err
+}
+
+// Labels returns labels which describe the member: name of the cluster, name of the member and its role.
+func (c *Client) Labels(ctx context.Context) (map[string]string, error) {
+	s, err := c.Status(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cl, err := c.Cluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewLabels(s, cl), nil
+}
+
+// get requests specified endpoint of REST API and decodes response into v.
+func (c *Client) get(ctx context.Context, path string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+path, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	// '/patroni' returns 503 when Postgres is not running, but the body still describes the member.
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusServiceUnavailable {
+		return fmt.Errorf("request %s failed: %s", path, resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("decode %s response failed: %s", path, err)
+	}
+
+	return nil
+}
+
+// NewLabels returns labels which describe the member: name of the cluster, name of the member and its role.
+func NewLabels(s Status, cl Cluster) map[string]string {
+	scope := s.Patroni.Scope
+	if scope == "" {
+		scope = cl.Scope
+	}
+
+	role := s.Role
+	if m, ok := cl.Member(s.Patroni.Name); ok {
+		role = m.Role
+	}
+
+	return map[string]string{"cluster": scope, "member": s.Patroni.Name, "role": normalizeRole(role)}
+}
+
+// normalizeRole returns role of the member, roles of different Patroni versions and endpoints are reduced to leader,
+// standby leader and replica.
+func normalizeRole(role string) string {
+	switch role {
+	case "leader", "master", "primary":
+		return RoleLeader
+	case "standby_leader", "standby-leader":
+		return RoleStandbyLeader
+	case "":
+		return ""
+	default:
+		return RoleReplica
+	}
+}
+
+// ValidateURL checks URL of Patroni REST API is valid.
+func ValidateURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil {
+		return err
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid Patroni URL '%s', should be http(s)://host:port", s)
+	}
+
+	return nil
+}
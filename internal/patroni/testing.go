@@ -0,0 +1,60 @@
+package patroni
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+)
+
+const (
+	// TestLeaderStatus is the response of '/patroni' endpoint of the leader member.
+	TestLeaderStatus = `{"state": "running", "role": "master", "server_version": 130004, "timeline": 5, "pending_restart": true,
+"patroni": {"version": "2.1.1", "scope": "demo", "name": "node1"}}`
+	// TestReplicaStatus is the response of '/patroni' endpoint of the replica member.
+	TestReplicaStatus = `{"state": "running", "role": "replica", "server_version": 130004, "timeline": 6, "pause": true,
+"patroni": {"version": "2.1.1", "scope": "demo", "name": "node1"}}`
+	// TestCluster is the response of '/cluster' endpoint where 'node1' is the leader.
+	TestCluster = `{"scope": "demo", "members": [
+{"name": "node1", "role": "leader", "state": "running", "timeline": 5},
+{"name": "node2", "role": "sync_standby", "state": "streaming", "timeline": 5, "lag": 0},
+{"name": "node3", "role": "replica", "state": "streaming", "timeline": 5, "lag": "unknown"}]}`
+	// TestClusterSwitched is the response of '/cluster' endpoint after switchover from 'node1' to 'node2'.
+	TestClusterSwitched = `{"scope": "demo", "pause": true, "members": [
+{"name": "node1", "role": "replica", "state": "streaming", "timeline": 6, "lag": 1024},
+{"name": "node2", "role": "leader", "state": "running", "timeline": 6}]}`
+)
+
+// TestServer is the stub of Patroni REST API used in tests.
+type TestServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	status  string
+	cluster string
+}
+
+// NewTestServer starts the stub of Patroni REST API which responds with specified '/patroni' and '/cluster' responses.
+func NewTestServer(status, cluster string) *TestServer {
+	s := &TestServer{status: status, cluster: cluster}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/patroni", func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_, _ = w.Write([]byte(s.status))
+	})
+	mux.HandleFunc("/cluster", func(w http.ResponseWriter, _ *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_, _ = w.Write([]byte(s.cluster))
+	})
+
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// Set replaces responses of the stub, e.g. for emulating switchover.
+func (s *TestServer) Set(status, cluster string) {
+	s.mu.Lock()
+	s.status, s.cluster = status, cluster
+	s.mu.Unlock()
+}
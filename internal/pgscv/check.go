@@ -0,0 +1,53 @@
+package pgscv
+
+import (
+	"context"
+	"fmt"
+	"github.com/weaponry/pgscv/internal/service"
+	"io"
+)
+
+// RunCheck connects to services defined in config (or discovered once), runs every enabled collector once and writes
+// report to w. Returns exit code: zero if all services and collectors are working, non-zero otherwise.
+func RunCheck(ctx context.Context, config *Config, w io.Writer) int {
+	repo := service.NewRepository()
+	defer repo.Close()
+
+	checks := repo.Check(ctx, newServiceConfig(config))
+
+	var failed int
+	for _, c := range checks {
+		name := c.ServiceID
+		if c.Conninfo != "" {
+			name = fmt.Sprintf("%s (%s)", c.ServiceID, c.Conninfo)
+		}
+
+		if c.Err != nil {
+			failed++
+			fmt.Fprintf(w, "service %s: FAILED: %s\n", name, c.Err)
+			continue
+		}
+
+		fmt.Fprintf(w, "service %s: OK\n", name)
+
+		for _, r := range c.Collectors {
+			if r.Failed() {
+				failed++
+			}
+
+			if r.Err != nil {
+				fmt.Fprintf(w, "  %-30s %s: %s\n", r.Name, r.Status, r.Err)
+			} else {
+				fmt.Fprintf(w, "  %-30s %s\n", r.Name, r.Status)
+			}
+		}
+	}
+
+	if failed > 0 {
+		fmt.Fprintf(w, "check failed: %d problems found\n", failed)
+		return 1
+	}
+
+	fmt.Fprintln(w, "check passed")
+	return 0
+}
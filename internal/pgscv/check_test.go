@@ -0,0 +1,35 @@
+package pgscv
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/service"
+	"testing"
+)
+
+func TestRunCheck(t *testing.T) {
+	config := &Config{
+		DisableCollectors: []string{"system/cpu", "system/diskstats", "system/filesystems", "system/netdev", "system/network", "system/sysconfig"},
+	}
+
+	// Only system service is defined.
+	config.ServicesConnSettings = []service.ConnSetting{}
+	buf := &bytes.Buffer{}
+	assert.Equal(t, 0, RunCheck(context.Background(), config, buf))
+	assert.Equal(t, `service system:0: OK
+  system/loadaverage             ok
+  system/memory                  ok
+  system/pgscv                   ok
+check passed
+`, buf.String())
+
+	// Service is not available.
+	config.ServicesConnSettings = []service.ConnSetting{
+		{ServiceType: "postgres", Conninfo: "host=127.0.0.1 port=1 user=pgscv dbname=pgscv_fixtures connect_timeout=1"},
+	}
+	buf.Reset()
+	assert.Equal(t, 1, RunCheck(context.Background(), config, buf))
+	assert.Contains(t, buf.String(), "service postgres (host=127.0.0.1 port=1 user=pgscv dbname=pgscv_fixtures connect_timeout=1): FAILED: ")
+	assert.Contains(t, buf.String(), "check failed: 1 problems found\n")
+}
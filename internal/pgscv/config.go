@@ -2,9 +2,12 @@ package pgscv
 
 import (
 	"fmt"
-	"github.com/jackc/pgx/v4"
+	"github.com/weaponry/pgscv/internal/collector"
 	"github.com/weaponry/pgscv/internal/filter"
 	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/model"
+	"github.com/weaponry/pgscv/internal/patroni"
+	"github.com/weaponry/pgscv/internal/relabel"
 	"github.com/weaponry/pgscv/internal/service"
 	"gopkg.in/yaml.v2"
 	"os"
@@ -20,42 +23,91 @@ const (
 	defaultPgbouncerDbname   = "pgbouncer"
 
 	defaultSendMetricsInterval = 60 * time.Second
+	defaultSpoolMaxBytes       = 64 * 1024 * 1024
+	defaultSpoolMaxAge         = 24 * time.Hour
+
+	defaultListenReadTimeout    = 10 * time.Second
+	defaultListenWriteTimeout   = 60 * time.Second
+	defaultMaxConcurrentScrapes = 10
+	defaultShutdownTimeout      = 10 * time.Second
+
+	defaultFileSDRefreshInterval   = 5 * time.Minute
+	defaultServicesRefreshInterval = time.Minute
+
+	// sendFormatWeaponry defines format of metrics accepted by Weaponry metric gateway: text exposition format.
+	sendFormatWeaponry = "weaponry"
+	// sendFormatRemoteWrite defines format of metrics accepted by Prometheus remote write compatible receivers.
+	sendFormatRemoteWrite = "remote_write"
+	// sendFormatOTLP defines format of metrics accepted by OpenTelemetry collectors: OTLP/HTTP with protobuf encoding.
+	sendFormatOTLP = "otlp"
 )
 
 // Config defines application's configuration.
 type Config struct {
-	BinaryPath           string                // full path of the program, required for auto-update procedure
-	BinaryVersion        string                // version of the program, required for auto-update procedure
-	AutoUpdate           bool                  `yaml:"autoupdate"`       // control auto-update enabled or not
-	NoTrackMode          bool                  `yaml:"no_track_mode"`    // controls tracking sensitive information (query texts, etc)
-	ListenAddress        string                `yaml:"listen_address"`   // Network address and port where the application should listen on
-	SendMetricsURL       string                `yaml:"send_metrics_url"` // URL of Weaponry service metric gateway
-	SendMetricsInterval  time.Duration         // Metric send interval
-	APIKey               string                `yaml:"api_key"`  // API key for accessing to Weaponry
-	ServicesConnSettings []service.ConnSetting `yaml:"services"` // Slice of connection settings for exact services
-	Defaults             map[string]string     `yaml:"defaults"` // Defaults
-	Filters              filter.Filters        `yaml:"filters"`
-	DisableCollectors    []string              `yaml:"disable_collectors"` // List of collectors which should be disabled.
+	BinaryPath           string                         // full path of the program, required for auto-update procedure
+	BinaryVersion        string                         // version of the program, required for auto-update procedure
+	ConfigFile           string                         // path to config file, required for configuration reload
+	WatchConfig          bool                           // reload configuration when config file is changed
+	AutoUpdate           bool                           `yaml:"autoupdate"`             // control auto-update enabled or not
+	NoTrackMode          bool                           `yaml:"no_track_mode"`          // controls tracking sensitive information (query texts, etc)
+	ListenAddress        string                         `yaml:"listen_address"`         // Network address and port where the application should listen on
+	DisableListener      bool                           `yaml:"disable_listener"`       // Don't run metrics listener, metrics are only sent to destinations
+	TLSServerConfig      TLSServerConfig                `yaml:"tls_server_config"`      // TLS settings of metrics listener
+	BasicAuthUsers       map[string]string              `yaml:"basic_auth_users"`       // Users and bcrypt-hashed passwords allowed to access metrics listener
+	ListenReadTimeout    time.Duration                  `yaml:"listen_read_timeout"`    // Maximum duration for reading the entire request by metrics listener
+	ListenWriteTimeout   time.Duration                  `yaml:"listen_write_timeout"`   // Maximum duration before timing out writes of the response by metrics listener
+	MaxConcurrentScrapes int                            `yaml:"max_concurrent_scrapes"` // Maximum number of concurrently served /metrics and /probe requests
+	ShutdownTimeout      time.Duration                  `yaml:"shutdown_timeout"`       // Maximum duration of finishing in-flight requests and flushing metrics at exit
+	SendMetricsURL       string                         `yaml:"send_metrics_url"`       // URL of Weaponry service metric gateway
+	SendMetricsInterval  time.Duration                  // Metric send interval
+	SendMetricsFormat    string                         `yaml:"send_metrics_format"`       // Format of sent metrics: 'weaponry', 'remote_write' or 'otlp'
+	SendMetricsUsername  string                         `yaml:"send_metrics_username"`     // Username used for basic authentication when sending metrics
+	SendMetricsPassword  string                         `yaml:"send_metrics_password"`     // Password used for basic authentication when sending metrics
+	SendMetricsToken     string                         `yaml:"send_metrics_bearer_token"` // Bearer token used for authentication when sending metrics
+	SendMetricsHeaders   map[string]string              `yaml:"send_metrics_headers"`      // Extra HTTP headers attached to requests when sending metrics
+	APIKey               string                         `yaml:"api_key"`                   // API key for accessing to Weaponry
+	SpoolDirectory       string                         `yaml:"spool_directory"`           // Directory for storing metrics which failed to send
+	SpoolMaxBytes        int64                          `yaml:"spool_max_bytes"`           // Maximum size of stored metrics
+	SpoolMaxAge          time.Duration                  `yaml:"spool_max_age"`             // Maximum age of stored metrics
+	Destinations         []Destination                  `yaml:"destinations"`              // Additional destinations where metrics are sent
+	ServicesConnSettings []service.ConnSetting          `yaml:"services"`                  // Slice of connection settings for exact services
+	DiscoveryRules       []service.DiscoveryRule        `yaml:"discovery_rules"`           // Overrides of settings of auto-discovered services
+	FileSD               service.FileSDConfig           `yaml:"file_sd"`                   // Files with services definitions watched for changes
+	ServicesRefresh      time.Duration                  `yaml:"services_refresh_interval"` // Interval between re-reading properties of services
+	Healthcheck          service.HealthcheckConfig      `yaml:"healthcheck"`               // Settings of services health checks
+	Defaults             map[string]string              `yaml:"defaults"`                  // Defaults
+	Filters              filter.Filters                 `yaml:"filters"`
+	DisableCollectors    []string                       `yaml:"disable_collectors"` // List of collectors which should be disabled.
+	Collectors           collector.CollectorsSettings   `yaml:"collectors"`         // Per-collector settings
+	RelabelConfigs       relabel.Configs                `yaml:"relabel_configs"`    // Relabeling rules applied to collected metrics
+	CardinalityLimits    collector.CardinalityLimits    `yaml:"cardinality_limits"` // Limits of number of series produced by services during single scrape
+	ProbeTargets         map[string]service.ConnSetting `yaml:"probe_targets"`      // Remote targets available through /probe endpoint
+	ProbeModules         map[string]ProbeModule         `yaml:"probe_modules"`      // Sets of collectors used for probing targets
 }
 
-// NewConfig creates new config based on config file or return default config of config is not exists.
+// NewConfig creates new config based on config file or return default config of config is not exists. Settings
+// from config file are overridden by PGSCV_* environment variables.
 func NewConfig(configFilePath string) (*Config, error) {
-	if configFilePath == "" {
-		return &Config{Defaults: map[string]string{}}, nil
-	}
+	config := Config{Defaults: map[string]string{}}
 
-	content, err := os.ReadFile(filepath.Clean(configFilePath))
-	if err != nil {
-		return nil, err
+	if configFilePath != "" {
+		content, err := os.ReadFile(filepath.Clean(configFilePath))
+		if err != nil {
+			return nil, err
+		}
+
+		err = yaml.Unmarshal(content, &config)
+		if err != nil {
+			return nil, err
+		}
+
+		log.Infoln("read configuration from ", configFilePath)
 	}
 
-	config := Config{Defaults: map[string]string{}}
-	err = yaml.Unmarshal(content, &config)
-	if err != nil {
+	if err := applyEnv(&config, os.Environ()); err != nil {
 		return nil, err
 	}
 
-	log.Infoln("read configuration from ", configFilePath)
 	return &config, nil
 }
 
@@ -63,15 +115,84 @@ func NewConfig(configFilePath string) (*Config, error) {
 func (c *Config) Validate() error {
 	c.SendMetricsInterval = defaultSendMetricsInterval
 
-	// API key is necessary when Metric Service is specified
-	if c.SendMetricsURL != "" && c.APIKey == "" {
-		return fmt.Errorf("API key should be specified")
+	if c.SendMetricsFormat == "" {
+		c.SendMetricsFormat = sendFormatWeaponry
+	}
+
+	switch c.SendMetricsFormat {
+	case sendFormatWeaponry:
+		// API key is necessary when Metric Service is specified
+		if c.SendMetricsURL != "" && c.APIKey == "" {
+			return fmt.Errorf("API key should be specified")
+		}
+	case sendFormatRemoteWrite, sendFormatOTLP:
+		// API key is not used by remote write and OTLP receivers, authentication is optional.
+	default:
+		return fmt.Errorf("unknown send_metrics_format '%s', supported: %s, %s, %s", c.SendMetricsFormat, sendFormatWeaponry, sendFormatRemoteWrite, sendFormatOTLP)
+	}
+
+	if c.SendMetricsToken != "" && (c.SendMetricsUsername != "" || c.SendMetricsPassword != "") {
+		return fmt.Errorf("basic authentication and bearer token can not be used together")
+	}
+
+	if c.SpoolDirectory != "" {
+		if c.SpoolMaxBytes < 0 || c.SpoolMaxAge < 0 {
+			return fmt.Errorf("spool limits should not be negative")
+		}
+
+		if c.SpoolMaxBytes == 0 {
+			c.SpoolMaxBytes = defaultSpoolMaxBytes
+		}
+
+		if c.SpoolMaxAge == 0 {
+			c.SpoolMaxAge = defaultSpoolMaxAge
+		}
 	}
 
 	if c.ListenAddress == "" {
 		c.ListenAddress = defaultListenAddress
 	}
 
+	if err := validateDestinations(c); err != nil {
+		return err
+	}
+
+	if c.DisableListener && len(c.destinations()) == 0 {
+		return fmt.Errorf("metrics listener can't be disabled when neither send_metrics_url nor destinations are specified")
+	}
+
+	if c.ListenReadTimeout < 0 || c.ListenWriteTimeout < 0 || c.MaxConcurrentScrapes < 0 || c.ShutdownTimeout < 0 {
+		return fmt.Errorf("listener timeouts, max_concurrent_scrapes and shutdown_timeout should not be negative")
+	}
+
+	if c.ListenReadTimeout == 0 {
+		c.ListenReadTimeout = defaultListenReadTimeout
+	}
+
+	if c.ListenWriteTimeout == 0 {
+		c.ListenWriteTimeout = defaultListenWriteTimeout
+	}
+
+	if c.MaxConcurrentScrapes == 0 {
+		c.MaxConcurrentScrapes = defaultMaxConcurrentScrapes
+	}
+
+	if c.ShutdownTimeout == 0 {
+		c.ShutdownTimeout = defaultShutdownTimeout
+	}
+
+	if c.WatchConfig && c.ConfigFile == "" {
+		return fmt.Errorf("config file should be specified for watching changes")
+	}
+
+	if err := c.TLSServerConfig.validate(); err != nil {
+		return fmt.Errorf("invalid tls_server_config: %s", err)
+	}
+
+	if err := validateBasicAuthUsers(c.BasicAuthUsers); err != nil {
+		return err
+	}
+
 	log.Infoln("*** IMPORTANT ***: pgSCV by default collects information about user queries. Tracking queries can be disabled with 'no_track_mode: true' in config file.")
 	if c.NoTrackMode {
 		log.Infoln("no-track mode enabled: tracking disabled for [pg_stat_statements.query].")
@@ -100,21 +221,61 @@ func (c *Config) Validate() error {
 		c.Defaults["pgbouncer_dbname"] = defaultPgbouncerDbname
 	}
 
-	// User might specify its own set of services which he would like to monitor. This services should be validated and
-	// invalid should be rejected. Validation is performed using pgx.ParseConfig method which does all dirty work.
-	if c.ServicesConnSettings != nil {
-		if len(c.ServicesConnSettings) != 0 {
-			for _, s := range c.ServicesConnSettings {
-				if s.ServiceType == "" {
-					return fmt.Errorf("service_type is not specified for %s", s.Conninfo)
-				}
-
-				_, err := pgx.ParseConfig(s.Conninfo)
-				if err != nil {
-					return fmt.Errorf("invalid conninfo: %s", err)
-				}
+	// Password might be specified only in one way.
+	for _, prefix := range []string{"postgres", "pgbouncer"} {
+		var n int
+		for _, key := range []string{prefix + "_password", prefix + "_password_file", prefix + "_password_command"} {
+			if c.Defaults[key] != "" {
+				n++
 			}
 		}
+		if n > 1 {
+			return fmt.Errorf("only one of %s_password, %s_password_file and %s_password_command can be specified in defaults", prefix, prefix, prefix)
+		}
+	}
+
+	if v := c.Defaults["patroni_url"]; v != "" {
+		if err := patroni.ValidateURL(v); err != nil {
+			return fmt.Errorf("invalid defaults: %s", err)
+		}
+	}
+
+	// User might specify its own set of services which he would like to monitor. This services should be validated and
+	// invalid should be rejected.
+	for _, s := range c.ServicesConnSettings {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+	}
+
+	for i, r := range c.DiscoveryRules {
+		if r.ServiceType != "" && r.ServiceType != model.ServiceTypePostgresql && r.ServiceType != model.ServiceTypePgbouncer {
+			return fmt.Errorf("invalid service_type of discovery rule %d", i)
+		}
+
+		if err := r.Overrides.Validate(); err != nil {
+			return fmt.Errorf("invalid discovery rule %d: %s", i, err)
+		}
+	}
+
+	if err := c.FileSD.Validate(); err != nil {
+		return fmt.Errorf("invalid file_sd: %s", err)
+	}
+
+	if c.FileSD.RefreshInterval == 0 {
+		c.FileSD.RefreshInterval = defaultFileSDRefreshInterval
+	}
+
+	if c.ServicesRefresh < 0 {
+		return fmt.Errorf("services_refresh_interval should not be negative")
+	}
+
+	if c.ServicesRefresh == 0 {
+		c.ServicesRefresh = defaultServicesRefreshInterval
+	}
+
+	if err := c.Healthcheck.Validate(); err != nil {
+		return fmt.Errorf("invalid healthcheck: %s", err)
 	}
 
 	// Add default filters and compile regexps.
@@ -126,5 +287,21 @@ func (c *Config) Validate() error {
 		return err
 	}
 
+	if err := c.Collectors.Validate(); err != nil {
+		return err
+	}
+
+	if err := c.RelabelConfigs.Compile(); err != nil {
+		return err
+	}
+
+	if err := c.CardinalityLimits.Validate(); err != nil {
+		return err
+	}
+
+	if err := validateProbeTargets(c.ProbeTargets, c.ProbeModules); err != nil {
+		return err
+	}
+
 	return nil
 }
@@ -2,10 +2,13 @@ package pgscv
 
 import (
 	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/collector"
 	"github.com/weaponry/pgscv/internal/filter"
 	"github.com/weaponry/pgscv/internal/model"
+	"github.com/weaponry/pgscv/internal/relabel"
 	"github.com/weaponry/pgscv/internal/service"
 	"testing"
+	"time"
 )
 
 func TestNewConfig(t *testing.T) {
@@ -72,6 +75,19 @@ func TestNewConfig(t *testing.T) {
 				},
 			},
 		},
+		{
+			name:  "valid: with collectors settings",
+			valid: true,
+			file:  "testdata/pgscv-collectors-example.yaml",
+			want: &Config{
+				ListenAddress: "127.0.0.1:8080",
+				Defaults:      map[string]string{},
+				Collectors: collector.CollectorsSettings{
+					"postgres/schemas": {Timeout: 5 * time.Second, Interval: time.Hour},
+					"postgres/tables":  {Timeout: 10 * time.Second},
+				},
+			},
+		},
 		{
 			name:  "empty config-file opt",
 			valid: true,
@@ -129,6 +145,62 @@ func TestConfig_Validate(t *testing.T) {
 			valid: false,
 			in:    &Config{SendMetricsURL: "http://127.0.0.1:9091", APIKey: ""},
 		},
+		{
+			name:  "valid config for PUSH Mode: remote write",
+			valid: true,
+			in:    &Config{SendMetricsURL: "http://127.0.0.1:9091", SendMetricsFormat: "remote_write"},
+		},
+		{
+			name:  "valid config for PUSH Mode: remote write with basic auth",
+			valid: true,
+			in: &Config{
+				SendMetricsURL: "http://127.0.0.1:9091", SendMetricsFormat: "remote_write",
+				SendMetricsUsername: "user", SendMetricsPassword: "pass",
+			},
+		},
+		{
+			name:  "valid config for PUSH Mode: OTLP",
+			valid: true,
+			in:    &Config{SendMetricsURL: "http://127.0.0.1:4318/v1/metrics", SendMetricsFormat: "otlp"},
+		},
+		{
+			name:  "invalid config for PUSH Mode: unknown format",
+			valid: false,
+			in:    &Config{SendMetricsURL: "http://127.0.0.1:9091", SendMetricsFormat: "unknown"},
+		},
+		{
+			name:  "invalid config for PUSH Mode: basic auth and bearer token",
+			valid: false,
+			in: &Config{
+				SendMetricsURL: "http://127.0.0.1:9091", SendMetricsFormat: "remote_write",
+				SendMetricsUsername: "user", SendMetricsToken: "token",
+			},
+		},
+		{
+			name:  "valid config for PUSH Mode: with spool",
+			valid: true,
+			in:    &Config{SendMetricsURL: "http://127.0.0.1:9091", APIKey: "TEST1234TEST", SpoolDirectory: "/tmp"},
+		},
+		{
+			name:  "invalid config for PUSH Mode: negative spool limits",
+			valid: false,
+			in:    &Config{SendMetricsURL: "http://127.0.0.1:9091", APIKey: "TEST1234TEST", SpoolDirectory: "/tmp", SpoolMaxBytes: -1},
+		},
+		{
+			name:  "valid config with TLS",
+			valid: true,
+			in:    &Config{TLSServerConfig: TLSServerConfig{CertFile: "server.crt", KeyFile: "server.key"}},
+		},
+		{
+			name:  "invalid config with TLS: no key file",
+			valid: false,
+			in:    &Config{TLSServerConfig: TLSServerConfig{CertFile: "server.crt"}},
+		},
+		{
+			name:  "invalid config with basic auth: invalid hash",
+			valid: false,
+			in:    &Config{BasicAuthUsers: map[string]string{"user": "password"}},
+		},
 		{
 			name:  "valid config with specified services",
 			valid: true,
@@ -151,11 +223,181 @@ func TestConfig_Validate(t *testing.T) {
 				{ServiceType: model.ServiceTypePostgresql, Conninfo: "invalid"},
 			}},
 		},
+		{
+			name:  "valid config with specified services: password file",
+			valid: true,
+			in: &Config{ListenAddress: "127.0.0.1:8080", ServicesConnSettings: []service.ConnSetting{
+				{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1 dbname=pgscv_fixtures user=pgscv", PasswordFile: "/etc/pgscv.password"},
+			}},
+		},
+		{
+			name:  "invalid config with specified services: both password file and command",
+			valid: false,
+			in: &Config{ListenAddress: "127.0.0.1:8080", ServicesConnSettings: []service.ConnSetting{
+				{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1 dbname=pgscv_fixtures user=pgscv", PasswordFile: "/etc/pgscv.password", PasswordCommand: "cat /etc/pgscv.password"},
+			}},
+		},
+		{
+			name:  "valid config with specified services: overrides",
+			valid: true,
+			in: &Config{ListenAddress: "127.0.0.1:8080", ServicesConnSettings: []service.ConnSetting{
+				{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1 dbname=pgscv_fixtures user=pgscv", Overrides: service.Overrides{
+					DisableCollectors: []string{"postgres/logs"}, Labels: map[string]string{"cluster": "main"},
+				}},
+			}},
+		},
+		{
+			name:  "invalid config with specified services: invalid label",
+			valid: false,
+			in: &Config{ListenAddress: "127.0.0.1:8080", ServicesConnSettings: []service.ConnSetting{
+				{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1 dbname=pgscv_fixtures user=pgscv", Overrides: service.Overrides{
+					Labels: map[string]string{"instance": "main"},
+				}},
+			}},
+		},
+		{
+			name:  "valid config with discovery rules",
+			valid: true,
+			in: &Config{DiscoveryRules: []service.DiscoveryRule{
+				{ServiceType: model.ServiceTypePostgresql, Port: 5433, Overrides: service.Overrides{Labels: map[string]string{"role": "replica"}}},
+			}},
+		},
+		{
+			name:  "invalid config with discovery rules: invalid service type",
+			valid: false,
+			in:    &Config{DiscoveryRules: []service.DiscoveryRule{{ServiceType: "system"}}},
+		},
+		{
+			name:  "invalid config with discovery rules: invalid filter",
+			valid: false,
+			in: &Config{DiscoveryRules: []service.DiscoveryRule{
+				{Port: 5433, Overrides: service.Overrides{Filters: filter.Filters{"netdev/device": {Include: "["}}}},
+			}},
+		},
+		{
+			name:  "valid config with file_sd",
+			valid: true,
+			in:    &Config{FileSD: service.FileSDConfig{Files: []string{"/etc/pgscv/targets/*.yaml", "/etc/pgscv/targets.json"}}},
+		},
+		{
+			name:  "invalid config with file_sd: invalid pattern",
+			valid: false,
+			in:    &Config{FileSD: service.FileSDConfig{Files: []string{"/etc/pgscv/targets/[.yaml"}}},
+		},
+		{
+			name:  "invalid config with file_sd: negative refresh interval",
+			valid: false,
+			in:    &Config{FileSD: service.FileSDConfig{Files: []string{"/etc/pgscv/targets.json"}, RefreshInterval: -time.Minute}},
+		},
+		{
+			name:  "valid config: defaults patroni url",
+			valid: true,
+			in:    &Config{Defaults: map[string]string{"patroni_url": "http://127.0.0.1:8008"}},
+		},
+		{
+			name:  "invalid config: defaults invalid patroni url",
+			valid: false,
+			in:    &Config{Defaults: map[string]string{"patroni_url": "127.0.0.1:8008"}},
+		},
+		{
+			name:  "valid config: defaults password command",
+			valid: true,
+			in:    &Config{Defaults: map[string]string{"postgres_password_command": "cat /etc/pgscv.password", "pgbouncer_password": "secret"}},
+		},
+		{
+			name:  "invalid config: defaults password and password file",
+			valid: false,
+			in:    &Config{Defaults: map[string]string{"pgbouncer_password": "secret", "pgbouncer_password_file": "/etc/pgscv.password"}},
+		},
 		{
 			name:  "invalid config: invalid filter",
 			valid: false,
 			in:    &Config{ListenAddress: "127.0.0.1:8080", Filters: map[string]filter.Filter{"test": {Include: "["}}},
 		},
+		{
+			name:  "valid config with collectors settings",
+			valid: true,
+			in:    &Config{Collectors: collector.CollectorsSettings{"postgres/schemas": {Timeout: 5 * time.Second}}},
+		},
+		{
+			name:  "valid config with relabel configs",
+			valid: true,
+			in:    &Config{RelabelConfigs: relabel.Configs{{SourceLabels: []string{"datname"}, Regex: "template.*", Action: "drop"}}},
+		},
+		{
+			name:  "invalid config: unknown relabel action",
+			valid: false,
+			in:    &Config{RelabelConfigs: relabel.Configs{{SourceLabels: []string{"datname"}, Action: "unknown"}}},
+		},
+		{
+			name:  "invalid config: unknown overflow action",
+			valid: false,
+			in:    &Config{CardinalityLimits: collector.CardinalityLimits{MaxSeriesPerMetric: 100, OverflowAction: "unknown"}},
+		},
+		{
+			name:  "valid config: push-only mode",
+			valid: true,
+			in:    &Config{DisableListener: true, SendMetricsURL: "http://127.0.0.1:9091", APIKey: "TEST1234TEST-TEST-1234-TEST1234"},
+		},
+		{
+			name:  "valid config: push-only mode with destinations",
+			valid: true,
+			in:    &Config{DisableListener: true, Destinations: []Destination{{Name: "vm", URL: "http://127.0.0.1:8428/api/v1/write", Format: "remote_write"}}},
+		},
+		{
+			name:  "valid config: multiple destinations",
+			valid: true,
+			in: &Config{
+				SendMetricsURL: "http://127.0.0.1:9091", APIKey: "TEST1234TEST-TEST-1234-TEST1234",
+				Destinations: []Destination{
+					{Name: "vm", URL: "http://127.0.0.1:8428/api/v1/write", Format: "remote_write", SpoolDirectory: "/tmp/vm"},
+					{Name: "otel", URL: "http://127.0.0.1:4318/v1/metrics", Format: "otlp", SpoolDirectory: "/tmp/otel"},
+				},
+			},
+		},
+		{
+			name:  "invalid config: duplicate destination name",
+			valid: false,
+			in: &Config{
+				SendMetricsURL: "http://127.0.0.1:9091", APIKey: "TEST1234TEST-TEST-1234-TEST1234",
+				Destinations: []Destination{{Name: "default", URL: "http://127.0.0.1:8428/api/v1/write", Format: "remote_write"}},
+			},
+		},
+		{
+			name:  "invalid config: shared spool directory",
+			valid: false,
+			in: &Config{
+				Destinations: []Destination{
+					{Name: "vm", URL: "http://127.0.0.1:8428/api/v1/write", Format: "remote_write", SpoolDirectory: "/tmp/spool"},
+					{Name: "otel", URL: "http://127.0.0.1:4318/v1/metrics", Format: "otlp", SpoolDirectory: "/tmp/spool"},
+				},
+			},
+		},
+		{
+			name:  "invalid config: disabled listener without send_metrics_url",
+			valid: false,
+			in:    &Config{DisableListener: true},
+		},
+		{
+			name:  "invalid config: negative shutdown timeout",
+			valid: false,
+			in:    &Config{ShutdownTimeout: -time.Second},
+		},
+		{
+			name:  "invalid config: negative services refresh interval",
+			valid: false,
+			in:    &Config{ServicesRefresh: -time.Minute},
+		},
+		{
+			name:  "invalid config: negative healthcheck failure threshold",
+			valid: false,
+			in:    &Config{Healthcheck: service.HealthcheckConfig{FailureThreshold: -1}},
+		},
+		{
+			name:  "invalid config: unknown collector in collectors settings",
+			valid: false,
+			in:    &Config{Collectors: collector.CollectorsSettings{"postgres/unknown": {Timeout: 5 * time.Second}}},
+		},
 	}
 
 	for _, tc := range testcases {
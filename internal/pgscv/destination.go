@@ -0,0 +1,172 @@
+package pgscv
+
+import (
+	"fmt"
+	"github.com/weaponry/pgscv/internal/relabel"
+	"net/url"
+	"time"
+)
+
+const (
+	// defaultDestinationName is the name of destination defined by send_metrics_* settings.
+	defaultDestinationName = "default"
+
+	defaultSendTimeout    = 10 * time.Second
+	defaultSendMaxBackoff = 60 * time.Second
+)
+
+// Destination defines remote service where collected metrics are sent. Each destination has its own format,
+// authentication and sending policy.
+type Destination struct {
+	Name           string            `yaml:"name"`            // Name of destination used in logs and metrics
+	URL            string            `yaml:"url"`             // URL where metrics are sent
+	Format         string            `yaml:"format"`          // Format of sent metrics: 'weaponry', 'remote_write' or 'otlp'
+	APIKey         string            `yaml:"api_key"`         // API key for accessing to Weaponry
+	Username       string            `yaml:"username"`        // Username used for basic authentication
+	Password       string            `yaml:"password"`        // Password used for basic authentication
+	BearerToken    string            `yaml:"bearer_token"`    // Bearer token used for authentication
+	Headers        map[string]string `yaml:"headers"`         // Extra HTTP headers attached to requests
+	Interval       time.Duration     `yaml:"interval"`        // Interval between sending metrics
+	Timeout        time.Duration     `yaml:"timeout"`         // Timeout of collecting and sending metrics
+	MaxRetries     int               `yaml:"max_retries"`     // Number of retries of failed sending, zero means retry until success
+	MaxBackoff     time.Duration     `yaml:"max_backoff"`     // Maximum delay between retries
+	SpoolDirectory string            `yaml:"spool_directory"` // Directory for storing metrics which failed to send
+	SpoolMaxBytes  int64             `yaml:"spool_max_bytes"` // Maximum size of stored metrics
+	SpoolMaxAge    time.Duration     `yaml:"spool_max_age"`   // Maximum age of stored metrics
+	RelabelConfigs relabel.Configs   `yaml:"relabel_configs"` // Relabeling rules applied only to metrics sent to this destination
+}
+
+// validate checks destination settings and sets defaults.
+func (d *Destination) validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("destination name should be specified")
+	}
+
+	if d.URL == "" {
+		return fmt.Errorf("url of destination %s should be specified", d.Name)
+	}
+
+	if _, err := url.Parse(d.URL); err != nil {
+		return fmt.Errorf("invalid url of destination %s: %s", d.Name, err)
+	}
+
+	if d.Format == "" {
+		d.Format = sendFormatWeaponry
+	}
+
+	switch d.Format {
+	case sendFormatWeaponry:
+		// API key is necessary when Metric Service is specified
+		if d.APIKey == "" {
+			return fmt.Errorf("API key should be specified for destination %s", d.Name)
+		}
+	case sendFormatRemoteWrite, sendFormatOTLP:
+		// API key is not used by remote write and OTLP receivers, authentication is optional.
+	default:
+		return fmt.Errorf("unknown format '%s' of destination %s, supported: %s, %s, %s", d.Format, d.Name, sendFormatWeaponry, sendFormatRemoteWrite, sendFormatOTLP)
+	}
+
+	if d.BearerToken != "" && (d.Username != "" || d.Password != "") {
+		return fmt.Errorf("basic authentication and bearer token can not be used together in destination %s", d.Name)
+	}
+
+	if d.Interval < 0 || d.Timeout < 0 || d.MaxRetries < 0 || d.MaxBackoff < 0 {
+		return fmt.Errorf("interval, timeout, max_retries and max_backoff of destination %s should not be negative", d.Name)
+	}
+
+	if d.Interval == 0 {
+		d.Interval = defaultSendMetricsInterval
+	}
+
+	if d.Timeout == 0 {
+		d.Timeout = defaultSendTimeout
+	}
+
+	if d.MaxBackoff == 0 {
+		d.MaxBackoff = defaultSendMaxBackoff
+	}
+
+	if d.SpoolDirectory != "" {
+		if d.SpoolMaxBytes < 0 || d.SpoolMaxAge < 0 {
+			return fmt.Errorf("spool limits of destination %s should not be negative", d.Name)
+		}
+
+		if d.SpoolMaxBytes == 0 {
+			d.SpoolMaxBytes = defaultSpoolMaxBytes
+		}
+
+		if d.SpoolMaxAge == 0 {
+			d.SpoolMaxAge = defaultSpoolMaxAge
+		}
+	}
+
+	if err := d.RelabelConfigs.Compile(); err != nil {
+		return fmt.Errorf("destination %s: %s", d.Name, err)
+	}
+
+	return nil
+}
+
+// validateDestinations checks destinations defined by send_metrics_* settings and destinations list. Names and
+// spool directories of destinations should be unique.
+func validateDestinations(c *Config) error {
+	if c.SendMetricsURL != "" {
+		d := c.defaultDestination()
+		if err := d.validate(); err != nil {
+			return err
+		}
+	}
+
+	for i := range c.Destinations {
+		if err := c.Destinations[i].validate(); err != nil {
+			return err
+		}
+	}
+
+	names, spools := map[string]bool{}, map[string]bool{}
+	for _, d := range c.destinations() {
+		if names[d.Name] {
+			return fmt.Errorf("duplicate destination name %s", d.Name)
+		}
+		names[d.Name] = true
+
+		if d.SpoolDirectory != "" {
+			if spools[d.SpoolDirectory] {
+				return fmt.Errorf("spool directory %s is used by several destinations", d.SpoolDirectory)
+			}
+			spools[d.SpoolDirectory] = true
+		}
+	}
+
+	return nil
+}
+
+// defaultDestination returns destination defined by send_metrics_* settings.
+func (c *Config) defaultDestination() Destination {
+	return Destination{
+		Name:           defaultDestinationName,
+		URL:            c.SendMetricsURL,
+		Format:         c.SendMetricsFormat,
+		APIKey:         c.APIKey,
+		Username:       c.SendMetricsUsername,
+		Password:       c.SendMetricsPassword,
+		BearerToken:    c.SendMetricsToken,
+		Headers:        c.SendMetricsHeaders,
+		Interval:       c.SendMetricsInterval,
+		Timeout:        defaultSendTimeout,
+		MaxBackoff:     defaultSendMaxBackoff,
+		SpoolDirectory: c.SpoolDirectory,
+		SpoolMaxBytes:  c.SpoolMaxBytes,
+		SpoolMaxAge:    c.SpoolMaxAge,
+	}
+}
+
+// destinations returns all destinations where metrics should be sent.
+func (c *Config) destinations() []Destination {
+	var destinations []Destination
+	if c.SendMetricsURL != "" {
+		destinations = append(destinations, c.defaultDestination())
+	}
+
+	return append(destinations, c.Destinations...)
+}
@@ -0,0 +1,74 @@
+package pgscv
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/relabel"
+	"testing"
+	"time"
+)
+
+func TestDestination_validate(t *testing.T) {
+	testcases := []struct {
+		name  string
+		valid bool
+		in    Destination
+		want  Destination
+	}{
+		{
+			name:  "valid destination with defaults",
+			valid: true,
+			in:    Destination{Name: "test", URL: "http://127.0.0.1:9091", APIKey: "TEST1234TEST", SpoolDirectory: "/tmp"},
+			want: Destination{
+				Name: "test", URL: "http://127.0.0.1:9091", Format: "weaponry", APIKey: "TEST1234TEST",
+				Interval: defaultSendMetricsInterval, Timeout: defaultSendTimeout, MaxBackoff: defaultSendMaxBackoff,
+				SpoolDirectory: "/tmp", SpoolMaxBytes: defaultSpoolMaxBytes, SpoolMaxAge: defaultSpoolMaxAge,
+			},
+		},
+		{
+			name:  "valid destination with own policy",
+			valid: true,
+			in: Destination{
+				Name: "test", URL: "http://127.0.0.1:8428/api/v1/write", Format: "remote_write",
+				Interval: 15 * time.Second, Timeout: 5 * time.Second, MaxRetries: 3, MaxBackoff: 30 * time.Second,
+			},
+			want: Destination{
+				Name: "test", URL: "http://127.0.0.1:8428/api/v1/write", Format: "remote_write",
+				Interval: 15 * time.Second, Timeout: 5 * time.Second, MaxRetries: 3, MaxBackoff: 30 * time.Second,
+			},
+		},
+		{name: "no name", in: Destination{URL: "http://127.0.0.1:9091", Format: "remote_write"}},
+		{name: "no url", in: Destination{Name: "test", Format: "remote_write"}},
+		{name: "invalid url", in: Destination{Name: "test", URL: "http://[invalid", Format: "remote_write"}},
+		{name: "no api key", in: Destination{Name: "test", URL: "http://127.0.0.1:9091"}},
+		{name: "unknown format", in: Destination{Name: "test", URL: "http://127.0.0.1:9091", Format: "unknown"}},
+		{name: "basic auth and bearer token", in: Destination{Name: "test", URL: "http://127.0.0.1:9091", Format: "otlp", Username: "user", BearerToken: "token"}},
+		{name: "negative retries", in: Destination{Name: "test", URL: "http://127.0.0.1:9091", Format: "otlp", MaxRetries: -1}},
+		{name: "negative spool limits", in: Destination{Name: "test", URL: "http://127.0.0.1:9091", Format: "otlp", SpoolDirectory: "/tmp", SpoolMaxAge: -1}},
+		{name: "invalid relabel config", in: Destination{Name: "test", URL: "http://127.0.0.1:9091", Format: "otlp", RelabelConfigs: relabel.Configs{{Action: "unknown"}}}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.in.validate()
+			if tc.valid {
+				assert.NoError(t, err)
+				assert.Equal(t, tc.want, tc.in)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestConfig_destinations(t *testing.T) {
+	config := &Config{Destinations: []Destination{{Name: "vm"}}}
+	assert.Equal(t, []Destination{{Name: "vm"}}, config.destinations())
+
+	config.SendMetricsURL, config.SendMetricsInterval = "http://127.0.0.1:9091", time.Minute
+	got := config.destinations()
+	assert.Len(t, got, 2)
+	assert.Equal(t, defaultDestinationName, got[0].Name)
+	assert.Equal(t, "http://127.0.0.1:9091", got[0].URL)
+	assert.Equal(t, time.Minute, got[0].Interval)
+	assert.Equal(t, "vm", got[1].Name)
+}
@@ -0,0 +1,285 @@
+package pgscv
+
+import (
+	"fmt"
+	"github.com/weaponry/pgscv/internal/log"
+	"gopkg.in/yaml.v2"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// envPrefix is the prefix of environment variables which override configuration settings.
+const envPrefix = "PGSCV_"
+
+// durationType is used for distinguishing durations from other integers.
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// envChunkRE splits names of variables into numbers and other parts.
+var envChunkRE = regexp.MustCompile(`[0-9]+|[^0-9]+`)
+
+// applyEnv overrides configuration settings with values of PGSCV_* environment variables. Names of variables are
+// built from upper-cased YAML names of settings:
+//   - top-level settings: PGSCV_LISTEN_ADDRESS, PGSCV_NO_TRACK_MODE, lists are comma-separated: PGSCV_DISABLE_COLLECTORS;
+//   - nested settings: PGSCV_TLS_SERVER_CONFIG_CERT_FILE;
+//   - maps: PGSCV_DEFAULTS_POSTGRES_PASSWORD, PGSCV_COLLECTORS_POSTGRES__STATEMENTS_TIMEOUT, keys are lower-cased and
+//     double underscore is replaced with slash;
+//   - lists of settings are indexed: PGSCV_SERVICES_0_SERVICE_TYPE, PGSCV_SERVICES_0_CONNINFO, indexes should not
+//     have gaps.
+//
+// Variables which don't match any setting are ignored.
+func applyEnv(c *Config, environ []string) error {
+	var vars [][]string
+	for _, kv := range environ {
+		if !strings.HasPrefix(kv, envPrefix) {
+			continue
+		}
+
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		vars = append(vars, parts)
+	}
+
+	// Items of lists are added in order of indexes, it allows to find gaps in indexes.
+	sort.SliceStable(vars, func(i, j int) bool { return lessEnvNames(vars[i][0], vars[j][0]) })
+
+	for _, parts := range vars {
+		ok, err := setStructFromEnv(reflect.ValueOf(c).Elem(), strings.TrimPrefix(parts[0], envPrefix), parts[1])
+		if err != nil {
+			return fmt.Errorf("invalid environment variable %s: %s", parts[0], err)
+		}
+
+		if ok {
+			log.Debugf("config: setting overridden by environment variable %s", parts[0])
+		}
+	}
+
+	return nil
+}
+
+// lessEnvNames compares names of variables, numbers in names are compared as numbers.
+func lessEnvNames(a, b string) bool {
+	ca, cb := envChunkRE.FindAllString(a, -1), envChunkRE.FindAllString(b, -1)
+	for i := 0; i < len(ca) && i < len(cb); i++ {
+		if ca[i] == cb[i] {
+			continue
+		}
+
+		na, errA := strconv.Atoi(ca[i])
+		nb, errB := strconv.Atoi(cb[i])
+		if errA == nil && errB == nil {
+			return na < nb
+		}
+
+		return ca[i] < cb[i]
+	}
+
+	return len(ca) < len(cb)
+}
+
+// setStructFromEnv sets the field of the struct which name matches the name of variable. Returns false if no field
+// matches the name.
+func setStructFromEnv(v reflect.Value, name, value string) (bool, error) {
+	// Look for exact match at first, it has priority over nested settings which names have the same prefix.
+	for i := 0; i < v.NumField(); i++ {
+		if envName(v.Type().Field(i)) == name {
+			return true, setValueFromEnv(v.Field(i), value)
+		}
+	}
+
+	for i := 0; i < v.NumField(); i++ {
+		prefix := envName(v.Type().Field(i))
+		if prefix != "" && strings.HasPrefix(name, prefix+"_") {
+			return setNestedFromEnv(v.Field(i), strings.TrimPrefix(name, prefix+"_"), value)
+		}
+	}
+
+	// Settings of inlined structs are named as settings of the outer struct.
+	for i := 0; i < v.NumField(); i++ {
+		if v.Field(i).Kind() == reflect.Struct && isInline(v.Type().Field(i)) {
+			if ok, err := setStructFromEnv(v.Field(i), name, value); ok || err != nil {
+				return ok, err
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// setNestedFromEnv sets the setting nested into struct, map or list.
+func setNestedFromEnv(v reflect.Value, name, value string) (bool, error) {
+	switch v.Kind() {
+	case reflect.Struct:
+		return setStructFromEnv(v, name, value)
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMap(v.Type()))
+		}
+
+		elemType := v.Type().Elem()
+		if elemType.Kind() != reflect.Struct {
+			elem := reflect.New(elemType).Elem()
+			if err := setValueFromEnv(elem, value); err != nil {
+				return true, err
+			}
+			v.SetMapIndex(reflect.ValueOf(envMapKey(name)).Convert(v.Type().Key()), elem)
+			return true, nil
+		}
+
+		// Name consists of the key and the name of the struct's field, the key might contain underscores.
+		for i := 0; i < elemType.NumField(); i++ {
+			field := envName(elemType.Field(i))
+			if field == "" || !strings.HasSuffix(name, "_"+field) || len(name) == len(field)+1 {
+				continue
+			}
+
+			key := reflect.ValueOf(envMapKey(strings.TrimSuffix(name, "_"+field))).Convert(v.Type().Key())
+
+			// Map values are not addressable, update a copy and put it back.
+			elem := newEnvElem(elemType)
+			if existing := v.MapIndex(key); existing.IsValid() {
+				elem.Set(existing)
+			}
+
+			if err := setValueFromEnv(elem.Field(i), value); err != nil {
+				return true, err
+			}
+			v.SetMapIndex(key, elem)
+			return true, nil
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.Struct {
+			break
+		}
+
+		parts := strings.SplitN(name, "_", 2)
+		if len(parts) != 2 {
+			break
+		}
+
+		idx, err := strconv.Atoi(parts[0])
+		if err != nil || idx < 0 {
+			return true, fmt.Errorf("invalid index '%s'", parts[0])
+		}
+
+		// Items are added in order of indexes, missing item means a gap in indexes.
+		if idx > v.Len() {
+			return true, fmt.Errorf("invalid index '%s', item with index %d is not specified", parts[0], v.Len())
+		}
+
+		if idx == v.Len() {
+			v.Set(reflect.Append(v, newEnvElem(v.Type().Elem())))
+		}
+
+		return setStructFromEnv(v.Index(idx), parts[1], value)
+	}
+
+	return false, nil
+}
+
+// setValueFromEnv parses value of variable and sets it to the setting.
+func setValueFromEnv(v reflect.Value, value string) error {
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := parseEnvBool(value)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("list of settings should be specified using indexed variables")
+		}
+
+		list := reflect.MakeSlice(v.Type(), 0, 0)
+		for _, s := range strings.Split(value, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				list = reflect.Append(list, reflect.ValueOf(s).Convert(v.Type().Elem()))
+			}
+		}
+		v.Set(list)
+	default:
+		return fmt.Errorf("setting should be specified using nested variables")
+	}
+
+	return nil
+}
+
+// parseEnvBool parses boolean value of variable. Besides values accepted by strconv.ParseBool, yes/no values accepted
+// by bootstrap are allowed.
+func parseEnvBool(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "y", "yes":
+		return true, nil
+	case "n", "no":
+		return false, nil
+	default:
+		return strconv.ParseBool(value)
+	}
+}
+
+// envName returns name of variable (without prefix) for the struct's field, empty for fields without YAML name.
+func envName(f reflect.StructField) string {
+	name := strings.Split(f.Tag.Get("yaml"), ",")[0]
+	if name == "-" {
+		return ""
+	}
+
+	return strings.ToUpper(name)
+}
+
+// isInline returns true if the struct's field is inlined into the outer struct in YAML.
+func isInline(f reflect.StructField) bool {
+	for _, opt := range strings.Split(f.Tag.Get("yaml"), ",")[1:] {
+		if opt == "inline" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// envMapKey converts part of variable's name into map key.
+func envMapKey(s string) string {
+	return strings.ToLower(strings.ReplaceAll(s, "__", "/"))
+}
+
+// newEnvElem creates new element of list or map. Element is initialized with defaults which are set when element
+// is read from YAML.
+func newEnvElem(t reflect.Type) reflect.Value {
+	elem := reflect.New(t)
+	if err := yaml.Unmarshal([]byte("{}"), elem.Interface()); err != nil {
+		log.Debugf("config: initialize %s failed: %s; use zero value", t, err)
+	}
+
+	return elem.Elem()
+}
@@ -0,0 +1,133 @@
+package pgscv
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/collector"
+	"github.com/weaponry/pgscv/internal/filter"
+	"github.com/weaponry/pgscv/internal/relabel"
+	"github.com/weaponry/pgscv/internal/service"
+	"os"
+	"sort"
+	"testing"
+	"time"
+)
+
+func Test_applyEnv(t *testing.T) {
+	config := &Config{
+		ListenAddress: "127.0.0.1:9890",
+		Defaults:      map[string]string{"postgres_username": "monitoring"},
+		Collectors:    collector.CollectorsSettings{"postgres/statements": {Interval: time.Minute}},
+	}
+
+	environ := []string{
+		"HOME=/root",
+		"PGSCV_LISTEN_ADDRESS=0.0.0.0:9890",
+		"PGSCV_NO_TRACK_MODE=true",
+		"PGSCV_AUTOUPDATE=yes", // bootstrap value
+		"PGSCV_MAX_CONCURRENT_SCRAPES=5",
+		"PGSCV_SHUTDOWN_TIMEOUT=30s",
+		"PGSCV_DISABLE_COLLECTORS=system/cpu, postgres/logs",
+		"PGSCV_DEFAULTS_POSTGRES_PASSWORD=secret=with=equals",
+		"PGSCV_TLS_SERVER_CONFIG_CERT_FILE=/etc/pgscv/server.crt",
+		"PGSCV_CARDINALITY_LIMITS_MAX_SERIES_PER_METRIC=1000",
+		"PGSCV_SERVICES_1_SERVICE_TYPE=pgbouncer",
+		"PGSCV_SERVICES_1_CONNINFO=host=127.0.0.1 port=6432 dbname=pgbouncer",
+		"PGSCV_SERVICES_0_SERVICE_TYPE=postgres",
+		"PGSCV_SERVICES_0_CONNINFO=host=127.0.0.1 port=5432",
+		"PGSCV_SERVICES_0_DISABLE_COLLECTORS=postgres/logs",
+		"PGSCV_SERVICES_0_LABELS_CLUSTER=main",
+		"PGSCV_DISCOVERY_RULES_0_PORT=5433",
+		"PGSCV_DISCOVERY_RULES_0_LABELS_ROLE=replica",
+		"PGSCV_FILE_SD_FILES=/etc/pgscv/targets/*.yaml",
+		"PGSCV_FILE_SD_REFRESH_INTERVAL=1m",
+		"PGSCV_HEALTHCHECK_FAILURE_THRESHOLD=3",
+		"PGSCV_HEALTHCHECK_KEEP_STATIC_SERVICES=true",
+		"PGSCV_COLLECTORS_POSTGRES__STATEMENTS_TIMEOUT=5s",
+		"PGSCV_COLLECTORS_POSTGRES__REPLICATION_SLOTS_INTERVAL=1m",
+		"PGSCV_FILTERS_DISKSTATS__DEVICE_EXCLUDE=^loop",
+		"PGSCV_RELABEL_CONFIGS_0_SOURCE_LABELS=datname",
+		"PGSCV_RELABEL_CONFIGS_0_REGEX=template.*",
+		"PGSCV_RELABEL_CONFIGS_0_ACTION=drop",
+		"PGSCV_RELABEL_CONFIGS_1_TARGET_LABEL=env",
+		"PGSCV_DESTINATIONS_0_NAME=vm",
+		"PGSCV_DESTINATIONS_0_MAX_RETRIES=3",
+		"PGSCV_PROBE_MODULES_BASIC_COLLECTORS=postgres/pgscv,postgres/databases",
+		"PGSCV_CONFIG_FILE=/etc/pgscv.yaml", // handled by flags
+		"PGSCV_UNKNOWN=value",
+	}
+
+	assert.NoError(t, applyEnv(config, environ))
+	assert.Equal(t, &Config{
+		ListenAddress:        "0.0.0.0:9890",
+		NoTrackMode:          true,
+		AutoUpdate:           true,
+		MaxConcurrentScrapes: 5,
+		ShutdownTimeout:      30 * time.Second,
+		DisableCollectors:    []string{"system/cpu", "postgres/logs"},
+		Defaults:             map[string]string{"postgres_username": "monitoring", "postgres_password": "secret=with=equals"},
+		TLSServerConfig:      TLSServerConfig{CertFile: "/etc/pgscv/server.crt"},
+		CardinalityLimits:    collector.CardinalityLimits{MaxSeriesPerMetric: 1000},
+		ServicesConnSettings: []service.ConnSetting{
+			{ServiceType: "postgres", Conninfo: "host=127.0.0.1 port=5432", Overrides: service.Overrides{
+				DisableCollectors: []string{"postgres/logs"}, Labels: map[string]string{"cluster": "main"},
+			}},
+			{ServiceType: "pgbouncer", Conninfo: "host=127.0.0.1 port=6432 dbname=pgbouncer"},
+		},
+		DiscoveryRules: []service.DiscoveryRule{
+			{Port: 5433, Overrides: service.Overrides{Labels: map[string]string{"role": "replica"}}},
+		},
+		FileSD:      service.FileSDConfig{Files: []string{"/etc/pgscv/targets/*.yaml"}, RefreshInterval: time.Minute},
+		Healthcheck: service.HealthcheckConfig{FailureThreshold: 3, KeepStatic: true},
+		Collectors: collector.CollectorsSettings{
+			"postgres/statements":        {Timeout: 5 * time.Second, Interval: time.Minute},
+			"postgres/replication_slots": {Interval: time.Minute},
+		},
+		Filters: filter.Filters{"diskstats/device": {Exclude: "^loop"}},
+		RelabelConfigs: relabel.Configs{
+			{SourceLabels: []string{"datname"}, Separator: ";", Regex: "template.*", Replacement: "$1", Action: "drop"},
+			{Separator: ";", Regex: "(.*)", TargetLabel: "env", Replacement: "$1", Action: "replace"},
+		},
+		Destinations: []Destination{{Name: "vm", MaxRetries: 3}},
+		ProbeModules: map[string]ProbeModule{"basic": {Collectors: []string{"postgres/pgscv", "postgres/databases"}}},
+	}, config)
+
+	// Invalid values.
+	for _, kv := range []string{
+		"PGSCV_NO_TRACK_MODE=maybe",
+		"PGSCV_MAX_CONCURRENT_SCRAPES=many",
+		"PGSCV_SHUTDOWN_TIMEOUT=10",
+		"PGSCV_SERVICES_X_CONNINFO=host=127.0.0.1",
+		"PGSCV_SERVICES_1_CONNINFO=host=127.0.0.1", // gap in indexes
+		"PGSCV_SERVICES=host=127.0.0.1",
+		"PGSCV_DEFAULTS=postgres",
+	} {
+		assert.Error(t, applyEnv(&Config{}, []string{kv}), kv)
+	}
+}
+
+func Test_lessEnvNames(t *testing.T) {
+	names := []string{"PGSCV_SERVICES_10_CONNINFO", "PGSCV_SERVICES_2_CONNINFO", "PGSCV_SERVICES_1_SERVICE_TYPE", "PGSCV_SERVICES_1_CONNINFO", "PGSCV_LISTEN_ADDRESS"}
+	sort.Slice(names, func(i, j int) bool { return lessEnvNames(names[i], names[j]) })
+	assert.Equal(t, []string{"PGSCV_LISTEN_ADDRESS", "PGSCV_SERVICES_1_CONNINFO", "PGSCV_SERVICES_1_SERVICE_TYPE", "PGSCV_SERVICES_2_CONNINFO", "PGSCV_SERVICES_10_CONNINFO"}, names)
+}
+
+func TestNewConfig_Env(t *testing.T) {
+	assert.NoError(t, os.Setenv("PGSCV_LISTEN_ADDRESS", "127.0.0.1:19890"))
+	defer func() { assert.NoError(t, os.Unsetenv("PGSCV_LISTEN_ADDRESS")) }()
+
+	// Environment overrides settings from config file.
+	config, err := NewConfig("testdata/pgscv-pull-example.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:19890", config.ListenAddress)
+
+	// Environment is used without config file.
+	config, err = NewConfig("")
+	assert.NoError(t, err)
+	assert.Equal(t, "127.0.0.1:19890", config.ListenAddress)
+
+	assert.NoError(t, os.Setenv("PGSCV_NO_TRACK_MODE", "invalid"))
+	defer func() { assert.NoError(t, os.Unsetenv("PGSCV_NO_TRACK_MODE")) }()
+
+	_, err = NewConfig("")
+	assert.Error(t, err)
+}
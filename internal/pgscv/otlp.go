@@ -0,0 +1,359 @@
+package pgscv
+
+import (
+	"bytes"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"sort"
+	"time"
+)
+
+// OTLP metrics protocol is described in https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/metrics/v1/metrics.proto
+// and https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/collector/metrics/v1/metrics_service.proto.
+// As for remote write, messages are encoded by hand using protowire.
+
+// Kinds of OTLP metrics, values are the numbers of corresponding fields in 'Metric' message.
+const (
+	otlpGauge     protowire.Number = 5
+	otlpSum       protowire.Number = 7
+	otlpHistogram protowire.Number = 9
+	otlpSummary   protowire.Number = 11
+)
+
+// otlpTemporalityCumulative is the value of AGGREGATION_TEMPORALITY_CUMULATIVE, Prometheus counters are cumulative.
+const otlpTemporalityCumulative = 2
+
+// otlpResourceLabels defines constant labels which are converted to resource attributes.
+var otlpResourceLabels = []string{"instance", "service_id"}
+
+// otlpAttribute is the representation of 'KeyValue' message with string value.
+type otlpAttribute struct {
+	key   string
+	value string
+}
+
+// otlpQuantile is the representation of 'ValueAtQuantile' message.
+type otlpQuantile struct {
+	quantile float64
+	value    float64
+}
+
+// otlpDataPoint is the representation of 'NumberDataPoint', 'HistogramDataPoint' and 'SummaryDataPoint' messages.
+type otlpDataPoint struct {
+	attributes   []otlpAttribute
+	timestamp    int64          // time in unix nanoseconds
+	value        float64        // value of gauges and sums
+	count        uint64         // count of histograms and summaries
+	sum          float64        // sum of histograms and summaries
+	bucketCounts []uint64       // non-cumulative counts of histogram buckets
+	bounds       []float64      // upper bounds of histogram buckets, except +Inf
+	quantiles    []otlpQuantile // quantiles of summaries
+}
+
+// otlpMetric is the representation of 'Metric' message.
+type otlpMetric struct {
+	name        string
+	description string
+	kind        protowire.Number
+	points      []otlpDataPoint
+}
+
+// otlpResourceMetrics is the representation of 'ResourceMetrics' message with single 'ScopeMetrics'.
+type otlpResourceMetrics struct {
+	attributes []otlpAttribute
+	metrics    []otlpMetric
+}
+
+// newOTLPRequest parses metrics in text exposition format and returns protobuf-encoded OTLP export metrics request.
+// Passed timestamp is used for samples which have no explicit timestamps.
+func newOTLPRequest(buf []byte, ts time.Time) ([]byte, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	return marshalExportMetricsRequest(familiesToResourceMetrics(families, ts.UnixNano())), nil
+}
+
+// familiesToResourceMetrics converts metric families to OTLP metrics grouped by resources. Resources are distinguished
+// by values of 'instance' and 'service_id' labels. Counters are converted to cumulative monotonic sums, gauges and
+// untyped metrics are converted to gauges.
+func familiesToResourceMetrics(families map[string]*dto.MetricFamily, defaultTs int64) []otlpResourceMetrics {
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var resources []otlpResourceMetrics
+	resourceIdx := map[string]int{} // resource key -> position in resources
+	metricIdx := map[string]int{}   // resource key and metric name -> position in resource's metrics
+	kinds := map[dto.MetricType]protowire.Number{
+		dto.MetricType_COUNTER:   otlpSum,
+		dto.MetricType_GAUGE:     otlpGauge,
+		dto.MetricType_UNTYPED:   otlpGauge,
+		dto.MetricType_HISTOGRAM: otlpHistogram,
+		dto.MetricType_SUMMARY:   otlpSummary,
+	}
+
+	for _, name := range names {
+		mf := families[name]
+		kind, ok := kinds[mf.GetType()]
+		if !ok {
+			continue
+		}
+
+		for _, m := range mf.GetMetric() {
+			resourceAttrs, attrs := splitResourceLabels(m.GetLabel())
+
+			var key string
+			for _, a := range resourceAttrs {
+				key += a.key + "\xff" + a.value + "\xff"
+			}
+
+			ri, ok := resourceIdx[key]
+			if !ok {
+				ri = len(resources)
+				resourceIdx[key] = ri
+				attributes := append([]otlpAttribute{{key: "service.name", value: "pgscv"}}, resourceAttrs...)
+				resources = append(resources, otlpResourceMetrics{attributes: attributes})
+			}
+
+			mi, ok := metricIdx[key+name]
+			if !ok {
+				mi = len(resources[ri].metrics)
+				metricIdx[key+name] = mi
+				resources[ri].metrics = append(resources[ri].metrics, otlpMetric{name: name, description: mf.GetHelp(), kind: kind})
+			}
+
+			ts := defaultTs
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs() * int64(time.Millisecond)
+			}
+
+			p := newOTLPDataPoint(mf.GetType(), m, attrs, ts)
+			resources[ri].metrics[mi].points = append(resources[ri].metrics[mi].points, p)
+		}
+	}
+
+	return resources
+}
+
+// splitResourceLabels splits metric labels into resource attributes and data point attributes.
+func splitResourceLabels(pairs []*dto.LabelPair) ([]otlpAttribute, []otlpAttribute) {
+	var resourceAttrs, attrs []otlpAttribute
+
+	for _, name := range otlpResourceLabels {
+		for _, lp := range pairs {
+			if lp.GetName() == name {
+				resourceAttrs = append(resourceAttrs, otlpAttribute{key: name, value: lp.GetValue()})
+			}
+		}
+	}
+
+	for _, lp := range pairs {
+		if !stringsContains(otlpResourceLabels, lp.GetName()) {
+			attrs = append(attrs, otlpAttribute{key: lp.GetName(), value: lp.GetValue()})
+		}
+	}
+
+	return resourceAttrs, attrs
+}
+
+// newOTLPDataPoint creates data point from the metric of specified type.
+func newOTLPDataPoint(t dto.MetricType, m *dto.Metric, attrs []otlpAttribute, ts int64) otlpDataPoint {
+	p := otlpDataPoint{attributes: attrs, timestamp: ts}
+
+	switch t {
+	case dto.MetricType_COUNTER:
+		p.value = m.GetCounter().GetValue()
+	case dto.MetricType_GAUGE:
+		p.value = m.GetGauge().GetValue()
+	case dto.MetricType_UNTYPED:
+		p.value = m.GetUntyped().GetValue()
+	case dto.MetricType_SUMMARY:
+		s := m.GetSummary()
+		p.count, p.sum = s.GetSampleCount(), s.GetSampleSum()
+		for _, q := range s.GetQuantile() {
+			p.quantiles = append(p.quantiles, otlpQuantile{quantile: q.GetQuantile(), value: q.GetValue()})
+		}
+	case dto.MetricType_HISTOGRAM:
+		h := m.GetHistogram()
+		p.count, p.sum = h.GetSampleCount(), h.GetSampleSum()
+
+		// Prometheus buckets are cumulative, OTLP buckets are not. Last OTLP bucket is implicitly bounded by +Inf.
+		var prev uint64
+		for _, b := range h.GetBucket() {
+			if math.IsInf(b.GetUpperBound(), +1) {
+				continue
+			}
+			p.bounds = append(p.bounds, b.GetUpperBound())
+			p.bucketCounts = append(p.bucketCounts, b.GetCumulativeCount()-prev)
+			prev = b.GetCumulativeCount()
+		}
+		p.bucketCounts = append(p.bucketCounts, h.GetSampleCount()-prev)
+	}
+
+	return p
+}
+
+// marshalExportMetricsRequest encodes resources metrics into 'ExportMetricsServiceRequest' protobuf message.
+func marshalExportMetricsRequest(resources []otlpResourceMetrics) []byte {
+	var b []byte
+	for _, r := range resources {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalResourceMetrics(r))
+	}
+	return b
+}
+
+// marshalResourceMetrics encodes resource metrics into 'ResourceMetrics' protobuf message.
+func marshalResourceMetrics(r otlpResourceMetrics) []byte {
+	// Resource message.
+	var rb []byte
+	for _, a := range r.attributes {
+		rb = appendOTLPAttribute(rb, 1, a)
+	}
+
+	// ScopeMetrics message with InstrumentationScope.
+	var scope []byte
+	scope = protowire.AppendTag(scope, 1, protowire.BytesType)
+	scope = protowire.AppendString(scope, "pgscv")
+
+	var sb []byte
+	sb = protowire.AppendTag(sb, 1, protowire.BytesType)
+	sb = protowire.AppendBytes(sb, scope)
+	for _, m := range r.metrics {
+		sb = protowire.AppendTag(sb, 2, protowire.BytesType)
+		sb = protowire.AppendBytes(sb, marshalOTLPMetric(m))
+	}
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, rb)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, sb)
+
+	return b
+}
+
+// marshalOTLPMetric encodes metric into 'Metric' protobuf message.
+func marshalOTLPMetric(m otlpMetric) []byte {
+	var data []byte
+	for _, p := range m.points {
+		data = protowire.AppendTag(data, 1, protowire.BytesType)
+		data = protowire.AppendBytes(data, marshalOTLPDataPoint(m.kind, p))
+	}
+
+	switch m.kind {
+	case otlpSum:
+		data = protowire.AppendTag(data, 2, protowire.VarintType)
+		data = protowire.AppendVarint(data, otlpTemporalityCumulative)
+		data = protowire.AppendTag(data, 3, protowire.VarintType)
+		data = protowire.AppendVarint(data, 1) // is_monotonic
+	case otlpHistogram:
+		data = protowire.AppendTag(data, 2, protowire.VarintType)
+		data = protowire.AppendVarint(data, otlpTemporalityCumulative)
+	}
+
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, m.name)
+	if m.description != "" {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, m.description)
+	}
+	b = protowire.AppendTag(b, m.kind, protowire.BytesType)
+	b = protowire.AppendBytes(b, data)
+
+	return b
+}
+
+// marshalOTLPDataPoint encodes data point into protobuf message depending on the kind of metric.
+func marshalOTLPDataPoint(kind protowire.Number, p otlpDataPoint) []byte {
+	var b []byte
+
+	// Number of 'attributes' field is different in data point messages.
+	attrsNum := protowire.Number(7)
+	if kind == otlpHistogram {
+		attrsNum = 9
+	}
+	for _, a := range p.attributes {
+		b = appendOTLPAttribute(b, attrsNum, a)
+	}
+
+	b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(p.timestamp))
+
+	switch kind {
+	case otlpGauge, otlpSum:
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(p.value))
+	case otlpHistogram:
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, p.count)
+		b = protowire.AppendTag(b, 5, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(p.sum))
+
+		var counts, bounds []byte
+		for _, c := range p.bucketCounts {
+			counts = protowire.AppendFixed64(counts, c)
+		}
+		for _, v := range p.bounds {
+			bounds = protowire.AppendFixed64(bounds, math.Float64bits(v))
+		}
+		b = protowire.AppendTag(b, 6, protowire.BytesType)
+		b = protowire.AppendBytes(b, counts)
+		if len(bounds) > 0 {
+			b = protowire.AppendTag(b, 7, protowire.BytesType)
+			b = protowire.AppendBytes(b, bounds)
+		}
+	case otlpSummary:
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, p.count)
+		b = protowire.AppendTag(b, 5, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(p.sum))
+
+		for _, q := range p.quantiles {
+			var qb []byte
+			qb = protowire.AppendTag(qb, 1, protowire.Fixed64Type)
+			qb = protowire.AppendFixed64(qb, math.Float64bits(q.quantile))
+			qb = protowire.AppendTag(qb, 2, protowire.Fixed64Type)
+			qb = protowire.AppendFixed64(qb, math.Float64bits(q.value))
+
+			b = protowire.AppendTag(b, 6, protowire.BytesType)
+			b = protowire.AppendBytes(b, qb)
+		}
+	}
+
+	return b
+}
+
+// appendOTLPAttribute appends attribute encoded as 'KeyValue' message with string 'AnyValue' as the field with specified number.
+func appendOTLPAttribute(b []byte, num protowire.Number, a otlpAttribute) []byte {
+	var value []byte
+	value = protowire.AppendTag(value, 1, protowire.BytesType)
+	value = protowire.AppendString(value, a.value)
+
+	var kv []byte
+	kv = protowire.AppendTag(kv, 1, protowire.BytesType)
+	kv = protowire.AppendString(kv, a.key)
+	kv = protowire.AppendTag(kv, 2, protowire.BytesType)
+	kv = protowire.AppendBytes(kv, value)
+
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, kv)
+}
+
+// stringsContains returns true if slice contains the string.
+func stringsContains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
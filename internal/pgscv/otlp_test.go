@@ -0,0 +1,260 @@
+package pgscv
+
+import (
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"testing"
+	"time"
+)
+
+func Test_newOTLPRequest(t *testing.T) {
+	buf := []byte(`# HELP example_counter Example counter.
+# TYPE example_counter counter
+example_counter{instance="test",service_id="system:0"} 10
+# HELP example_gauge Example gauge.
+# TYPE example_gauge gauge
+example_gauge{instance="test",service_id="system:0",device="sda"} 0.5
+example_gauge{instance="test",service_id="postgres:5432",device="sda"} 1.5
+# HELP example_summary Example summary.
+# TYPE example_summary summary
+example_summary{quantile="0.5"} 1
+example_summary_sum 5
+example_summary_count 4
+`)
+
+	ts := time.Unix(1600000000, 0)
+	payload, err := newOTLPRequest(buf, ts)
+	assert.NoError(t, err)
+
+	tsNano := ts.UnixNano()
+	assert.Equal(t, []otlpResourceMetrics{
+		{
+			attributes: []otlpAttribute{{"service.name", "pgscv"}, {"instance", "test"}, {"service_id", "system:0"}},
+			metrics: []otlpMetric{
+				{name: "example_counter", description: "Example counter.", kind: otlpSum, points: []otlpDataPoint{{timestamp: tsNano, value: 10}}},
+				{name: "example_gauge", description: "Example gauge.", kind: otlpGauge, points: []otlpDataPoint{
+					{attributes: []otlpAttribute{{"device", "sda"}}, timestamp: tsNano, value: 0.5},
+				}},
+			},
+		},
+		{
+			attributes: []otlpAttribute{{"service.name", "pgscv"}, {"instance", "test"}, {"service_id", "postgres:5432"}},
+			metrics: []otlpMetric{
+				{name: "example_gauge", description: "Example gauge.", kind: otlpGauge, points: []otlpDataPoint{
+					{attributes: []otlpAttribute{{"device", "sda"}}, timestamp: tsNano, value: 1.5},
+				}},
+			},
+		},
+		{
+			attributes: []otlpAttribute{{"service.name", "pgscv"}},
+			metrics: []otlpMetric{
+				{name: "example_summary", description: "Example summary.", kind: otlpSummary, points: []otlpDataPoint{
+					{timestamp: tsNano, count: 4, sum: 5, quantiles: []otlpQuantile{{0.5, 1}}},
+				}},
+			},
+		},
+	}, unmarshalExportMetricsRequest(t, payload))
+
+	// invalid input
+	_, err = newOTLPRequest([]byte("invalid input"), ts)
+	assert.Error(t, err)
+}
+
+func Test_familiesToResourceMetrics(t *testing.T) {
+	name, le1, le2, le3 := "example_histogram", 0.1, 1.0, math.Inf(+1)
+	count1, count2, count3, sum, total := uint64(1), uint64(3), uint64(4), 1.5, uint64(4)
+	htype, ts := dto.MetricType_HISTOGRAM, int64(1000)
+
+	families := map[string]*dto.MetricFamily{
+		name: {
+			Name: &name,
+			Type: &htype,
+			Metric: []*dto.Metric{
+				{
+					Histogram: &dto.Histogram{
+						SampleCount: &total,
+						SampleSum:   &sum,
+						Bucket: []*dto.Bucket{
+							{CumulativeCount: &count1, UpperBound: &le1},
+							{CumulativeCount: &count2, UpperBound: &le2},
+							{CumulativeCount: &count3, UpperBound: &le3},
+						},
+					},
+					TimestampMs: &ts,
+				},
+			},
+		},
+	}
+
+	resources := familiesToResourceMetrics(families, 2000)
+	assert.Equal(t, []otlpResourceMetrics{
+		{
+			attributes: []otlpAttribute{{"service.name", "pgscv"}},
+			metrics: []otlpMetric{
+				{name: "example_histogram", kind: otlpHistogram, points: []otlpDataPoint{
+					{timestamp: 1000 * int64(time.Millisecond), count: 4, sum: 1.5, bucketCounts: []uint64{1, 2, 1}, bounds: []float64{0.1, 1}},
+				}},
+			},
+		},
+	}, resources)
+
+	// Encoded histogram should be decoded into the same data.
+	assert.Equal(t, resources, unmarshalExportMetricsRequest(t, marshalExportMetricsRequest(resources)))
+}
+
+// unmarshalExportMetricsRequest decodes 'ExportMetricsServiceRequest' protobuf message.
+func unmarshalExportMetricsRequest(t *testing.T, b []byte) []otlpResourceMetrics {
+	var resources []otlpResourceMetrics
+
+	for _, rm := range unmarshalRepeatedFields(t, b)[1] {
+		var r otlpResourceMetrics
+		fields := unmarshalRepeatedFields(t, rm.([]byte))
+
+		for _, res := range fields[1] {
+			for _, kv := range unmarshalRepeatedFields(t, res.([]byte))[1] {
+				r.attributes = append(r.attributes, unmarshalOTLPAttribute(t, kv.([]byte)))
+			}
+		}
+
+		for _, sm := range fields[2] {
+			scopeFields := unmarshalRepeatedFields(t, sm.([]byte))
+			assert.Equal(t, "pgscv", string(unmarshalFields(t, scopeFields[1][0].([]byte))[1].([]byte)))
+
+			for _, m := range scopeFields[2] {
+				r.metrics = append(r.metrics, unmarshalOTLPMetric(t, m.([]byte)))
+			}
+		}
+
+		resources = append(resources, r)
+	}
+
+	return resources
+}
+
+// unmarshalOTLPMetric decodes 'Metric' protobuf message.
+func unmarshalOTLPMetric(t *testing.T, b []byte) otlpMetric {
+	var m otlpMetric
+	fields := unmarshalRepeatedFields(t, b)
+
+	m.name = string(fields[1][0].([]byte))
+	if len(fields[2]) > 0 {
+		m.description = string(fields[2][0].([]byte))
+	}
+
+	for _, kind := range []protowire.Number{otlpGauge, otlpSum, otlpHistogram, otlpSummary} {
+		if len(fields[kind]) == 0 {
+			continue
+		}
+		m.kind = kind
+
+		data := unmarshalRepeatedFields(t, fields[kind][0].([]byte))
+		switch kind {
+		case otlpSum:
+			assert.Equal(t, uint64(otlpTemporalityCumulative), data[2][0])
+			assert.Equal(t, uint64(1), data[3][0])
+		case otlpHistogram:
+			assert.Equal(t, uint64(otlpTemporalityCumulative), data[2][0])
+		}
+
+		for _, p := range data[1] {
+			m.points = append(m.points, unmarshalOTLPDataPoint(t, kind, p.([]byte)))
+		}
+	}
+
+	return m
+}
+
+// unmarshalOTLPDataPoint decodes data point protobuf message depending on the kind of metric.
+func unmarshalOTLPDataPoint(t *testing.T, kind protowire.Number, b []byte) otlpDataPoint {
+	var p otlpDataPoint
+	fields := unmarshalRepeatedFields(t, b)
+
+	attrsNum := protowire.Number(7)
+	if kind == otlpHistogram {
+		attrsNum = 9
+	}
+	for _, kv := range fields[attrsNum] {
+		p.attributes = append(p.attributes, unmarshalOTLPAttribute(t, kv.([]byte)))
+	}
+
+	p.timestamp = int64(fields[3][0].(uint64))
+
+	switch kind {
+	case otlpGauge, otlpSum:
+		p.value = math.Float64frombits(fields[4][0].(uint64))
+	case otlpHistogram:
+		p.count = fields[4][0].(uint64)
+		p.sum = math.Float64frombits(fields[5][0].(uint64))
+
+		counts := fields[6][0].([]byte)
+		for len(counts) > 0 {
+			v, n := protowire.ConsumeFixed64(counts)
+			assert.Greater(t, n, 0)
+			p.bucketCounts, counts = append(p.bucketCounts, v), counts[n:]
+		}
+
+		if len(fields[7]) > 0 {
+			bounds := fields[7][0].([]byte)
+			for len(bounds) > 0 {
+				v, n := protowire.ConsumeFixed64(bounds)
+				assert.Greater(t, n, 0)
+				p.bounds, bounds = append(p.bounds, math.Float64frombits(v)), bounds[n:]
+			}
+		}
+	case otlpSummary:
+		p.count = fields[4][0].(uint64)
+		p.sum = math.Float64frombits(fields[5][0].(uint64))
+
+		for _, q := range fields[6] {
+			qf := unmarshalFields(t, q.([]byte))
+			p.quantiles = append(p.quantiles, otlpQuantile{
+				quantile: math.Float64frombits(qf[1].(uint64)),
+				value:    math.Float64frombits(qf[2].(uint64)),
+			})
+		}
+	}
+
+	return p
+}
+
+// unmarshalOTLPAttribute decodes 'KeyValue' protobuf message with string value.
+func unmarshalOTLPAttribute(t *testing.T, b []byte) otlpAttribute {
+	fields := unmarshalFields(t, b)
+	value := unmarshalFields(t, fields[2].([]byte))
+
+	return otlpAttribute{key: string(fields[1].([]byte)), value: string(value[1].([]byte))}
+}
+
+// unmarshalRepeatedFields decodes protobuf message with bytes, fixed64 and varint fields, which might be repeated.
+func unmarshalRepeatedFields(t *testing.T, b []byte) map[protowire.Number][]interface{} {
+	fields := map[protowire.Number][]interface{}{}
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		assert.Greater(t, n, 0)
+		b = b[n:]
+
+		n = protowire.ConsumeFieldValue(num, typ, b)
+		assert.Greater(t, n, 0)
+
+		switch typ {
+		case protowire.BytesType:
+			v, _ := protowire.ConsumeBytes(b)
+			fields[num] = append(fields[num], v)
+		case protowire.Fixed64Type:
+			v, _ := protowire.ConsumeFixed64(b)
+			fields[num] = append(fields[num], v)
+		case protowire.VarintType:
+			v, _ := protowire.ConsumeVarint(b)
+			fields[num] = append(fields[num], v)
+		default:
+			assert.Fail(t, "unexpected wire type")
+		}
+
+		b = b[n:]
+	}
+
+	return fields
+}
@@ -4,36 +4,47 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
 	"github.com/weaponry/pgscv/internal/log"
 	"github.com/weaponry/pgscv/internal/packaging/autoupdate"
+	"github.com/weaponry/pgscv/internal/relabel"
 	"github.com/weaponry/pgscv/internal/service"
 	"io"
 	"math"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"sort"
+	"sync"
 	"time"
 )
 
 func Start(ctx context.Context, config *Config) error {
 	log.Debug("start application")
 
+	// Own context is used for stopping listener and sender when application fails. Background tasks which change
+	// services use child context, they are stopped before listener and sender.
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	bgCtx, bgCancel := context.WithCancel(ctx)
+	defer bgCancel()
+
 	serviceRepo := service.NewRepository()
 
-	serviceConfig := service.Config{
-		NoTrackMode:        config.NoTrackMode,
-		ConnDefaults:       config.Defaults,
-		ConnSettings:       config.ServicesConnSettings,
-		Filters:            config.Filters,
-		DisabledCollectors: config.DisableCollectors,
-	}
+	serviceConfig := newServiceConfig(config)
+
+	var wg, bgWg sync.WaitGroup
 
 	if config.ServicesConnSettings == nil {
 		// run background discovery, the service repo will be fulfilled at first iteration
+		bgWg.Add(1)
 		go func() {
-			serviceRepo.StartBackgroundDiscovery(ctx, serviceConfig)
+			defer bgWg.Done()
+			serviceRepo.StartBackgroundDiscovery(bgCtx, serviceConfig)
 		}()
 	} else {
 		// fulfill service repo using passed services
@@ -42,6 +53,7 @@ func Start(ctx context.Context, config *Config) error {
 		// setup exporters for all services
 		err := serviceRepo.SetupServices(serviceConfig)
 		if err != nil {
+			serviceRepo.Close()
 			return err
 		}
 	}
@@ -53,23 +65,71 @@ func Start(ctx context.Context, config *Config) error {
 				BinaryPath:    config.BinaryPath,
 				BinaryVersion: config.BinaryVersion,
 			}
-			autoupdate.StartAutoupdateLoop(ctx, ac)
+			autoupdate.StartAutoupdateLoop(bgCtx, ac)
+		}()
+	}
+
+	// Channel is buffered for all background tasks, and never closed, because tasks might fail during draining.
+	var errCh = make(chan error, 4)
+
+	// Start HTTP metrics listener if it is not disabled.
+	if !config.DisableListener {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := runMetricsListener(ctx, config, serviceRepo); err != nil {
+				errCh <- err
+			}
+		}()
+	}
+
+	// Start file discovery if files with services definitions are specified.
+	if len(config.FileSD.Files) > 0 {
+		bgWg.Add(1)
+		go func() {
+			defer bgWg.Done()
+			if err := serviceRepo.StartFileDiscovery(bgCtx, serviceConfig); err != nil {
+				errCh <- err
+			}
 		}()
 	}
 
-	var errCh = make(chan error)
-	defer close(errCh)
+	// Start health checks of services, services which don't respond are removed or reported as down.
+	bgWg.Add(1)
+	go func() {
+		defer bgWg.Done()
+		serviceRepo.StartHealthchecks(bgCtx)
+	}()
+
+	// Start refreshing properties of services, they might be changed during services lifetime, e.g. after failover.
+	bgWg.Add(1)
+	go func() {
+		defer bgWg.Done()
+		serviceRepo.StartServicesRefresh(bgCtx)
+	}()
+
+	// Start handling of notifications sent by collectors during scrapes, e.g. about failed authentication or changed
+	// labels of services.
+	bgWg.Add(1)
+	go func() {
+		defer bgWg.Done()
+		serviceRepo.StartNotificationsHandling(bgCtx)
+	}()
 
-	// Start HTTP metrics listener.
+	// Start config reloader.
+	bgWg.Add(1)
 	go func() {
-		if err := runMetricsListener(ctx, config); err != nil {
+		defer bgWg.Done()
+		if err := runConfigReloader(bgCtx, config, serviceRepo); err != nil {
 			errCh <- err
 		}
 	}()
 
 	// Start metrics sender if necessary.
-	if config.SendMetricsURL != "" {
+	if len(config.destinations()) > 0 {
+		wg.Add(1)
 		go func() {
+			defer wg.Done()
 			if err := runSendMetricsLoop(ctx, config, serviceRepo); err != nil {
 				errCh <- err
 			}
@@ -77,178 +137,454 @@ func Start(ctx context.Context, config *Config) error {
 	}
 
 	// Waiting for errors or context cancelling.
-	for {
-		select {
-		case <-ctx.Done():
-			log.Info("exit signaled, stop application")
-			return nil
-		case err := <-errCh:
-			return err
-		}
+	var err error
+	select {
+	case <-ctx.Done():
+		log.Info("exit signaled, stop application")
+	case err = <-errCh:
+	}
+
+	// Drain: stop discovery, health checks and reloading first, hence services are not changed anymore. Then wait until
+	// listener finishes in-flight requests and sender sends current metrics and flushes spool, and close services
+	// connections at last.
+	bgCancel()
+	bgWg.Wait()
+	cancel()
+	wg.Wait()
+	serviceRepo.Close()
+
+	log.Info("application stopped")
+	return err
+}
+
+// newServiceConfig creates services configuration from application's configuration.
+func newServiceConfig(config *Config) service.Config {
+	return service.Config{
+		NoTrackMode:        config.NoTrackMode,
+		ConnDefaults:       config.Defaults,
+		ConnSettings:       config.ServicesConnSettings,
+		DiscoveryRules:     config.DiscoveryRules,
+		FileSD:             config.FileSD,
+		Filters:            config.Filters,
+		DisabledCollectors: config.DisableCollectors,
+		CollectorsSettings: config.Collectors,
+		RelabelConfigs:     config.RelabelConfigs,
+		CardinalityLimits:  config.CardinalityLimits,
+		RefreshInterval:    config.ServicesRefresh,
+		Healthcheck:        config.Healthcheck,
 	}
 }
 
-func runMetricsListener(ctx context.Context, config *Config) error {
-	log.Infof("accepting requests on http://%s/metrics", config.ListenAddress)
-
-	http.Handle("/metrics", promhttp.Handler())
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		_, err := w.Write([]byte(`<html>
-			<head><title>pgSCV / Weaponry metric collector</title></head>
-			<body>
-			<h1>pgSCV / Weaponry metric collector, for more info visit https://weaponry.io</h1>
-			<p><a href="/metrics">Metrics</a></p>
-			</body>
-			</html>`))
+func runMetricsListener(ctx context.Context, config *Config, repo *service.Repository) error {
+	mux := http.NewServeMux()
+	srv := &http.Server{
+		Addr:         config.ListenAddress,
+		Handler:      mux,
+		ReadTimeout:  config.ListenReadTimeout,
+		WriteTimeout: config.ListenWriteTimeout,
+	}
+
+	scheme := "http"
+	if config.TLSServerConfig.enabled() {
+		tlsConfig, err := newServerTLSConfig(config.TLSServerConfig)
 		if err != nil {
-			log.Warnln("response write failed: ", err)
+			return err
 		}
-	})
+		srv.TLSConfig = tlsConfig
+		scheme = "https"
+	}
+
+	if len(config.BasicAuthUsers) > 0 {
+		// Health endpoints are used by orchestrators' probes which usually can't authenticate.
+		srv.Handler = newBasicAuthHandler(config.BasicAuthUsers, srv.Handler, "/healthz", "/readyz")
+	}
+
+	log.Infof("accepting requests on %s://%s/metrics", scheme, config.ListenAddress)
+
+	// Scrapes of metrics and probes share common limit, because they use the same host resources.
+	limit := newConcurrencyLimiter(config.MaxConcurrentScrapes)
+
+	mux.Handle("/metrics", limit(newMetricsHandler(repo)))
+	mux.Handle("/probe", limit(newProbeHandler(config, repo)))
+	mux.Handle("/healthz", newHealthzHandler())
+	mux.Handle("/readyz", newReadyzHandler(repo))
+	mux.Handle("/api/v1/services", newServicesHandler(repo))
+	mux.Handle("/api/v1/collectors", newCollectorsHandler(repo))
+	mux.Handle("/", newStatusPageHandler(repo))
 
-	var errCh = make(chan error)
-	defer close(errCh)
+	// Buffered channel allows listener goroutine to exit when nobody waits for its result.
+	var errCh = make(chan error, 1)
 
 	// Run listener.
 	go func() {
-		errCh <- http.ListenAndServe(config.ListenAddress, nil)
+		if srv.TLSConfig != nil {
+			// Certificates are already loaded into TLS config.
+			errCh <- srv.ListenAndServeTLS("", "")
+		} else {
+			errCh <- srv.ListenAndServe()
+		}
 	}()
 
 	// Waiting for errors or context cancelling.
-	for {
-		select {
-		case <-ctx.Done():
-			log.Info("exit signaled, stop metrics listener")
-			return nil
-		case err := <-errCh:
-			return err
-		}
+	select {
+	case <-ctx.Done():
+		log.Info("exit signaled, stop metrics listener")
+		return shutdownServer(srv, config.ShutdownTimeout)
+	case err := <-errCh:
+		return err
 	}
 }
 
-func runSendMetricsLoop(ctx context.Context, config *Config, instanceRepo *service.Repository) error {
-	log.Infof("sending metrics to %s every %d seconds", config.SendMetricsURL, config.SendMetricsInterval/time.Second)
+// shutdownServer stops accepting new requests and waits until in-flight requests are finished. When timeout is
+// exceeded, remaining connections are closed forcibly.
+func shutdownServer(srv *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := srv.Shutdown(ctx)
+	if err == context.DeadlineExceeded {
+		log.Warnf("in-flight requests are not finished in %s, close connections", timeout)
+		return srv.Close()
+	}
+
+	return err
+}
 
+func runSendMetricsLoop(ctx context.Context, config *Config, instanceRepo *service.Repository) error {
 	// Before sending metrics wait until any services appear in the repo, else need to wait an one MetricsSendInterval.
 	// This is the one-time operation and here is using a naive approach with 'for loop + sleep' instead of channels/sync stuff.
 	log.Debugln("waiting for services appear in service repo...")
 	for {
-		time.Sleep(time.Second)
+		if !sleepContext(ctx, time.Second) {
+			log.Info("exit signaled, stop metrics sending")
+			return nil
+		}
 		if n := instanceRepo.TotalServices(); n > 0 {
 			log.Debugln("done, services found: ", n)
 			break
 		}
 	}
 
-	sendClient, err := newSendClient(config)
+	var clients []*sendClient
+	for _, d := range config.destinations() {
+		client, err := newSendClient(d, instanceRepo)
+		if err != nil {
+			return fmt.Errorf("destination %s: %s", d.Name, err)
+		}
+
+		err = prometheus.Register(client)
+		if err != nil {
+			return err
+		}
+		defer prometheus.Unregister(client)
+
+		clients = append(clients, client)
+	}
+
+	// Each destination is served in its own goroutine, hence slow destination doesn't delay the others.
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func(client *sendClient) {
+			defer wg.Done()
+			client.run(ctx, config.ShutdownTimeout)
+		}(client)
+	}
+
+	wg.Wait()
+	log.Info("exit signaled, stop metrics sending")
+	return nil
+}
+
+// sendClient ...
+type sendClient struct {
+	name           string
+	apiKey         string
+	format         string
+	username       string
+	password       string
+	bearerToken    string
+	headers        map[string]string
+	repo           *service.Repository
+	gatherer       prometheus.Gatherer
+	relabelConfigs relabel.Configs
+	writeURL       *url.URL
+	interval       time.Duration
+	timeout        time.Duration
+	maxRetries     int
+	maxBackoff     time.Duration
+	spool          *spool
+	Client         *http.Client
+
+	mu           sync.Mutex
+	success      float64 // total number of successfully sent batches
+	failures     float64 // total number of batches failed to send
+	successDesc  *prometheus.Desc
+	failuresDesc *prometheus.Desc
+}
+
+// newSendClient ...
+func newSendClient(d Destination, repo *service.Repository) (*sendClient, error) {
+	writeURL, err := url.Parse(d.URL)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	labels := prometheus.Labels{"destination": d.Name}
+
+	var sp *spool
+	if d.SpoolDirectory != "" {
+		sp, err = newSpool(d.SpoolDirectory, d.Format, d.SpoolMaxBytes, d.SpoolMaxAge, labels)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	ticker := time.NewTicker(config.SendMetricsInterval)
+	return &sendClient{
+		name:           d.Name,
+		apiKey:         d.APIKey,
+		format:         d.Format,
+		username:       d.Username,
+		password:       d.Password,
+		bearerToken:    d.BearerToken,
+		headers:        d.Headers,
+		repo:           repo,
+		gatherer:       prometheus.DefaultGatherer,
+		relabelConfigs: d.RelabelConfigs,
+		writeURL:       writeURL,
+		interval:       d.Interval,
+		timeout:        d.Timeout,
+		maxRetries:     d.MaxRetries,
+		maxBackoff:     d.MaxBackoff,
+		spool:          sp,
+		Client: &http.Client{
+			Transport: &http.Transport{
+				MaxIdleConns:    5,
+				IdleConnTimeout: 120 * time.Second,
+			},
+			Timeout: d.Timeout,
+		},
+		successDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("pgscv", "sender", "success_total"),
+			"Total number of metrics batches successfully sent to destination.",
+			nil, labels,
+		),
+		failuresDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("pgscv", "sender", "failures_total"),
+			"Total number of failed attempts of sending metrics batches to destination.",
+			nil, labels,
+		),
+	}, nil
+}
+
+// run reads and sends metrics to destination every interval until context is cancelled. Metrics which are being read
+// when context is cancelled are read and sent, and before exit, spooled metrics are flushed within shutdown timeout.
+func (s *sendClient) run(ctx context.Context, shutdownTimeout time.Duration) {
+	log.Infof("sending metrics to %s (destination %s) every %d seconds", s.writeURL.String(), s.name, s.interval/time.Second)
+
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	// Reading is not interrupted at exit, but it is limited by shutdown timeout.
+	readCtx, cancel := newDrainContext(ctx, shutdownTimeout)
+	defer cancel()
+
 	var delay time.Duration
+	var retries int
 	for {
 		if delay > 0 {
 			log.Debugf("waiting for delay %s", delay.String())
-			time.Sleep(delay)
+			if !sleepContext(ctx, delay) {
+				s.flush(shutdownTimeout)
+				return
+			}
 		}
 
-		buf, err := sendClient.readMetrics()
+		buf, err := s.readMetrics(readCtx)
 		if err != nil {
 			delay = time.Second
-			log.Infof("read metrics failed: %s, retry after %s", err, delay.String())
+			log.Infof("read metrics for destination %s failed: %s, retry after %s", s.name, err, delay.String())
 			continue
 		}
 
-		err = sendClient.sendMetrics(buf)
+		err = s.sendMetrics(buf, time.Now())
 		if err != nil {
-			delay = addDelay(delay)
-			log.Infof("send metrics failed: %s, retry after %s", err, delay.String())
-			continue
+			// Rejected metrics are never retried. Without spool retry until success or retries are exhausted, else
+			// metrics are already spooled and will be sent at next iterations.
+			if isRejected(err) {
+				log.Warnf("send metrics to destination %s failed: %s, metrics rejected and dropped", s.name, err)
+			} else if s.spool == nil {
+				retries++
+				if s.maxRetries == 0 || retries <= s.maxRetries {
+					delay = addDelay(delay)
+					if delay > s.maxBackoff {
+						delay = s.maxBackoff
+					}
+					log.Infof("send metrics to destination %s failed: %s, retry after %s", s.name, err, delay.String())
+					continue
+				}
+				log.Warnf("send metrics to destination %s failed: %s, retries exhausted, metrics dropped", s.name, err)
+			} else {
+				log.Infof("send metrics to destination %s failed: %s, metrics saved to spool and will be sent later", s.name, err)
+			}
 		}
 
-		// Reading and sending successful, reset delay.
-		delay = 0
+		// Reading and sending finished, reset delay.
+		delay, retries = 0, 0
 
 		// Sleeping for next iteration.
 		select {
 		case <-ctx.Done():
-			log.Info("exit signaled, stop metrics sending")
-			ticker.Stop()
-			return nil
+			s.flush(shutdownTimeout)
+			return
 		case <-ticker.C:
 			continue
 		}
 	}
 }
 
-// sendClient ...
-type sendClient struct {
-	apiKey   string
-	readURL  *url.URL
-	writeURL *url.URL
-	timeout  time.Duration
-	Client   *http.Client
-}
+// readMetrics collects metrics of services and application's own metrics, and encodes them in text exposition format.
+// Metrics are gathered in-process, hence metrics listener is not required.
+func (s *sendClient) readMetrics(ctx context.Context) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
 
-// newSendClient ...
-func newSendClient(config *Config) (sendClient, error) {
-	readURL, err := url.Parse("http://" + config.ListenAddress + "/metrics")
+	// Services metrics are gathered by per-read gatherer, because they depend on context.
+	gatherers := prometheus.Gatherers{s.gatherer}
+	if s.repo != nil {
+		gatherers = append(gatherers, s.repo.NewGatherer(ctx))
+	}
+
+	families, err := gatherers.Gather()
 	if err != nil {
-		return sendClient{}, err
+		// Gathering errors might be caused by particular metrics, send the rest of metrics.
+		if len(families) == 0 {
+			return nil, err
+		}
+		log.Warnf("gather metrics: %s; send the rest of metrics", err)
 	}
 
-	writeURL, err := url.Parse(config.SendMetricsURL)
+	if len(s.relabelConfigs) > 0 {
+		families = s.relabelConfigs.ProcessFamilies(families)
+	}
+
+	buf := &bytes.Buffer{}
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(buf, mf); err != nil {
+			return nil, err
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+// sendMetrics encodes scraped metrics and sends them to remote service. When spool is enabled, previously failed
+// batches are sent first, and current batch is saved to spool if sending failed.
+func (s *sendClient) sendMetrics(buf []byte, ts time.Time) error {
+	payload, err := s.encodeMetrics(buf, ts)
 	if err != nil {
-		return sendClient{}, err
+		return err
 	}
 
-	return sendClient{
-		apiKey:   config.APIKey,
-		readURL:  readURL,
-		writeURL: writeURL,
-		timeout:  10 * time.Second,
-		Client: &http.Client{
-			Transport: &http.Transport{
-				MaxIdleConns:    5,
-				IdleConnTimeout: 120 * time.Second,
-			},
-			Timeout: 10 * time.Second,
-		},
-	}, nil
+	if s.spool == nil {
+		return s.send(payload)
+	}
+
+	err = s.spool.replay(s.send)
+	if err == nil {
+		err = s.send(payload)
+		if err == nil || isRejected(err) {
+			return err
+		}
+	}
+
+	if serr := s.spool.push(ts, payload); serr != nil {
+		return fmt.Errorf("%s; save metrics to spool failed: %s", err, serr)
+	}
+
+	return err
 }
 
-// readMetrics ...
-func (s *sendClient) readMetrics() ([]byte, error) {
-	resp, err := http.Get(s.readURL.String())
+// flush sends metrics saved in spool before exit, sending is stopped when timeout is exceeded. Metrics which are not
+// sent are kept in spool and will be sent after restart.
+func (s *sendClient) flush(timeout time.Duration) {
+	if s.spool == nil {
+		return
+	}
+
+	deadline := time.Now().Add(timeout)
+	err := s.spool.replay(func(payload []byte) error {
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timeout %s exceeded", timeout)
+		}
+		return s.send(payload)
+	})
 	if err != nil {
-		return nil, err
+		log.Warnf("flush spooled metrics failed: %s; metrics will be sent after restart", err)
 	}
+}
 
-	body, err := io.ReadAll(resp.Body)
+// encodeMetrics converts scraped metrics into the format accepted by remote service.
+func (s *sendClient) encodeMetrics(buf []byte, ts time.Time) ([]byte, error) {
+	switch s.format {
+	case sendFormatRemoteWrite:
+		// Remote write receivers accept snappy-compressed protobuf messages.
+		return newRemoteWriteRequest(buf, ts)
+	case sendFormatOTLP:
+		// OTLP receivers accept protobuf messages, samples have explicit timestamps.
+		return newOTLPRequest(buf, ts)
+	default:
+		// Spooled metrics might be sent much later than they have been collected, add explicit timestamps.
+		if s.spool != nil {
+			return addTimestamps(buf, ts)
+		}
+		return buf, nil
+	}
+}
+
+// addTimestamps parses metrics in text exposition format and adds explicit timestamps to samples without them.
+func addTimestamps(buf []byte, ts time.Time) ([]byte, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(buf))
 	if err != nil {
 		return nil, err
 	}
 
-	defer func() {
-		_, _ = io.Copy(io.Discard, resp.Body)
-		_ = resp.Body.Close()
-	}()
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	ms := ts.UnixNano() / int64(time.Millisecond)
+	out := &bytes.Buffer{}
+
+	for _, name := range names {
+		for _, m := range families[name].GetMetric() {
+			if m.TimestampMs == nil {
+				m.TimestampMs = &ms
+			}
+		}
 
-	return body, nil
+		_, err := expfmt.MetricFamilyToText(out, families[name])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return out.Bytes(), nil
 }
 
-// sendMetrics ...
-func (s *sendClient) sendMetrics(buf []byte) error {
+// send makes HTTP request with metrics payload to remote service.
+func (s *sendClient) send(payload []byte) error {
 	log.Debugln("start sending metrics")
 
-	req, err := http.NewRequest("POST", s.writeURL.String(), bytes.NewReader(buf))
+	req, err := http.NewRequest("POST", s.writeURL.String(), bytes.NewReader(payload))
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Content-Type", "application/text")
-	req.Header.Set("User-Agent", "pgSCV")
-	req.Header.Add("X-Weaponry-Api-Key", s.apiKey)
+	s.setHeaders(req)
 
 	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
 	defer cancel()
@@ -257,6 +593,7 @@ func (s *sendClient) sendMetrics(buf []byte) error {
 
 	resp, err := s.Client.Do(req)
 	if err != nil {
+		s.count(false)
 		return err
 	}
 
@@ -266,18 +603,144 @@ func (s *sendClient) sendMetrics(buf []byte) error {
 	}()
 
 	if resp.StatusCode/100 != 2 {
+		s.count(false)
 		scanner := bufio.NewScanner(io.LimitReader(resp.Body, 512))
 		line := ""
 		if scanner.Scan() {
 			line = scanner.Text()
 		}
-		return fmt.Errorf("server returned HTTP status %s: %s", resp.Status, line)
+		err = fmt.Errorf("server returned HTTP status %s: %s", resp.Status, line)
+
+		// Client errors (except throttling) mean the batch is invalid, e.g. samples are too old, and retrying it
+		// never succeeds.
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			return &rejectedError{err: err}
+		}
+		return err
 	}
 
+	s.count(true)
 	log.Debugln("sending metrics finished successfully: server returned HTTP status ", resp.Status)
 	return nil
 }
 
+// rejectedError is the error returned when destination rejected the batch permanently.
+type rejectedError struct {
+	err error
+}
+
+// Error implements error interface.
+func (e *rejectedError) Error() string {
+	return e.err.Error()
+}
+
+// isRejected returns true if the batch has been rejected by destination and should not be sent again.
+func isRejected(err error) bool {
+	var re *rejectedError
+	return errors.As(err, &re)
+}
+
+// count increments counters of sent batches.
+func (s *sendClient) count(success bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if success {
+		s.success++
+	} else {
+		s.failures++
+	}
+}
+
+// Describe implements prometheus.Collector interface.
+func (s *sendClient) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.successDesc
+	ch <- s.failuresDesc
+
+	if s.spool != nil {
+		s.spool.Describe(ch)
+	}
+}
+
+// Collect implements prometheus.Collector interface.
+func (s *sendClient) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	success, failures := s.success, s.failures
+	s.mu.Unlock()
+
+	ch <- prometheus.MustNewConstMetric(s.successDesc, prometheus.CounterValue, success)
+	ch <- prometheus.MustNewConstMetric(s.failuresDesc, prometheus.CounterValue, failures)
+
+	if s.spool != nil {
+		s.spool.Collect(ch)
+	}
+}
+
+// setHeaders sets format-specific, authentication and user-defined headers to the request.
+func (s *sendClient) setHeaders(req *http.Request) {
+	req.Header.Set("User-Agent", "pgSCV")
+
+	switch s.format {
+	case sendFormatRemoteWrite:
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		req.Header.Set("Content-Encoding", "snappy")
+		req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+	case sendFormatOTLP:
+		req.Header.Set("Content-Type", "application/x-protobuf")
+	default:
+		req.Header.Set("Content-Type", "application/text")
+		req.Header.Add("X-Weaponry-Api-Key", s.apiKey)
+	}
+
+	if s.username != "" || s.password != "" {
+		req.SetBasicAuth(s.username, s.password)
+	} else if s.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.bearerToken)
+	}
+
+	for k, v := range s.headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// newDrainContext creates context which is not cancelled together with parent context, but is cancelled when timeout
+// is exceeded after the parent has been cancelled. It allows to finish in-flight work at exit.
+func newDrainContext(parent context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		select {
+		case <-parent.Done():
+		case <-ctx.Done():
+			return
+		}
+
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel
+}
+
+// sleepContext pauses for passed duration or until context is cancelled. Returns false if context has been cancelled.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
 // addDelay increments passed delay to random value between 1 and 10 seconds.
 func addDelay(d time.Duration) time.Duration {
 	sec := int(math.Max(float64(d/time.Second), 1))
@@ -2,12 +2,16 @@ package pgscv
 
 import (
 	"context"
+	"fmt"
+	"github.com/golang/snappy"
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/relabel"
 	"github.com/weaponry/pgscv/internal/service"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
-	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -27,20 +31,20 @@ func TestStart(t *testing.T) {
 
 	// Create app config.
 	config := &Config{
-		ListenAddress:  "127.0.0.1:5002",
+		ListenAddress:        "127.0.0.1:5002",
+		MaxConcurrentScrapes: 10, ShutdownTimeout: time.Second,
 		APIKey:         "TEST1234TEST-TEST-1234-TEST1234",
 		SendMetricsURL: writeServer.URL, SendMetricsInterval: 1 * time.Second,
 	}
 	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 
-	// Start app, wait until context expires and do cleanup.
+	// Start app and wait until context expires.
 	assert.NoError(t, Start(ctx, config))
-	http.DefaultServeMux = new(http.ServeMux)
 }
 
 func Test_runMetricsListener(t *testing.T) {
-	config := &Config{ListenAddress: "127.0.0.1:5003"}
+	config := &Config{ListenAddress: "127.0.0.1:5003", MaxConcurrentScrapes: 10, ShutdownTimeout: time.Second}
 	wg := sync.WaitGroup{}
 
 	// Running listener function with short-live context in concurrent goroutine.
@@ -49,7 +53,7 @@ func Test_runMetricsListener(t *testing.T) {
 		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 		defer cancel()
 
-		err := runMetricsListener(ctx, config)
+		err := runMetricsListener(ctx, config, service.NewRepository())
 		assert.NoError(t, err)
 		wg.Done()
 	}()
@@ -80,37 +84,93 @@ func Test_runMetricsListener(t *testing.T) {
 
 	// Waiting for listener goroutine.
 	wg.Wait()
-
-	http.DefaultServeMux = new(http.ServeMux) // clean http environment (which may be dirtied by other concurrently running tests)
 }
 
-func Test_runSendMetricsLoop(t *testing.T) {
-	// Run test read/write servers which will accept HTTP requests.
-	readServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		assert.Equal(t, "/metrics", r.URL.String())
+func Test_shutdownServer(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
 
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
 		w.WriteHeader(http.StatusOK)
+	})}
 
-		_, err := w.Write([]byte(`"test_metric{example="example"}`))
-		assert.NoError(t, err)
-	}))
-	defer readServer.Close()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() { _ = srv.Serve(ln) }()
+
+	// In-flight request finished before timeout is served successfully.
+	respCh := make(chan error, 1)
+	go func() {
+		resp, err := http.Get("http://" + ln.Addr().String() + "/")
+		if err == nil {
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			err = resp.Body.Close()
+		}
+		respCh <- err
+	}()
+
+	<-started
+	time.AfterFunc(200*time.Millisecond, func() { close(release) })
+	assert.NoError(t, shutdownServer(srv, 5*time.Second))
+	assert.NoError(t, <-respCh)
+
+	// In-flight request not finished before timeout is interrupted.
+	release = make(chan struct{})
+	defer close(release)
+
+	srv = &http.Server{Handler: srv.Handler}
+	ln, err = net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	go func() { _ = srv.Serve(ln) }()
+
+	go func() {
+		_, err := http.Get("http://" + ln.Addr().String() + "/")
+		respCh <- err
+	}()
 
+	<-started
+	assert.NoError(t, shutdownServer(srv, 200*time.Millisecond))
+	assert.Error(t, <-respCh)
+}
+
+func Test_runSendMetricsLoop(t *testing.T) {
+	var mu sync.Mutex
+	var received, failed int
+
+	// Run test write server which will accept HTTP requests.
 	writeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		body, err := io.ReadAll(r.Body)
 		assert.NoError(t, err)
 		assert.Greater(t, len(body), 0)
 		assert.NoError(t, r.Body.Close())
 
+		mu.Lock()
+		received++
+		mu.Unlock()
+
 		w.WriteHeader(http.StatusOK)
 	}))
 	defer writeServer.Close()
 
+	// Run test server which is not available.
+	failServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		failed++
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failServer.Close()
+
 	// Prepare stuff, create repo with default 'system' service.
 	config := &Config{
-		ListenAddress:  strings.TrimPrefix(readServer.URL, "http://"),
 		APIKey:         "TEST1234TEST-TEST-1234-TEST1234",
 		SendMetricsURL: writeServer.URL, SendMetricsInterval: 600 * time.Millisecond,
+		Destinations: []Destination{
+			{Name: "unavailable", URL: failServer.URL, Format: "remote_write", Interval: time.Hour, Timeout: time.Second, MaxRetries: 1, MaxBackoff: 100 * time.Millisecond},
+		},
 	}
 	repo := service.NewRepository()
 	repo.AddServicesFromConfig(service.Config{
@@ -118,10 +178,248 @@ func Test_runSendMetricsLoop(t *testing.T) {
 		ConnDefaults: nil,
 	})
 
-	// Run sending metrics to test server.
-	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	// Run sending metrics to test servers, unavailable destination should not delay sending to available one.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
 	defer cancel()
 	assert.NoError(t, runSendMetricsLoop(ctx, config, repo))
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Greater(t, received, 0)
+	assert.Equal(t, 2, failed) // initial attempt and single retry
+}
+
+func Test_sendClient_RemoteWrite(t *testing.T) {
+	writeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "snappy", r.Header.Get("Content-Encoding"))
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "example", r.Header.Get("X-Scope-OrgID"))
+		assert.Empty(t, r.Header.Get("X-Weaponry-Api-Key"))
+
+		username, password, ok := r.BasicAuth()
+		assert.True(t, ok)
+		assert.Equal(t, "user", username)
+		assert.Equal(t, "pass", password)
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, r.Body.Close())
+
+		decoded, err := snappy.Decode(nil, body)
+		assert.NoError(t, err)
+
+		series := unmarshalWriteRequest(t, decoded)
+		assert.Len(t, series, 1)
+		assert.Equal(t, []rwLabel{{"__name__", "test_metric"}, {"example", "example"}}, series[0].labels)
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer writeServer.Close()
+
+	d := Destination{
+		Name:     "test",
+		URL:      writeServer.URL,
+		Format:   "remote_write",
+		Username: "user",
+		Password: "pass",
+		Headers:  map[string]string{"X-Scope-OrgID": "example"},
+	}
+	assert.NoError(t, d.validate())
+
+	client, err := newSendClient(d, nil)
+	assert.NoError(t, err)
+	client.gatherer = newTestGatherer(prometheus.GaugeValue, prometheus.Labels{"example": "example"})
+
+	buf, err := client.readMetrics(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, client.sendMetrics(buf, time.Now()))
+}
+
+func Test_sendClient_OTLP(t *testing.T) {
+	// Run OTLP stub which will accept HTTP requests.
+	otlpServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/metrics", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		assert.Empty(t, r.Header.Get("X-Weaponry-Api-Key"))
+
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, r.Body.Close())
+
+		resources := unmarshalExportMetricsRequest(t, body)
+		assert.Len(t, resources, 1)
+		assert.Equal(t, []otlpAttribute{{"service.name", "pgscv"}, {"instance", "test"}, {"service_id", "system:0"}}, resources[0].attributes)
+		assert.Len(t, resources[0].metrics, 1)
+		assert.Equal(t, otlpSum, resources[0].metrics[0].kind)
+		assert.Equal(t, []otlpAttribute{{"example", "example"}}, resources[0].metrics[0].points[0].attributes)
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer otlpServer.Close()
+
+	d := Destination{Name: "test", URL: otlpServer.URL + "/v1/metrics", Format: "otlp", BearerToken: "token"}
+	assert.NoError(t, d.validate())
+
+	client, err := newSendClient(d, nil)
+	assert.NoError(t, err)
+	client.gatherer = newTestGatherer(prometheus.CounterValue, prometheus.Labels{"instance": "test", "service_id": "system:0", "example": "example"})
+
+	buf, err := client.readMetrics(context.Background())
+	assert.NoError(t, err)
+	assert.NoError(t, client.sendMetrics(buf, time.Now()))
+}
+
+func Test_sendClient_readMetrics(t *testing.T) {
+	d := Destination{Name: "test", URL: "http://127.0.0.1:1", APIKey: "TEST1234TEST-TEST-1234-TEST1234"}
+	assert.NoError(t, d.validate())
+
+	client, err := newSendClient(d, nil)
+	assert.NoError(t, err)
+	client.gatherer = newTestGatherer(prometheus.GaugeValue, prometheus.Labels{"example": "example"})
+
+	buf, err := client.readMetrics(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "# HELP test_metric Test metric.\n# TYPE test_metric gauge\ntest_metric{example=\"example\"} 1\n", string(buf))
+
+	// Metrics of services are gathered too.
+	repo := service.NewRepository()
+	repo.AddServicesFromConfig(service.Config{})
+	assert.NoError(t, repo.SetupServices(service.Config{}))
+
+	client, err = newSendClient(d, repo)
+	assert.NoError(t, err)
+
+	buf, err = client.readMetrics(context.Background())
+	assert.NoError(t, err)
+	assert.Contains(t, string(buf), `service_id="system:0"`)
+	assert.Contains(t, string(buf), "go_goroutines")
+
+	// Relabeling rules of destination are applied to gathered metrics.
+	d.RelabelConfigs = relabel.Configs{
+		{SourceLabels: []string{"__name__"}, Regex: "go_.*", Action: "drop"},
+		{SourceLabels: []string{"example"}, Regex: "(.+)", TargetLabel: "__name__", Replacement: "renamed_metric"},
+	}
+	assert.NoError(t, d.validate())
+
+	client, err = newSendClient(d, nil)
+	assert.NoError(t, err)
+	client.gatherer = prometheus.Gatherers{
+		prometheus.DefaultGatherer, newTestGatherer(prometheus.GaugeValue, prometheus.Labels{"example": "example"}),
+	}
+
+	buf, err = client.readMetrics(context.Background())
+	assert.NoError(t, err)
+	assert.NotContains(t, string(buf), "go_goroutines")
+	assert.Contains(t, string(buf), "# HELP renamed_metric Test metric.\n# TYPE renamed_metric gauge\nrenamed_metric{example=\"example\"} 1\n")
+}
+
+// newTestGatherer creates registry with single 'test_metric' metric of specified type with value 1.
+func newTestGatherer(valueType prometheus.ValueType, labels prometheus.Labels) prometheus.Gatherer {
+	desc := prometheus.NewDesc("test_metric", "Test metric.", nil, labels)
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(testCollector{prometheus.MustNewConstMetric(desc, valueType, 1)})
+	return registry
+}
+
+// testCollector is the collector which produces single predefined metric.
+type testCollector struct {
+	metric prometheus.Metric
+}
+
+func (c testCollector) Describe(ch chan<- *prometheus.Desc) { ch <- c.metric.Desc() }
+func (c testCollector) Collect(ch chan<- prometheus.Metric) { ch <- c.metric }
+
+func Test_sendClient_sendMetrics_Spool(t *testing.T) {
+	var fail = true
+	var received []string
+
+	writeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		assert.NoError(t, r.Body.Close())
+
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		received = append(received, string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer writeServer.Close()
+
+	d := Destination{
+		Name:           "test",
+		URL:            writeServer.URL,
+		APIKey:         "TEST1234TEST-TEST-1234-TEST1234",
+		SpoolDirectory: t.TempDir(),
+	}
+	assert.NoError(t, d.validate())
+
+	client, err := newSendClient(d, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, client.spool)
+
+	// Remote service is not available, metrics should be saved to spool.
+	ts := time.Now().Truncate(time.Second)
+	assert.Error(t, client.sendMetrics([]byte("test_metric 1\n"), ts.Add(-2*time.Minute)))
+	assert.Error(t, client.sendMetrics([]byte("test_metric 2\n"), ts.Add(-time.Minute)))
+	assert.Len(t, client.spool.entries, 2)
+
+	// Remote service recovered, spooled metrics should be sent in order before the current ones.
+	fail = false
+	assert.NoError(t, client.sendMetrics([]byte("test_metric 3\n"), ts))
+	assert.Len(t, client.spool.entries, 0)
+
+	var want []string
+	for i, d := range []time.Duration{-2 * time.Minute, -time.Minute, 0} {
+		want = append(want, fmt.Sprintf("# TYPE test_metric untyped\ntest_metric %d %d\n", i+1, ts.Add(d).Unix()*1000))
+	}
+	assert.Equal(t, want, received)
+
+	// Sending attempts are counted.
+	assert.Equal(t, float64(3), client.success)
+	assert.Equal(t, float64(2), client.failures)
+}
+
+func Test_addTimestamps(t *testing.T) {
+	got, err := addTimestamps([]byte("# TYPE b_metric gauge\nb_metric 1\na_metric 2 1000\n"), time.Unix(1600000000, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, "# TYPE a_metric untyped\na_metric 2 1000\n# TYPE b_metric gauge\nb_metric 1 1600000000000\n", string(got))
+
+	_, err = addTimestamps([]byte("invalid input"), time.Now())
+	assert.Error(t, err)
+}
+
+func Test_newDrainContext(t *testing.T) {
+	parent, cancelParent := context.WithCancel(context.Background())
+	ctx, cancel := newDrainContext(parent, 50*time.Millisecond)
+	defer cancel()
+
+	// Context is not cancelled together with parent.
+	cancelParent()
+	assert.True(t, sleepContext(ctx, 10*time.Millisecond))
+
+	// Context is cancelled after timeout.
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		assert.Fail(t, "context is not cancelled after timeout")
+	}
+
+	// Context is cancelled by its own cancel function.
+	ctx, cancel = newDrainContext(context.Background(), time.Hour)
+	cancel()
+	assert.Error(t, ctx.Err())
+}
+
+func Test_sleepContext(t *testing.T) {
+	assert.True(t, sleepContext(context.Background(), 10*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.False(t, sleepContext(ctx, time.Hour))
 }
 
 func Test_addDelay(t *testing.T) {
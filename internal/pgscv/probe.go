@@ -0,0 +1,166 @@
+package pgscv
+
+import (
+	"context"
+	"fmt"
+	"github.com/jackc/pgx/v4"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/weaponry/pgscv/internal/collector"
+	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/model"
+	"github.com/weaponry/pgscv/internal/service"
+	"net/http"
+)
+
+// ProbeModule defines set of collectors used for probing targets.
+type ProbeModule struct {
+	// Collectors is the list of collectors names. Collectors which are not suitable for probed target are ignored.
+	Collectors []string `yaml:"collectors"`
+}
+
+// validateProbeTargets checks probe targets and modules settings.
+func validateProbeTargets(targets map[string]service.ConnSetting, modules map[string]ProbeModule) error {
+	for name, target := range targets {
+		if name == "" {
+			return fmt.Errorf("empty probe target name")
+		}
+
+		if target.ServiceType != model.ServiceTypePostgresql && target.ServiceType != model.ServiceTypePgbouncer {
+			return fmt.Errorf("invalid service_type of probe target %s", name)
+		}
+
+		if _, err := pgx.ParseConfig(target.Conninfo); err != nil {
+			return fmt.Errorf("invalid conninfo of probe target %s: %s", name, err)
+		}
+
+		if target.PasswordFile != "" && target.PasswordCommand != "" {
+			return fmt.Errorf("password_file and password_command can not be used together in probe target %s", name)
+		}
+
+		if err := target.Overrides.Validate(); err != nil {
+			return fmt.Errorf("invalid settings of probe target %s: %s", name, err)
+		}
+	}
+
+	for name, module := range modules {
+		if len(module.Collectors) == 0 {
+			return fmt.Errorf("no collectors specified for probe module %s", name)
+		}
+
+		for _, c := range module.Collectors {
+			if !collector.IsKnown(c) {
+				return fmt.Errorf("unknown collector '%s' in probe module %s", c, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// newProbeHandler creates handler of probe requests. Each request creates new collector for requested target, and
+// only the target's metrics are returned. The collector is closed when request is finished. Targets and modules are defined at startup, settings of collectors are taken
+// from current services configuration, hence they are updated at configuration reload.
+func newProbeHandler(config *Config, repo *service.Repository) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		targetName := r.URL.Query().Get("target")
+		if targetName == "" {
+			http.Error(w, "target parameter is missing", http.StatusBadRequest)
+			return
+		}
+
+		target, ok := config.ProbeTargets[targetName]
+		if !ok {
+			http.Error(w, fmt.Sprintf("unknown target %s", targetName), http.StatusBadRequest)
+			return
+		}
+
+		var module *ProbeModule
+		if moduleName := r.URL.Query().Get("module"); moduleName != "" {
+			m, ok := config.ProbeModules[moduleName]
+			if !ok {
+				http.Error(w, fmt.Sprintf("unknown module %s", moduleName), http.StatusBadRequest)
+				return
+			}
+			module = &m
+		}
+
+		ctx := r.Context()
+		if timeout := scrapeTimeout(r); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		c, err := newProbeCollector(ctx, targetName, target, module, repo.GetConfig())
+		if err != nil {
+			log.Errorf("probe target %s failed: %s", targetName, err)
+			http.Error(w, fmt.Sprintf("probe target %s failed: %s", targetName, err), http.StatusInternalServerError)
+			return
+		}
+		defer c.Close()
+
+		gatherer := prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return c.Gather(ctx) })
+		promhttp.HandlerFor(gatherer, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
+
+// newProbeCollector creates collector for the probed target with collectors enabled in the module. If module is not
+// specified, all collectors suitable for the target are used. Collectors which read files on the local filesystem are
+// never used, because the target is remote.
+func newProbeCollector(ctx context.Context, name string, target service.ConnSetting, module *ProbeModule, config service.Config) (*collector.PgscvCollector, error) {
+	// Password is read at every probe, hence changed password is always used.
+	target, err := target.ResolvePassword()
+	if err != nil {
+		return nil, err
+	}
+
+	collectorConfig := collector.Config{
+		NoTrackMode:       config.NoTrackMode,
+		ServiceType:       target.ServiceType,
+		ConnString:        target.Conninfo,
+		Filters:           target.MergeFilters(config.Filters),
+		Settings:          config.CollectorsSettings,
+		RelabelConfigs:    config.RelabelConfigs,
+		CardinalityLimits: config.CardinalityLimits,
+		ConstLabels:       target.Labels,
+	}
+	disabled := target.DisabledCollectors(config.DisabledCollectors)
+
+	factories := collector.Factories{}
+
+	switch target.ServiceType {
+	case model.ServiceTypePostgresql:
+		factories.RegisterPostgresCollectors(disabled)
+		factories.UnregisterLocalCollectors()
+		cfg, err := collector.NewPostgresServiceConfigContext(ctx, target.Conninfo)
+		if err != nil {
+			return nil, err
+		}
+		collectorConfig.PostgresServiceConfig = cfg
+	case model.ServiceTypePgbouncer:
+		factories.RegisterPgbouncerCollectors(disabled)
+	default:
+		return nil, fmt.Errorf("unsupported service type %s", target.ServiceType)
+	}
+
+	if module != nil {
+		enabled := map[string]bool{}
+		for _, c := range module.Collectors {
+			enabled[c] = true
+		}
+
+		for c := range factories {
+			if !enabled[c] {
+				delete(factories, c)
+			}
+		}
+	}
+
+	if len(factories) == 0 {
+		return nil, fmt.Errorf("no collectors enabled")
+	}
+
+	return collector.NewPgscvCollector(name, factories, collectorConfig)
+}
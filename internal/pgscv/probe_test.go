@@ -0,0 +1,93 @@
+package pgscv
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/model"
+	"github.com/weaponry/pgscv/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_validateProbeTargets(t *testing.T) {
+	testcases := []struct {
+		valid   bool
+		targets map[string]service.ConnSetting
+		modules map[string]ProbeModule
+	}{
+		{valid: true},
+		{
+			valid:   true,
+			targets: map[string]service.ConnSetting{"db1": {ServiceType: model.ServiceTypePostgresql, Conninfo: "host=db1.example.org user=pgscv"}},
+			modules: map[string]ProbeModule{"light": {Collectors: []string{"postgres/activity", "postgres/databases"}}},
+		},
+		{valid: false, targets: map[string]service.ConnSetting{"": {ServiceType: model.ServiceTypePostgresql}}},
+		{valid: false, targets: map[string]service.ConnSetting{"db1": {ServiceType: model.ServiceTypeSystem}}},
+		{valid: false, targets: map[string]service.ConnSetting{"db1": {ServiceType: model.ServiceTypePostgresql, Conninfo: "invalid"}}},
+		{valid: false, modules: map[string]ProbeModule{"empty": {}}},
+		{valid: false, modules: map[string]ProbeModule{"light": {Collectors: []string{"postgres/unknown"}}}},
+	}
+
+	for _, tc := range testcases {
+		if tc.valid {
+			assert.NoError(t, validateProbeTargets(tc.targets, tc.modules))
+		} else {
+			assert.Error(t, validateProbeTargets(tc.targets, tc.modules))
+		}
+	}
+}
+
+func Test_newProbeHandler(t *testing.T) {
+	config := &Config{
+		ProbeTargets: map[string]service.ConnSetting{
+			"pgbouncer": {ServiceType: model.ServiceTypePgbouncer, Conninfo: "host=127.0.0.1 port=1 user=pgscv dbname=pgbouncer"},
+			"postgres":  {ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1 port=1 user=pgscv dbname=postgres"},
+		},
+		ProbeModules: map[string]ProbeModule{
+			"settings": {Collectors: []string{"pgbouncer/settings"}},
+			"system":   {Collectors: []string{"system/cpu"}},
+		},
+	}
+	assert.NoError(t, config.Validate())
+
+	repo := service.NewRepository()
+	repo.AddServicesFromConfig(newServiceConfig(config))
+
+	h := newProbeHandler(config, repo)
+
+	testcases := []struct {
+		query string
+		want  int
+	}{
+		{query: "", want: http.StatusBadRequest},
+		{query: "target=unknown", want: http.StatusBadRequest},
+		{query: "target=pgbouncer&module=unknown", want: http.StatusBadRequest},
+		{query: "target=pgbouncer&module=system", want: http.StatusInternalServerError}, // no suitable collectors
+		{query: "target=postgres", want: http.StatusInternalServerError},                // unavailable target
+		{query: "target=pgbouncer&module=settings", want: http.StatusOK},
+	}
+
+	for _, tc := range testcases {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest("GET", "/probe?"+tc.query, nil))
+		assert.Equal(t, tc.want, rec.Code, tc.query)
+	}
+
+	// Only target's metrics produced by module's collectors are returned.
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/probe?target=pgbouncer&module=settings", nil))
+	assert.Contains(t, rec.Body.String(), `collector="pgbouncer/settings"`)
+	assert.Contains(t, rec.Body.String(), `service_id="pgbouncer"`)
+	assert.NotContains(t, rec.Body.String(), `collector="pgbouncer/pools"`)
+	assert.NotContains(t, rec.Body.String(), "go_goroutines")
+
+	// Settings of collectors are updated at configuration reload.
+	reloaded := newServiceConfig(config)
+	reloaded.DisabledCollectors = []string{"pgbouncer/settings"}
+	assert.NoError(t, repo.Reload(reloaded))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/probe?target=pgbouncer&module=settings", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Contains(t, rec.Body.String(), "no collectors enabled")
+}
@@ -0,0 +1,172 @@
+package pgscv
+
+import (
+	"context"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/service"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"time"
+)
+
+// runConfigReloader reloads configuration when SIGHUP is received or when config file is changed (if watching is enabled).
+func runConfigReloader(ctx context.Context, config *Config, repo *service.Repository) error {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGHUP)
+	defer signal.Stop(sigCh)
+
+	var watchCh <-chan struct{}
+	if config.WatchConfig {
+		ch, err := watchConfigFile(ctx, config.ConfigFile)
+		if err != nil {
+			return err
+		}
+		watchCh = ch
+		log.Infof("watching for changes in %s", config.ConfigFile)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("exit signaled, stop config reloader")
+			return nil
+		case <-sigCh:
+			log.Info("got SIGHUP, reloading configuration")
+		case <-watchCh:
+			log.Info("config file changed, reloading configuration")
+		}
+
+		if err := reloadConfig(config, repo); err != nil {
+			log.Errorf("reload configuration failed: %s; continue with current configuration", err)
+			continue
+		}
+
+		log.Info("configuration reloaded")
+	}
+}
+
+// reloadConfig reads and validates config file and applies new configuration to services repo. Settings of metrics
+// listener and metrics sender are not reloaded.
+func reloadConfig(config *Config, repo *service.Repository) error {
+	if config.ConfigFile == "" {
+		return fmt.Errorf("config file is not specified")
+	}
+
+	newConfig, err := NewConfig(config.ConfigFile)
+	if err != nil {
+		return err
+	}
+
+	err = newConfig.Validate()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range restartRequiredChanges(config, newConfig) {
+		log.Warnf("reload: changed '%s' requires restart, ignore", name)
+	}
+
+	// File discovery is started once at startup, files specified at reload are read only when it is running.
+	if len(config.FileSD.Files) == 0 && len(newConfig.FileSD.Files) > 0 {
+		log.Warnln("reload: enabling file_sd requires restart, ignore")
+	}
+
+	return repo.Reload(newServiceConfig(newConfig))
+}
+
+// restartRequiredChanges returns names of changed settings which can't be applied without restart.
+func restartRequiredChanges(prev, next *Config) []string {
+	settings := []struct {
+		name       string
+		prev, next interface{}
+	}{
+		{"autoupdate", prev.AutoUpdate, next.AutoUpdate},
+		{"listen_address", prev.ListenAddress, next.ListenAddress},
+		{"disable_listener", prev.DisableListener, next.DisableListener},
+		{"tls_server_config", prev.TLSServerConfig, next.TLSServerConfig},
+		{"basic_auth_users", prev.BasicAuthUsers, next.BasicAuthUsers},
+		{"listen_read_timeout", prev.ListenReadTimeout, next.ListenReadTimeout},
+		{"listen_write_timeout", prev.ListenWriteTimeout, next.ListenWriteTimeout},
+		{"max_concurrent_scrapes", prev.MaxConcurrentScrapes, next.MaxConcurrentScrapes},
+		{"shutdown_timeout", prev.ShutdownTimeout, next.ShutdownTimeout},
+		{"send_metrics_url", prev.SendMetricsURL, next.SendMetricsURL},
+		{"send_metrics_format", prev.SendMetricsFormat, next.SendMetricsFormat},
+		{"send_metrics_username", prev.SendMetricsUsername, next.SendMetricsUsername},
+		{"send_metrics_password", prev.SendMetricsPassword, next.SendMetricsPassword},
+		{"send_metrics_bearer_token", prev.SendMetricsToken, next.SendMetricsToken},
+		{"send_metrics_headers", prev.SendMetricsHeaders, next.SendMetricsHeaders},
+		{"api_key", prev.APIKey, next.APIKey},
+		{"spool_directory", prev.SpoolDirectory, next.SpoolDirectory},
+		{"spool_max_bytes", prev.SpoolMaxBytes, next.SpoolMaxBytes},
+		{"spool_max_age", prev.SpoolMaxAge, next.SpoolMaxAge},
+		{"destinations", prev.Destinations, next.Destinations},
+		{"probe_targets", prev.ProbeTargets, next.ProbeTargets},
+		{"probe_modules", prev.ProbeModules, next.ProbeModules},
+	}
+
+	var changed []string
+	for _, s := range settings {
+		if !reflect.DeepEqual(s.prev, s.next) {
+			changed = append(changed, s.name)
+		}
+	}
+
+	return changed
+}
+
+// watchConfigFile watches for changes of config file and notifies about them through returned channel.
+func watchConfigFile(ctx context.Context, path string) (<-chan struct{}, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+
+	// Watch the directory instead of the file, because editors and configuration management tools often replace
+	// files by renaming, and the watch on replaced file is lost.
+	err = watcher.Add(filepath.Dir(path))
+	if err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+
+	ch := make(chan struct{}, 1)
+
+	go func() {
+		defer func() { _ = watcher.Close() }()
+
+		// Single update of the file might produce series of events, notify once when events stop.
+		var debounce <-chan time.Time
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == filepath.Clean(path) {
+					debounce = time.After(time.Second)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warnf("config file watcher failed: %s; ignore", err)
+			case <-debounce:
+				debounce = nil
+				select {
+				case ch <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	return ch, nil
+}
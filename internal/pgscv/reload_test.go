@@ -0,0 +1,75 @@
+package pgscv
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/service"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_reloadConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pgscv.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("services: []\n"), 0600))
+
+	config, err := NewConfig(path)
+	assert.NoError(t, err)
+	config.ConfigFile = path
+	assert.NoError(t, config.Validate())
+
+	// Empty repo is used, because system service might be already registered by concurrent tests.
+	repo := service.NewRepository()
+
+	// Valid config with settings which require restart.
+	assert.NoError(t, os.WriteFile(path, []byte("services: []\ndisable_collectors: [system/loadaverage]\nlisten_address: 127.0.0.1:1\n"), 0600))
+	assert.NoError(t, reloadConfig(config, repo))
+
+	// Invalid config.
+	assert.NoError(t, os.WriteFile(path, []byte("services: []\nfilters: {netdev/device: {exclude: '['}}\n"), 0600))
+	assert.Error(t, reloadConfig(config, repo))
+
+	// Config file is not specified.
+	assert.Error(t, reloadConfig(&Config{}, repo))
+}
+
+func Test_restartRequiredChanges(t *testing.T) {
+	prev := &Config{ListenAddress: "127.0.0.1:9890", NoTrackMode: true, BasicAuthUsers: map[string]string{"user": "hash"}}
+
+	assert.Len(t, restartRequiredChanges(prev, &Config{ListenAddress: "127.0.0.1:9890", BasicAuthUsers: map[string]string{"user": "hash"}}), 0)
+	assert.Equal(t, []string{"listen_address", "basic_auth_users"}, restartRequiredChanges(prev, &Config{ListenAddress: "127.0.0.1:9891"}))
+
+	next := &Config{ListenAddress: "127.0.0.1:9890", BasicAuthUsers: map[string]string{"user": "hash"}, Destinations: []Destination{{Name: "vm"}}}
+	assert.Equal(t, []string{"destinations"}, restartRequiredChanges(prev, next))
+}
+
+func Test_watchConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pgscv.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte("listen_address: 127.0.0.1:9890\n"), 0600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := watchConfigFile(ctx, path)
+	assert.NoError(t, err)
+
+	// Changes of other files should be ignored.
+	assert.NoError(t, os.WriteFile(path+".bak", []byte("test"), 0600))
+	select {
+	case <-ch:
+		assert.Fail(t, "unexpected notification")
+	case <-time.After(1500 * time.Millisecond):
+	}
+
+	assert.NoError(t, os.WriteFile(path, []byte("listen_address: 127.0.0.1:9891\n"), 0600))
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		assert.Fail(t, "notification expected")
+	}
+
+	// Watching of non-existent directory should fail.
+	_, err = watchConfigFile(ctx, "/nonexistent/pgscv.yaml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,174 @@
+package pgscv
+
+import (
+	"bytes"
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Remote write protocol is described in https://github.com/prometheus/prometheus/blob/main/prompb/remote.proto and
+// https://github.com/prometheus/prometheus/blob/main/prompb/types.proto. Only a small subset of messages is required for
+// sending samples, hence messages are encoded by hand using protowire instead of pulling the whole Prometheus codebase.
+
+// rwLabel is the representation of remote write 'Label' message.
+type rwLabel struct {
+	name  string
+	value string
+}
+
+// rwSample is the representation of remote write 'Sample' message.
+type rwSample struct {
+	value     float64
+	timestamp int64
+}
+
+// rwTimeSeries is the representation of remote write 'TimeSeries' message.
+type rwTimeSeries struct {
+	labels  []rwLabel
+	samples []rwSample
+}
+
+// newRemoteWriteRequest parses metrics in text exposition format and returns snappy-compressed protobuf-encoded
+// remote write request. Passed timestamp is used for samples which have no explicit timestamps.
+func newRemoteWriteRequest(buf []byte, ts time.Time) ([]byte, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	series := familiesToTimeSeries(families, ts.UnixNano()/int64(time.Millisecond))
+
+	return snappy.Encode(nil, marshalWriteRequest(series)), nil
+}
+
+// familiesToTimeSeries converts metric families to remote write time series. Summaries and histograms are flattened
+// into separate series in the same way as Prometheus does during scraping.
+func familiesToTimeSeries(families map[string]*dto.MetricFamily, defaultTs int64) []rwTimeSeries {
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var series []rwTimeSeries
+
+	for _, name := range names {
+		mf := families[name]
+		for _, m := range mf.GetMetric() {
+			ts := defaultTs
+			if m.TimestampMs != nil {
+				ts = m.GetTimestampMs()
+			}
+
+			switch mf.GetType() {
+			case dto.MetricType_COUNTER:
+				series = append(series, newTimeSeries(name, m.GetLabel(), nil, m.GetCounter().GetValue(), ts))
+			case dto.MetricType_GAUGE:
+				series = append(series, newTimeSeries(name, m.GetLabel(), nil, m.GetGauge().GetValue(), ts))
+			case dto.MetricType_UNTYPED:
+				series = append(series, newTimeSeries(name, m.GetLabel(), nil, m.GetUntyped().GetValue(), ts))
+			case dto.MetricType_SUMMARY:
+				s := m.GetSummary()
+				for _, q := range s.GetQuantile() {
+					extra := &rwLabel{name: "quantile", value: formatFloat(q.GetQuantile())}
+					series = append(series, newTimeSeries(name, m.GetLabel(), extra, q.GetValue(), ts))
+				}
+				series = append(series, newTimeSeries(name+"_sum", m.GetLabel(), nil, s.GetSampleSum(), ts))
+				series = append(series, newTimeSeries(name+"_count", m.GetLabel(), nil, float64(s.GetSampleCount()), ts))
+			case dto.MetricType_HISTOGRAM:
+				h := m.GetHistogram()
+				var hasInf bool
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), +1) {
+						hasInf = true
+					}
+					extra := &rwLabel{name: "le", value: formatFloat(b.GetUpperBound())}
+					series = append(series, newTimeSeries(name+"_bucket", m.GetLabel(), extra, float64(b.GetCumulativeCount()), ts))
+				}
+				if !hasInf {
+					extra := &rwLabel{name: "le", value: "+Inf"}
+					series = append(series, newTimeSeries(name+"_bucket", m.GetLabel(), extra, float64(h.GetSampleCount()), ts))
+				}
+				series = append(series, newTimeSeries(name+"_sum", m.GetLabel(), nil, h.GetSampleSum(), ts))
+				series = append(series, newTimeSeries(name+"_count", m.GetLabel(), nil, float64(h.GetSampleCount()), ts))
+			}
+		}
+	}
+
+	return series
+}
+
+// newTimeSeries creates time series with single sample. Labels are sorted by name as required by remote write protocol.
+func newTimeSeries(name string, pairs []*dto.LabelPair, extra *rwLabel, value float64, ts int64) rwTimeSeries {
+	labels := make([]rwLabel, 0, len(pairs)+2)
+	labels = append(labels, rwLabel{name: "__name__", value: name})
+	for _, lp := range pairs {
+		labels = append(labels, rwLabel{name: lp.GetName(), value: lp.GetValue()})
+	}
+	if extra != nil {
+		labels = append(labels, *extra)
+	}
+
+	sort.Slice(labels, func(i, j int) bool { return labels[i].name < labels[j].name })
+
+	return rwTimeSeries{labels: labels, samples: []rwSample{{value: value, timestamp: ts}}}
+}
+
+// marshalWriteRequest encodes time series into 'WriteRequest' protobuf message.
+func marshalWriteRequest(series []rwTimeSeries) []byte {
+	var b []byte
+	for _, s := range series {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalTimeSeries(s))
+	}
+	return b
+}
+
+// marshalTimeSeries encodes time series into 'TimeSeries' protobuf message.
+func marshalTimeSeries(s rwTimeSeries) []byte {
+	var b []byte
+	for _, l := range s.labels {
+		var lb []byte
+		lb = protowire.AppendTag(lb, 1, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.name)
+		lb = protowire.AppendTag(lb, 2, protowire.BytesType)
+		lb = protowire.AppendString(lb, l.value)
+
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendBytes(b, lb)
+	}
+
+	for _, smpl := range s.samples {
+		var sb []byte
+		sb = protowire.AppendTag(sb, 1, protowire.Fixed64Type)
+		sb = protowire.AppendFixed64(sb, math.Float64bits(smpl.value))
+		sb = protowire.AppendTag(sb, 2, protowire.VarintType)
+		sb = protowire.AppendVarint(sb, uint64(smpl.timestamp))
+
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendBytes(b, sb)
+	}
+
+	return b
+}
+
+// formatFloat formats float values used in 'le' and 'quantile' labels in the same way as Prometheus does.
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, +1):
+		return "+Inf"
+	case math.IsInf(f, -1):
+		return "-Inf"
+	case math.IsNaN(f):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+}
@@ -0,0 +1,168 @@
+package pgscv
+
+import (
+	"github.com/golang/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/protobuf/encoding/protowire"
+	"math"
+	"testing"
+	"time"
+)
+
+func Test_newRemoteWriteRequest(t *testing.T) {
+	buf := []byte(`# HELP example_counter Example counter.
+# TYPE example_counter counter
+example_counter{instance="test",service_id="system:0"} 10
+# HELP example_gauge Example gauge.
+# TYPE example_gauge gauge
+example_gauge{instance="test",service_id="system:0"} 0.5
+# HELP example_summary Example summary.
+# TYPE example_summary summary
+example_summary{quantile="0.5"} 1
+example_summary_sum 5
+example_summary_count 4
+`)
+
+	ts := time.Unix(1600000000, 0)
+	payload, err := newRemoteWriteRequest(buf, ts)
+	assert.NoError(t, err)
+
+	decoded, err := snappy.Decode(nil, payload)
+	assert.NoError(t, err)
+
+	series := unmarshalWriteRequest(t, decoded)
+	assert.Equal(t, []rwTimeSeries{
+		{labels: []rwLabel{{"__name__", "example_counter"}, {"instance", "test"}, {"service_id", "system:0"}}, samples: []rwSample{{10, 1600000000000}}},
+		{labels: []rwLabel{{"__name__", "example_gauge"}, {"instance", "test"}, {"service_id", "system:0"}}, samples: []rwSample{{0.5, 1600000000000}}},
+		{labels: []rwLabel{{"__name__", "example_summary"}, {"quantile", "0.5"}}, samples: []rwSample{{1, 1600000000000}}},
+		{labels: []rwLabel{{"__name__", "example_summary_sum"}}, samples: []rwSample{{5, 1600000000000}}},
+		{labels: []rwLabel{{"__name__", "example_summary_count"}}, samples: []rwSample{{4, 1600000000000}}},
+	}, series)
+
+	// invalid input
+	_, err = newRemoteWriteRequest([]byte("invalid input"), ts)
+	assert.Error(t, err)
+}
+
+func Test_familiesToTimeSeries(t *testing.T) {
+	name, le1, le2 := "example_histogram", 0.1, math.Inf(+1)
+	count1, count2, sum, total := uint64(1), uint64(3), 1.5, uint64(3)
+	htype, ts := dto.MetricType_HISTOGRAM, int64(1000)
+
+	families := map[string]*dto.MetricFamily{
+		name: {
+			Name: &name,
+			Type: &htype,
+			Metric: []*dto.Metric{
+				{
+					Histogram: &dto.Histogram{
+						SampleCount: &total,
+						SampleSum:   &sum,
+						Bucket: []*dto.Bucket{
+							{CumulativeCount: &count1, UpperBound: &le1},
+							{CumulativeCount: &count2, UpperBound: &le2},
+						},
+					},
+					TimestampMs: &ts,
+				},
+			},
+		},
+	}
+
+	assert.Equal(t, []rwTimeSeries{
+		{labels: []rwLabel{{"__name__", "example_histogram_bucket"}, {"le", "0.1"}}, samples: []rwSample{{1, 1000}}},
+		{labels: []rwLabel{{"__name__", "example_histogram_bucket"}, {"le", "+Inf"}}, samples: []rwSample{{3, 1000}}},
+		{labels: []rwLabel{{"__name__", "example_histogram_sum"}}, samples: []rwSample{{1.5, 1000}}},
+		{labels: []rwLabel{{"__name__", "example_histogram_count"}}, samples: []rwSample{{3, 1000}}},
+	}, familiesToTimeSeries(families, 2000))
+}
+
+func Test_formatFloat(t *testing.T) {
+	assert.Equal(t, "+Inf", formatFloat(math.Inf(+1)))
+	assert.Equal(t, "-Inf", formatFloat(math.Inf(-1)))
+	assert.Equal(t, "NaN", formatFloat(math.NaN()))
+	assert.Equal(t, "0.25", formatFloat(0.25))
+	assert.Equal(t, "10", formatFloat(10))
+}
+
+// unmarshalWriteRequest decodes 'WriteRequest' protobuf message, used in tests for checking encoded requests.
+func unmarshalWriteRequest(t *testing.T, b []byte) []rwTimeSeries {
+	var series []rwTimeSeries
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		assert.Greater(t, n, 0)
+		assert.Equal(t, protowire.Number(1), num)
+		assert.Equal(t, protowire.BytesType, typ)
+		b = b[n:]
+
+		v, n := protowire.ConsumeBytes(b)
+		assert.Greater(t, n, 0)
+		b = b[n:]
+
+		series = append(series, unmarshalTimeSeries(t, v))
+	}
+
+	return series
+}
+
+// unmarshalTimeSeries decodes 'TimeSeries' protobuf message.
+func unmarshalTimeSeries(t *testing.T, b []byte) rwTimeSeries {
+	var s rwTimeSeries
+
+	for len(b) > 0 {
+		num, _, n := protowire.ConsumeTag(b)
+		assert.Greater(t, n, 0)
+		b = b[n:]
+
+		v, n := protowire.ConsumeBytes(b)
+		assert.Greater(t, n, 0)
+		b = b[n:]
+
+		fields := unmarshalFields(t, v)
+
+		switch num {
+		case 1:
+			s.labels = append(s.labels, rwLabel{name: string(fields[1].([]byte)), value: string(fields[2].([]byte))})
+		case 2:
+			s.samples = append(s.samples, rwSample{
+				value:     math.Float64frombits(fields[1].(uint64)),
+				timestamp: int64(fields[2].(uint64)),
+			})
+		}
+	}
+
+	return s
+}
+
+// unmarshalFields decodes flat protobuf message with bytes, fixed64 and varint fields.
+func unmarshalFields(t *testing.T, b []byte) map[protowire.Number]interface{} {
+	fields := map[protowire.Number]interface{}{}
+
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		assert.Greater(t, n, 0)
+		b = b[n:]
+
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeBytes(b)
+			assert.Greater(t, n, 0)
+			fields[num], b = v, b[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(b)
+			assert.Greater(t, n, 0)
+			fields[num], b = v, b[n:]
+		case protowire.VarintType:
+			v, n := protowire.ConsumeVarint(b)
+			assert.Greater(t, n, 0)
+			fields[num], b = v, b[n:]
+		default:
+			assert.Fail(t, "unexpected wire type")
+			return fields
+		}
+	}
+
+	return fields
+}
@@ -0,0 +1,271 @@
+package pgscv
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/weaponry/pgscv/internal/log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// spoolEntry describes a single batch of metrics stored in the spool.
+type spoolEntry struct {
+	name string    // file name of the batch
+	ts   time.Time // time when metrics have been collected
+	size int64     // size of the batch in bytes
+}
+
+// spool is the bounded on-disk storage for metrics which have been failed to send. Batches are stored in separate
+// files which names start with collection timestamp, hence lexicographical order of files is the order of collection.
+type spool struct {
+	mu       sync.Mutex
+	dir      string        // directory where batches are stored
+	format   string        // format of stored batches, batches in other formats are ignored
+	maxBytes int64         // maximum total size of stored batches
+	maxAge   time.Duration // maximum age of stored batches
+	entries  []spoolEntry  // stored batches, ordered from the oldest to the newest
+	bytes    int64         // total size of stored batches
+	dropped  float64       // total number of batches dropped due to size or age limits or rejected by destination
+	seq      uint64        // sequence used for distinguishing batches with the same timestamp
+
+	sizeDesc    *prometheus.Desc
+	batchesDesc *prometheus.Desc
+	droppedDesc *prometheus.Desc
+	lagDesc     *prometheus.Desc
+}
+
+// newSpool creates spool in the specified directory and loads batches left since previous runs. Passed labels are
+// attached to spool's metrics.
+func newSpool(dir string, format string, maxBytes int64, maxAge time.Duration, labels prometheus.Labels) (*spool, error) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &spool{
+		dir:      dir,
+		format:   format,
+		maxBytes: maxBytes,
+		maxAge:   maxAge,
+		sizeDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("pgscv", "sender", "spool_bytes"),
+			"Total size of metrics batches stored in spool, in bytes.",
+			nil, labels,
+		),
+		batchesDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("pgscv", "sender", "spool_batches"),
+			"Total number of metrics batches stored in spool.",
+			nil, labels,
+		),
+		droppedDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("pgscv", "sender", "spool_dropped_batches_total"),
+			"Total number of metrics batches dropped from spool due to size or age limits, or rejected by destination.",
+			nil, labels,
+		),
+		lagDesc: prometheus.NewDesc(
+			prometheus.BuildFQName("pgscv", "sender", "spool_replay_lag_seconds"),
+			"Age of the oldest metrics batch waiting for replay, in seconds.",
+			nil, labels,
+		),
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, f := range files {
+		// Temporary files are left when process has been terminated during saving batch, they are useless.
+		if !f.IsDir() && strings.HasSuffix(f.Name(), "."+format+".tmp") {
+			err := os.Remove(filepath.Join(dir, f.Name()))
+			if err != nil {
+				log.Warnf("spool: failed to remove temporary file %s: %s; skip", f.Name(), err)
+			}
+			continue
+		}
+
+		if f.IsDir() || filepath.Ext(f.Name()) != "."+format {
+			continue
+		}
+
+		ts, err := parseSpoolEntryName(f.Name())
+		if err != nil {
+			log.Warnf("spool: invalid batch name %s: %s; skip", f.Name(), err)
+			continue
+		}
+
+		info, err := f.Info()
+		if err != nil {
+			log.Warnf("spool: failed to stat batch %s: %s; skip", f.Name(), err)
+			continue
+		}
+
+		s.entries = append(s.entries, spoolEntry{name: f.Name(), ts: ts, size: info.Size()})
+		s.bytes += info.Size()
+	}
+
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].name < s.entries[j].name })
+
+	if len(s.entries) > 0 {
+		log.Infof("spool: found %d batches (%d bytes) waiting for replay", len(s.entries), s.bytes)
+	}
+
+	s.enforceLimits(time.Now())
+
+	return s, nil
+}
+
+// push saves batch to the spool. The oldest batches are dropped when spool limits are exceeded.
+func (s *spool) push(ts time.Time, payload []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.seq++
+	name := fmt.Sprintf("%020d-%06d.%s", ts.UnixNano(), s.seq%1000000, s.format)
+
+	// Write batch into temporary file and rename it for avoiding partially written batches in case of crash.
+	tmpPath := filepath.Join(s.dir, name+".tmp")
+	err := os.WriteFile(tmpPath, payload, 0600)
+	if err != nil {
+		return err
+	}
+
+	err = os.Rename(tmpPath, filepath.Join(s.dir, name))
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	s.entries = append(s.entries, spoolEntry{name: name, ts: ts, size: int64(len(payload))})
+	s.bytes += int64(len(payload))
+	sort.Slice(s.entries, func(i, j int) bool { return s.entries[i].name < s.entries[j].name })
+
+	s.enforceLimits(time.Now())
+
+	return nil
+}
+
+// replay sends stored batches from the oldest to the newest using passed send function. Successfully sent batches
+// are removed from the spool, as well as batches rejected by destination. Replay stops at first failure keeping the order
+// of remaining batches.
+func (s *spool) replay(send func([]byte) error) error {
+	for {
+		// Don't hold the lock during sending, for not blocking spool metrics collecting.
+		s.mu.Lock()
+		s.enforceLimits(time.Now())
+		if len(s.entries) == 0 {
+			s.mu.Unlock()
+			return nil
+		}
+		e := s.entries[0]
+		s.mu.Unlock()
+
+		payload, err := os.ReadFile(filepath.Clean(filepath.Join(s.dir, e.name)))
+		if err != nil {
+			// Batch is not readable and will never be sent, drop it and go to next one.
+			log.Warnf("spool: read batch %s failed: %s; drop", e.name, err)
+			s.mu.Lock()
+			s.remove(e)
+			s.dropped++
+			s.mu.Unlock()
+			continue
+		}
+
+		err = send(payload)
+		if isRejected(err) {
+			// Batch is rejected by destination and will never be sent, drop it and go to next one.
+			log.Warnf("spool: batch %s rejected: %s; drop", e.name, err)
+			s.mu.Lock()
+			s.remove(e)
+			s.dropped++
+			s.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		log.Debugf("spool: batch %s has been replayed", e.name)
+		s.mu.Lock()
+		s.remove(e)
+		s.mu.Unlock()
+	}
+}
+
+// enforceLimits drops batches which are older than max age and the oldest batches which exceed max size.
+func (s *spool) enforceLimits(now time.Time) {
+	for len(s.entries) > 0 {
+		e := s.entries[0]
+
+		if s.maxAge > 0 && now.Sub(e.ts) > s.maxAge {
+			log.Warnf("spool: batch %s is too old; drop", e.name)
+		} else if s.maxBytes > 0 && s.bytes > s.maxBytes {
+			log.Warnf("spool: size limit exceeded (%d/%d bytes), batch %s; drop", s.bytes, s.maxBytes, e.name)
+		} else {
+			return
+		}
+
+		s.remove(e)
+		s.dropped++
+	}
+}
+
+// remove deletes the batch from spool. Should be called with locked mutex.
+func (s *spool) remove(e spoolEntry) {
+	err := os.Remove(filepath.Join(s.dir, e.name))
+	if err != nil && !os.IsNotExist(err) {
+		log.Warnf("spool: remove batch %s failed: %s; ignore", e.name, err)
+	}
+
+	for i := range s.entries {
+		if s.entries[i].name == e.name {
+			s.entries = append(s.entries[:i], s.entries[i+1:]...)
+			s.bytes -= e.size
+			return
+		}
+	}
+}
+
+// Describe implements prometheus.Collector interface.
+func (s *spool) Describe(ch chan<- *prometheus.Desc) {
+	ch <- s.sizeDesc
+	ch <- s.batchesDesc
+	ch <- s.droppedDesc
+	ch <- s.lagDesc
+}
+
+// Collect implements prometheus.Collector interface.
+func (s *spool) Collect(ch chan<- prometheus.Metric) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var lag float64
+	if len(s.entries) > 0 {
+		lag = time.Since(s.entries[0].ts).Seconds()
+	}
+
+	ch <- prometheus.MustNewConstMetric(s.sizeDesc, prometheus.GaugeValue, float64(s.bytes))
+	ch <- prometheus.MustNewConstMetric(s.batchesDesc, prometheus.GaugeValue, float64(len(s.entries)))
+	ch <- prometheus.MustNewConstMetric(s.droppedDesc, prometheus.CounterValue, s.dropped)
+	ch <- prometheus.MustNewConstMetric(s.lagDesc, prometheus.GaugeValue, lag)
+}
+
+// parseSpoolEntryName extracts collection timestamp from batch file name.
+func parseSpoolEntryName(name string) (time.Time, error) {
+	parts := strings.SplitN(name, "-", 2)
+	if len(parts) != 2 {
+		return time.Time{}, fmt.Errorf("unexpected name format")
+	}
+
+	nsec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.Unix(0, nsec), nil
+}
@@ -0,0 +1,180 @@
+package pgscv
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_newSpool(t *testing.T) {
+	dir := t.TempDir()
+
+	// Create batches left since previous run, batch in other format, unfinished batches and garbage.
+	tmpName := fmt.Sprintf("%020d-000003.weaponry.tmp", time.Now().UnixNano())
+	otherTmpName := fmt.Sprintf("%020d-000004.remote_write.tmp", time.Now().UnixNano())
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%020d-000001.weaponry", time.Now().UnixNano())), []byte("test"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%020d-000002.remote_write", time.Now().UnixNano())), []byte("test"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, tmpName), []byte("test"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, otherTmpName), []byte("test"), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "invalid.weaponry"), []byte("test"), 0600))
+
+	s, err := newSpool(dir, sendFormatWeaponry, 1024, time.Hour, nil)
+	assert.NoError(t, err)
+	assert.Len(t, s.entries, 1)
+	assert.Equal(t, int64(4), s.bytes)
+
+	// Unfinished batches of the spool's format are removed, others are kept.
+	assert.NoFileExists(t, filepath.Join(dir, tmpName))
+	assert.FileExists(t, filepath.Join(dir, otherTmpName))
+
+	// Spool directory is not available.
+	_, err = newSpool("/dev/null/invalid", sendFormatWeaponry, 1024, time.Hour, nil)
+	assert.Error(t, err)
+}
+
+func Test_spool_pushReplay(t *testing.T) {
+	s, err := newSpool(t.TempDir(), sendFormatWeaponry, 1024, time.Hour, nil)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.push(now.Add(time.Duration(i)*time.Second), []byte(fmt.Sprintf("batch-%d", i))))
+	}
+	assert.Len(t, s.entries, 3)
+	assert.Equal(t, int64(21), s.bytes)
+
+	// Failed replay should keep all batches.
+	assert.Error(t, s.replay(func([]byte) error { return fmt.Errorf("failed") }))
+	assert.Len(t, s.entries, 3)
+
+	// Partially failed replay should keep unsent batches in the same order.
+	var sent []string
+	assert.Error(t, s.replay(func(b []byte) error {
+		if len(sent) == 1 {
+			return fmt.Errorf("failed")
+		}
+		sent = append(sent, string(b))
+		return nil
+	}))
+	assert.Equal(t, []string{"batch-0"}, sent)
+	assert.Len(t, s.entries, 2)
+
+	// Successful replay should send remaining batches and clean up spool.
+	assert.NoError(t, s.replay(func(b []byte) error {
+		sent = append(sent, string(b))
+		return nil
+	}))
+	assert.Equal(t, []string{"batch-0", "batch-1", "batch-2"}, sent)
+	assert.Len(t, s.entries, 0)
+	assert.Equal(t, int64(0), s.bytes)
+
+	files, err := os.ReadDir(s.dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 0)
+}
+
+func Test_spool_enforceLimits(t *testing.T) {
+	s, err := newSpool(t.TempDir(), sendFormatWeaponry, 20, time.Hour, nil)
+	assert.NoError(t, err)
+
+	// Batches exceeding size limit should be dropped starting from the oldest.
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, s.push(now.Add(time.Duration(i)*time.Second), []byte("0123456789")))
+	}
+	assert.Len(t, s.entries, 2)
+	assert.Equal(t, float64(1), s.dropped)
+
+	// Too old batches should be dropped.
+	assert.NoError(t, s.push(now.Add(-2*time.Hour), []byte("old")))
+	assert.Len(t, s.entries, 2)
+	assert.Equal(t, float64(2), s.dropped)
+}
+
+func Test_spool_Collect(t *testing.T) {
+	s, err := newSpool(t.TempDir(), sendFormatWeaponry, 1024, time.Hour, nil)
+	assert.NoError(t, err)
+	assert.NoError(t, s.push(time.Now().Add(-time.Minute), []byte("test")))
+
+	ch := make(chan prometheus.Metric)
+	go func() {
+		s.Collect(ch)
+		close(ch)
+	}()
+
+	var n int
+	for range ch {
+		n++
+	}
+	assert.Equal(t, 4, n)
+}
+
+func Test_parseSpoolEntryName(t *testing.T) {
+	ts, err := parseSpoolEntryName("01600000000000000000-000001.weaponry")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Unix(1600000000, 0), ts)
+
+	_, err = parseSpoolEntryName("invalid")
+	assert.Error(t, err)
+
+	_, err = parseSpoolEntryName("invalid-000001.weaponry")
+	assert.Error(t, err)
+}
+
+func Test_sendClient_sendMetrics_rejected(t *testing.T) {
+	var received []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		// The oldest batch has too old samples and is rejected.
+		if strings.Contains(string(body), "batch-0") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received = append(received, string(body))
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	d := Destination{Name: "test", URL: srv.URL, APIKey: "TEST1234TEST-TEST-1234-TEST1234", SpoolDirectory: t.TempDir()}
+	assert.NoError(t, d.validate())
+
+	client, err := newSendClient(d, nil)
+	assert.NoError(t, err)
+
+	now := time.Now()
+	assert.NoError(t, client.spool.push(now.Add(-2*time.Second), []byte("batch-0")))
+	assert.NoError(t, client.spool.push(now.Add(-time.Second), []byte("batch-1")))
+
+	// Rejected batch is dropped, replay continues with next batches and the current batch is sent.
+	assert.NoError(t, client.sendMetrics([]byte("test_metric{batch=\"current\"} 1\n"), now))
+	assert.Len(t, received, 2)
+	assert.Equal(t, "batch-1", received[0])
+	assert.Contains(t, received[1], "current")
+	assert.Len(t, client.spool.entries, 0)
+	assert.Equal(t, float64(1), client.spool.dropped)
+
+	// Rejected current batch is not spooled.
+	err = client.sendMetrics([]byte("test_metric{batch=\"batch-0\"} 1\n"), now)
+	assert.Error(t, err)
+	assert.True(t, isRejected(err))
+	assert.Len(t, client.spool.entries, 0)
+
+	// Throttled batch is spooled and retried later.
+	srv.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+	})
+	err = client.sendMetrics([]byte("test_metric 1\n"), now)
+	assert.Error(t, err)
+	assert.False(t, isRejected(err))
+	assert.Len(t, client.spool.entries, 1)
+}
@@ -0,0 +1,117 @@
+package pgscv
+
+import (
+	"encoding/json"
+	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/service"
+	"html/template"
+	"net/http"
+	"time"
+)
+
+// statusPageTemplate is the template of human-readable status page, it is built from the same data as status API.
+var statusPageTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"formatTime": func(t *time.Time) string {
+		if t == nil {
+			return "never"
+		}
+		return t.Format(time.RFC3339)
+	},
+}).Parse(`<html>
+<head><title>pgSCV / Weaponry metric collector</title></head>
+<body>
+<h1>pgSCV / Weaponry metric collector, for more info visit https://weaponry.io</h1>
+<p><a href="/metrics">Metrics</a> | <a href="/api/v1/services">Services API</a> | <a href="/api/v1/collectors">Collectors API</a></p>
+<h2>Services</h2>
+<table border="1" cellpadding="4">
+<tr><th>Service ID</th><th>Type</th><th>Conninfo</th><th>Health check errors</th><th>Postgres</th><th>Collectors</th></tr>
+{{- range .Services}}
+<tr>
+<td>{{.ServiceID}}</td><td>{{.ServiceType}}</td><td>{{.Conninfo}}</td><td>{{.TotalErrors}}</td>
+<td>{{with .Postgres}}version {{.ServerVersionNum}}, data directory {{.DataDirectory}}, pg_stat_statements {{if .PgStatStatements}}in {{.PgStatStatementsSource}}{{else}}not available{{end}}{{end}}</td>
+<td>{{len .Collectors}}</td>
+</tr>
+{{- end}}
+</table>
+<h2>Collectors</h2>
+{{- range .Collectors}}
+<h3>{{.ServiceID}}</h3>
+<table border="1" cellpadding="4">
+<tr><th>Collector</th><th>Last run</th><th>Duration, seconds</th><th>Success</th><th>Metrics</th><th>Last error</th><th>Last error time</th></tr>
+{{- range .Collectors}}
+<tr>
+<td>{{.Name}}</td><td>{{formatTime .LastRun}}</td><td>{{printf "%.3f" .Duration}}</td><td>{{.Success}}</td><td>{{.ScrapedMetrics}}</td>
+<td>{{.LastError}}</td><td>{{formatTime .LastErrorTime}}</td>
+</tr>
+{{- end}}
+</table>
+{{- end}}
+</body>
+</html>
+`))
+
+// newServicesHandler returns handler which responds with statuses of services in JSON.
+func newServicesHandler(repo *service.Repository) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, repo.Status())
+	})
+}
+
+// newCollectorsHandler returns handler which responds with statuses of services' collectors in JSON.
+func newCollectorsHandler(repo *service.Repository) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, repo.CollectorsStatus())
+	})
+}
+
+// newHealthzHandler returns handler which reports the application is alive.
+func newHealthzHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+}
+
+// newReadyzHandler returns handler which reports readiness of services. Until services have been discovered and
+// while any service fails health checks, the handler responds with 503.
+func newReadyzHandler(repo *service.Repository) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		readiness := repo.Readiness()
+
+		code := http.StatusOK
+		if !readiness.Ready {
+			code = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, code, readiness)
+	})
+}
+
+// newStatusPageHandler returns handler which responds with human-readable status page.
+func newStatusPageHandler(repo *service.Repository) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		data := struct {
+			Services   []service.ServiceStatus
+			Collectors []service.CollectorsStatus
+		}{repo.Status(), repo.CollectorsStatus()}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		if err := statusPageTemplate.Execute(w, data); err != nil {
+			log.Warnln("response write failed: ", err)
+		}
+	})
+}
+
+// writeJSON writes value encoded in JSON to response with specified status code.
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warnln("response write failed: ", err)
+	}
+}
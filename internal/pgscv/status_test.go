@@ -0,0 +1,91 @@
+package pgscv
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/service"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestStatusRepo(t *testing.T) *service.Repository {
+	repo := service.NewRepository()
+	repo.AddServicesFromConfig(service.Config{DisabledCollectors: []string{"system/cpu"}})
+	assert.NoError(t, repo.SetupServices(service.Config{DisabledCollectors: []string{"system/cpu"}}))
+
+	// Run collectors once, to have their last run statuses.
+	_, _ = repo.NewGatherer(context.Background()).Gather()
+
+	return repo
+}
+
+func Test_newServicesHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newServicesHandler(newTestStatusRepo(t)).ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/services", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+
+	var got []service.ServiceStatus
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Len(t, got, 1)
+	assert.Equal(t, "system:0", got[0].ServiceID)
+	assert.Contains(t, got[0].Collectors, "system/loadaverage")
+	assert.NotContains(t, got[0].Collectors, "system/cpu")
+	assert.Nil(t, got[0].Postgres)
+}
+
+func Test_newCollectorsHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newCollectorsHandler(newTestStatusRepo(t)).ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/collectors", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var got []service.CollectorsStatus
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &got))
+	assert.Len(t, got, 1)
+	assert.Equal(t, "system:0", got[0].ServiceID)
+	assert.Greater(t, len(got[0].Collectors), 0)
+	for _, c := range got[0].Collectors {
+		assert.NotNil(t, c.LastRun)
+	}
+}
+
+func Test_newStatusPageHandler(t *testing.T) {
+	h := newStatusPageHandler(newTestStatusRepo(t))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "pgSCV / Weaponry metric collector, for more info visit https://weaponry.io")
+	assert.Contains(t, rec.Body.String(), "<td>system:0</td>")
+	assert.Contains(t, rec.Body.String(), "<td>system/loadaverage</td>")
+
+	// Unknown paths are not served.
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/unknown", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func Test_newHealthzHandler(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newHealthzHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"status":"ok"}`, rec.Body.String())
+}
+
+func Test_newReadyzHandler(t *testing.T) {
+	// Services have not been discovered yet.
+	repo := service.NewRepository()
+	rec := httptest.NewRecorder()
+	newReadyzHandler(repo).ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	assert.JSONEq(t, `{"ready":false,"discovered":false,"services":[]}`, rec.Body.String())
+
+	// Services have been added from config.
+	repo.AddServicesFromConfig(service.Config{ConnSettings: []service.ConnSetting{}})
+	rec = httptest.NewRecorder()
+	newReadyzHandler(repo).ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `{"ready":true,"discovered":true,"services":[{"service_id":"system:0","service_type":"system","status":"ok","total_errors":0}]}`, rec.Body.String())
+}
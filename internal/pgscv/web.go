@@ -0,0 +1,264 @@
+package pgscv
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/service"
+	"golang.org/x/crypto/bcrypt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// scrapeTimeoutHeader is the header used by Prometheus for passing scrape timeout to scraped targets.
+const scrapeTimeoutHeader = "X-Prometheus-Scrape-Timeout-Seconds"
+
+// scrapeTimeoutOffset is subtracted from scrape timeout, to have a time for sending response to Prometheus.
+const scrapeTimeoutOffset = 500 * time.Millisecond
+
+// TLSServerConfig defines TLS settings of metrics listener, settings follow exporter-toolkit web configuration.
+type TLSServerConfig struct {
+	// CertFile is the path to server certificate.
+	CertFile string `yaml:"cert_file"`
+	// KeyFile is the path to server certificate's key.
+	KeyFile string `yaml:"key_file"`
+	// ClientAuthType defines policy of client certificates verification.
+	ClientAuthType string `yaml:"client_auth_type"`
+	// ClientCAFile is the path to CA bundle used for clients certificates verification.
+	ClientCAFile string `yaml:"client_ca_file"`
+}
+
+// enabled returns true if TLS is configured.
+func (c TLSServerConfig) enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// validate checks TLS settings.
+func (c TLSServerConfig) validate() error {
+	if !c.enabled() {
+		if c.ClientCAFile != "" || c.ClientAuthType != "" {
+			return fmt.Errorf("client certificates verification requires cert_file and key_file")
+		}
+		return nil
+	}
+
+	if c.CertFile == "" || c.KeyFile == "" {
+		return fmt.Errorf("both cert_file and key_file should be specified")
+	}
+
+	authType, err := parseClientAuthType(c.ClientAuthType)
+	if err != nil {
+		return err
+	}
+
+	if authType == tls.VerifyClientCertIfGiven || authType == tls.RequireAndVerifyClientCert {
+		if c.ClientCAFile == "" {
+			return fmt.Errorf("client_ca_file should be specified for client_auth_type %s", c.ClientAuthType)
+		}
+	}
+
+	return nil
+}
+
+// parseClientAuthType converts name of client authentication policy to tls.ClientAuthType.
+func parseClientAuthType(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case "", "NoClientCert":
+		return tls.NoClientCert, nil
+	case "RequestClientCert":
+		return tls.RequestClientCert, nil
+	case "RequireAnyClientCert":
+		return tls.RequireAnyClientCert, nil
+	case "VerifyClientCertIfGiven":
+		return tls.VerifyClientCertIfGiven, nil
+	case "RequireAndVerifyClientCert":
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("invalid client_auth_type: %s", s)
+	}
+}
+
+// newServerTLSConfig creates TLS config for metrics listener.
+func newServerTLSConfig(c TLSServerConfig) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	authType, err := parseClientAuthType(c.ClientAuthType)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   authType,
+	}
+
+	if c.ClientCAFile == "" {
+		return config, nil
+	}
+
+	content, err := os.ReadFile(filepath.Clean(c.ClientCAFile))
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(content) {
+		return nil, fmt.Errorf("no certificates found in %s", c.ClientCAFile)
+	}
+
+	config.ClientCAs = pool
+
+	return config, nil
+}
+
+// basicAuthHandler is the HTTP middleware which performs basic authentication of users with bcrypt-hashed passwords.
+type basicAuthHandler struct {
+	users map[string]string
+	// public defines paths served without authentication.
+	public map[string]bool
+	next   http.Handler
+	mu     sync.Mutex
+	// cache keeps hashes of successfully verified requisites, bcrypt is intentionally slow for checking it every time.
+	cache map[string]bool
+}
+
+// newBasicAuthHandler creates basic authentication middleware, requests to public paths are passed as is.
+func newBasicAuthHandler(users map[string]string, next http.Handler, public ...string) *basicAuthHandler {
+	paths := make(map[string]bool, len(public))
+	for _, p := range public {
+		paths[p] = true
+	}
+
+	return &basicAuthHandler{users: users, public: paths, next: next, cache: map[string]bool{}}
+}
+
+// ServeHTTP implements http.Handler interface.
+func (h *basicAuthHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.public[r.URL.Path] {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	user, pass, ok := r.BasicAuth()
+	if ok && h.authenticate(user, pass) {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("WWW-Authenticate", `Basic realm="pgSCV"`)
+	http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+}
+
+// authenticate checks passed requisites against configured users.
+func (h *basicAuthHandler) authenticate(user, pass string) bool {
+	hash, ok := h.users[user]
+	if !ok {
+		// Compare with dummy hash for making timing of unknown and known users similar.
+		_ = bcrypt.CompareHashAndPassword([]byte("$2y$10$QOauhQNbBCuQDKes6eFzPeMqBSjb7Mr5DUmpZ/VcEd00UAV/LDeSi"), []byte(pass))
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(user + ":" + hash + ":" + pass))
+	key := hex.EncodeToString(sum[:])
+
+	h.mu.Lock()
+	cached := h.cache[key]
+	h.mu.Unlock()
+
+	if cached {
+		return true
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(pass)) != nil {
+		return false
+	}
+
+	h.mu.Lock()
+	h.cache[key] = true
+	h.mu.Unlock()
+
+	return true
+}
+
+// validateBasicAuthUsers checks passwords of users are valid bcrypt hashes.
+func validateBasicAuthUsers(users map[string]string) error {
+	for user, hash := range users {
+		if user == "" {
+			return fmt.Errorf("empty username in basic_auth_users")
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return fmt.Errorf("invalid bcrypt hash for user %s: %s", user, err)
+		}
+	}
+	return nil
+}
+
+// newMetricsHandler creates handler of metrics requests. Metrics of services are collected using request context,
+// which deadline is taken from scrape timeout passed by Prometheus.
+func newMetricsHandler(repo *service.Repository) http.Handler {
+	return promhttp.InstrumentMetricHandler(prometheus.DefaultRegisterer, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if timeout := scrapeTimeout(r); timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		// Services metrics are gathered by per-request gatherer, because they depend on request context.
+		gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, repo.NewGatherer(ctx)}
+		promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	}))
+}
+
+// scrapeTimeout returns scrape timeout passed by Prometheus reduced by offset. Zero is returned if timeout is not passed.
+func scrapeTimeout(r *http.Request) time.Duration {
+	v := r.Header.Get(scrapeTimeoutHeader)
+	if v == "" {
+		return 0
+	}
+
+	seconds, err := strconv.ParseFloat(v, 64)
+	if err != nil || seconds <= 0 {
+		log.Warnf("invalid %s header value '%s'; ignore", scrapeTimeoutHeader, v)
+		return 0
+	}
+
+	timeout := time.Duration(seconds * float64(time.Second))
+	if timeout > scrapeTimeoutOffset {
+		timeout -= scrapeTimeoutOffset
+	}
+
+	return timeout
+}
+
+// newConcurrencyLimiter creates middleware which limits number of concurrently served requests by all wrapped handlers.
+// Requests over the limit are rejected immediately, because waiting scrapers likely would time out anyway.
+func newConcurrencyLimiter(limit int) func(http.Handler) http.Handler {
+	sem := make(chan struct{}, limit)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+				next.ServeHTTP(w, r)
+			default:
+				http.Error(w, fmt.Sprintf("too many concurrent requests, limit is %d", limit), http.StatusServiceUnavailable)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package pgscv
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/service"
+	"golang.org/x/crypto/bcrypt"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTLSServerConfig_validate(t *testing.T) {
+	testcases := []struct {
+		valid bool
+		in    TLSServerConfig
+	}{
+		{valid: true, in: TLSServerConfig{}},
+		{valid: true, in: TLSServerConfig{CertFile: "server.crt", KeyFile: "server.key"}},
+		{valid: true, in: TLSServerConfig{CertFile: "server.crt", KeyFile: "server.key", ClientAuthType: "RequireAnyClientCert"}},
+		{valid: true, in: TLSServerConfig{CertFile: "server.crt", KeyFile: "server.key", ClientAuthType: "RequireAndVerifyClientCert", ClientCAFile: "ca.crt"}},
+		{valid: false, in: TLSServerConfig{KeyFile: "server.key"}},
+		{valid: false, in: TLSServerConfig{ClientCAFile: "ca.crt"}},
+		{valid: false, in: TLSServerConfig{CertFile: "server.crt", KeyFile: "server.key", ClientAuthType: "invalid"}},
+		{valid: false, in: TLSServerConfig{CertFile: "server.crt", KeyFile: "server.key", ClientAuthType: "VerifyClientCertIfGiven"}},
+	}
+
+	for _, tc := range testcases {
+		if tc.valid {
+			assert.NoError(t, tc.in.validate())
+		} else {
+			assert.Error(t, tc.in.validate())
+		}
+	}
+}
+
+func Test_basicAuthHandler(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	h := newBasicAuthHandler(map[string]string{"user": string(hash)}, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}), "/healthz")
+
+	testcases := []struct {
+		path string
+		user string
+		pass string
+		want int
+	}{
+		{path: "/metrics", user: "user", pass: "secret", want: http.StatusOK},
+		{path: "/metrics", user: "user", pass: "secret", want: http.StatusOK}, // cached
+		{path: "/metrics", user: "user", pass: "invalid", want: http.StatusUnauthorized},
+		{path: "/metrics", user: "unknown", pass: "secret", want: http.StatusUnauthorized},
+		{path: "/metrics", want: http.StatusUnauthorized},
+		{path: "/healthz", want: http.StatusOK},
+		{path: "/healthz/", want: http.StatusUnauthorized},
+	}
+
+	for _, tc := range testcases {
+		req := httptest.NewRequest("GET", tc.path, nil)
+		if tc.user != "" {
+			req.SetBasicAuth(tc.user, tc.pass)
+		}
+
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		assert.Equal(t, tc.want, rec.Code)
+	}
+
+	assert.NoError(t, validateBasicAuthUsers(map[string]string{"user": string(hash)}))
+	assert.Error(t, validateBasicAuthUsers(map[string]string{"user": "secret"}))
+	assert.Error(t, validateBasicAuthUsers(map[string]string{"": string(hash)}))
+}
+
+func Test_newMetricsHandler(t *testing.T) {
+	h := newMetricsHandler(service.NewRepository())
+
+	req := httptest.NewRequest("GET", "/metrics", nil)
+	req.Header.Set(scrapeTimeoutHeader, "10")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "promhttp_metric_handler_requests_total")
+}
+
+func Test_scrapeTimeout(t *testing.T) {
+	testcases := []struct {
+		header string
+		want   time.Duration
+	}{
+		{header: "", want: 0},
+		{header: "10", want: 9500 * time.Millisecond},
+		{header: "1.5", want: time.Second},
+		{header: "0.2", want: 200 * time.Millisecond},
+		{header: "0", want: 0},
+		{header: "invalid", want: 0},
+	}
+
+	for _, tc := range testcases {
+		req := httptest.NewRequest("GET", "/metrics", nil)
+		if tc.header != "" {
+			req.Header.Set(scrapeTimeoutHeader, tc.header)
+		}
+		assert.Equal(t, tc.want, scrapeTimeout(req))
+	}
+}
+
+func Test_newConcurrencyLimiter(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+
+	limit := newConcurrencyLimiter(1)
+	slow := limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+	fast := limit(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		slow.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		done <- rec.Code
+	}()
+	<-started
+
+	// Limit is shared between handlers, request over the limit is rejected.
+	rec := httptest.NewRecorder()
+	fast.ServeHTTP(rec, httptest.NewRequest("GET", "/probe", nil))
+	assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+	close(release)
+	assert.Equal(t, http.StatusOK, <-done)
+
+	rec = httptest.NewRecorder()
+	fast.ServeHTTP(rec, httptest.NewRequest("GET", "/probe", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func Test_runMetricsListener_TLS(t *testing.T) {
+	dir := t.TempDir()
+	caCert, caKey := newTestCertificate(t, dir, "ca", nil, nil)
+	newTestCertificate(t, dir, "server", caCert, caKey)
+	newTestCertificate(t, dir, "client", caCert, caKey)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	config := &Config{
+		ListenAddress: "127.0.0.1:5004",
+		TLSServerConfig: TLSServerConfig{
+			CertFile:       filepath.Join(dir, "server.crt"),
+			KeyFile:        filepath.Join(dir, "server.key"),
+			ClientAuthType: "RequireAndVerifyClientCert",
+			ClientCAFile:   filepath.Join(dir, "ca.crt"),
+		},
+		BasicAuthUsers:  map[string]string{"user": string(hash)},
+		ShutdownTimeout: time.Second,
+	}
+	assert.NoError(t, config.TLSServerConfig.validate())
+
+	wg := sync.WaitGroup{}
+	wg.Add(1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+		defer cancel()
+
+		assert.NoError(t, runMetricsListener(ctx, config, service.NewRepository()))
+		wg.Done()
+	}()
+
+	// Sleep little bit hoping it will be enough for running listener goroutine.
+	time.Sleep(500 * time.Millisecond)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	clientCert, err := tls.LoadX509KeyPair(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"))
+	assert.NoError(t, err)
+
+	// Client with valid certificate and credentials.
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool, Certificates: []tls.Certificate{clientCert}}}}
+	req, err := http.NewRequest("GET", "https://127.0.0.1:5004/", nil)
+	assert.NoError(t, err)
+	req.SetBasicAuth("user", "secret")
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	// Client with valid certificate and without credentials.
+	resp, err = client.Get("https://127.0.0.1:5004/")
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	assert.NoError(t, resp.Body.Close())
+
+	// Client without certificate.
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	_, err = client.Get("https://127.0.0.1:5004/")
+	assert.Error(t, err)
+
+	// Plain HTTP client.
+	resp, err = http.Get("http://127.0.0.1:5004/")
+	if err == nil {
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		assert.NoError(t, resp.Body.Close())
+	}
+
+	wg.Wait()
+}
+
+// newTestCertificate creates certificate and key signed by parent (or self-signed if parent is nil) and saves them
+// into <name>.crt and <name>.key files in specified directory.
+func newTestCertificate(t *testing.T, dir string, name string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.NoError(t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	assert.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	assert.NoError(t, err)
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name+".crt"), pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, name+".key"), pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600))
+
+	cert, err := x509.ParseCertificate(der)
+	assert.NoError(t, err)
+
+	return cert, key
+}
@@ -0,0 +1,215 @@
+package relabel
+
+import (
+	"fmt"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/weaponry/pgscv/internal/log"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	// ActionReplace sets target label to replacement, if regex matches concatenated source labels values.
+	ActionReplace = "replace"
+	// ActionKeep drops metrics which concatenated source labels values don't match regex.
+	ActionKeep = "keep"
+	// ActionDrop drops metrics which concatenated source labels values match regex.
+	ActionDrop = "drop"
+	// ActionLabelDrop removes labels which names match regex.
+	ActionLabelDrop = "labeldrop"
+	// ActionLabelKeep removes labels which names don't match regex.
+	ActionLabelKeep = "labelkeep"
+
+	// MetricNameLabel is the pseudo-label which contains metric name.
+	MetricNameLabel = "__name__"
+
+	defaultSeparator   = ";"
+	defaultRegex       = "(.*)"
+	defaultReplacement = "$1"
+)
+
+// Config describes single relabeling rule, rules follow Prometheus 'relabel_configs' semantics.
+type Config struct {
+	// SourceLabels is the list of labels which values are concatenated and matched against regex.
+	SourceLabels []string `yaml:"source_labels"`
+	// Separator is placed between concatenated source labels values.
+	Separator string `yaml:"separator"`
+	// Regex is the pattern matched against concatenated source labels values (or labels names). Pattern is anchored.
+	Regex string `yaml:"regex"`
+	// Compiled regex pattern.
+	RegexRE *regexp.Regexp `yaml:"-"`
+	// TargetLabel is the label which value is set by 'replace' action.
+	TargetLabel string `yaml:"target_label"`
+	// Replacement is the value written to target label, regex capture groups could be referenced.
+	Replacement string `yaml:"replacement"`
+	// Action defines what to do when regex matches.
+	Action string `yaml:"action"`
+}
+
+// UnmarshalYAML implements yaml.Unmarshaler interface. Defaults are set before unmarshalling, this allows to
+// distinguish omitted values from explicitly specified empty values.
+func (cfg *Config) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	*cfg = Config{Separator: defaultSeparator, Regex: defaultRegex, Replacement: defaultReplacement, Action: ActionReplace}
+
+	type plain Config
+	return unmarshal((*plain)(cfg))
+}
+
+// Configs is the list of relabeling rules applied in order.
+type Configs []Config
+
+// Compile walks through rules, checks them, sets default values and compiles regexps.
+func (c Configs) Compile() error {
+	log.Debug("compile relabel configs")
+
+	for i, cfg := range c {
+		if cfg.Action == "" {
+			cfg.Action = ActionReplace
+		}
+		if cfg.Separator == "" {
+			cfg.Separator = defaultSeparator
+		}
+		if cfg.Regex == "" {
+			cfg.Regex = defaultRegex
+		}
+
+		switch cfg.Action {
+		case ActionReplace:
+			if cfg.TargetLabel == "" {
+				return fmt.Errorf("relabel config %d: target_label is required for '%s' action", i, cfg.Action)
+			}
+		case ActionKeep, ActionDrop:
+			if len(cfg.SourceLabels) == 0 {
+				return fmt.Errorf("relabel config %d: source_labels are required for '%s' action", i, cfg.Action)
+			}
+		case ActionLabelDrop, ActionLabelKeep:
+			if len(cfg.SourceLabels) > 0 || cfg.TargetLabel != "" {
+				return fmt.Errorf("relabel config %d: source_labels and target_label are not allowed for '%s' action", i, cfg.Action)
+			}
+		default:
+			return fmt.Errorf("relabel config %d: unknown action '%s'", i, cfg.Action)
+		}
+
+		re, err := regexp.Compile("^(?:" + cfg.Regex + ")$")
+		if err != nil {
+			return fmt.Errorf("relabel config %d: %s", i, err)
+		}
+		cfg.RegexRE = re
+
+		// Save updated config back to list.
+		c[i] = cfg
+	}
+
+	log.Debug("relabel configs compiled successfully")
+	return nil
+}
+
+// Process applies rules to labels in place. Metric name is passed in labels as MetricNameLabel. Returns false, if
+// metric should be dropped.
+func (c Configs) Process(labels map[string]string) bool {
+	for _, cfg := range c {
+		if !cfg.process(labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ProcessFamilies applies rules to gathered metrics. Metrics renamed by rules are moved to families with new names,
+// which are created if necessary. Families are returned sorted by name.
+func (c Configs) ProcessFamilies(families []*dto.MetricFamily) []*dto.MetricFamily {
+	byName := map[string]*dto.MetricFamily{}
+
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			labels := map[string]string{MetricNameLabel: mf.GetName()}
+			for _, lp := range m.GetLabel() {
+				labels[lp.GetName()] = lp.GetValue()
+			}
+
+			if !c.Process(labels) {
+				continue
+			}
+
+			name := labels[MetricNameLabel]
+			delete(labels, MetricNameLabel)
+
+			names := make([]string, 0, len(labels))
+			for k := range labels {
+				names = append(names, k)
+			}
+			sort.Strings(names)
+
+			m.Label = make([]*dto.LabelPair, len(names))
+			for i := range names {
+				k, v := names[i], labels[names[i]]
+				m.Label[i] = &dto.LabelPair{Name: &k, Value: &v}
+			}
+
+			target, ok := byName[name]
+			if !ok {
+				target = &dto.MetricFamily{Name: &name, Help: mf.Help, Type: mf.Type}
+				byName[name] = target
+			}
+			target.Metric = append(target.Metric, m)
+		}
+	}
+
+	result := make([]*dto.MetricFamily, 0, len(byName))
+	for _, mf := range byName {
+		result = append(result, mf)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].GetName() < result[j].GetName() })
+
+	return result
+}
+
+// process applies single rule to labels. Returns false, if metric should be dropped.
+func (cfg Config) process(labels map[string]string) bool {
+	switch cfg.Action {
+	case ActionKeep:
+		return cfg.RegexRE.MatchString(cfg.sourceValue(labels))
+	case ActionDrop:
+		return !cfg.RegexRE.MatchString(cfg.sourceValue(labels))
+	case ActionReplace:
+		value := cfg.sourceValue(labels)
+		indexes := cfg.RegexRE.FindStringSubmatchIndex(value)
+		if indexes == nil {
+			return true
+		}
+
+		target := string(cfg.RegexRE.ExpandString(nil, cfg.Replacement, value, indexes))
+		if target == "" {
+			// Metric name can't be empty, keep it as is.
+			if cfg.TargetLabel != MetricNameLabel {
+				delete(labels, cfg.TargetLabel)
+			}
+			return true
+		}
+		labels[cfg.TargetLabel] = target
+	case ActionLabelDrop, ActionLabelKeep:
+		// Metric name is never removed by label actions.
+		for name := range labels {
+			if name == MetricNameLabel {
+				continue
+			}
+			if cfg.RegexRE.MatchString(name) == (cfg.Action == ActionLabelDrop) {
+				delete(labels, name)
+			}
+		}
+	}
+
+	return true
+}
+
+// sourceValue returns concatenated values of source labels, missing labels are treated as empty strings.
+func (cfg Config) sourceValue(labels map[string]string) string {
+	values := make([]string, len(cfg.SourceLabels))
+	for i, name := range cfg.SourceLabels {
+		values[i] = labels[name]
+	}
+
+	return strings.Join(values, cfg.Separator)
+}
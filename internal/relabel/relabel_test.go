@@ -0,0 +1,173 @@
+package relabel
+
+import (
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+	"testing"
+)
+
+func TestConfig_UnmarshalYAML(t *testing.T) {
+	var configs Configs
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+- source_labels: [datname]
+  target_label: database
+- source_labels: [datname]
+  target_label: datname
+  replacement: ""
+`), &configs))
+
+	assert.Equal(t, Configs{
+		{SourceLabels: []string{"datname"}, Separator: ";", Regex: "(.*)", TargetLabel: "database", Replacement: "$1", Action: "replace"},
+		{SourceLabels: []string{"datname"}, Separator: ";", Regex: "(.*)", TargetLabel: "datname", Replacement: "", Action: "replace"},
+	}, configs)
+}
+
+func TestConfigs_Compile(t *testing.T) {
+	var testcases = []struct {
+		name  string
+		valid bool
+		in    Configs
+	}{
+		{name: "empty configs", valid: true, in: Configs{}},
+		{name: "valid replace", valid: true, in: Configs{{SourceLabels: []string{"datname"}, TargetLabel: "database", Replacement: "$1"}}},
+		{name: "valid drop", valid: true, in: Configs{{SourceLabels: []string{"__name__"}, Regex: "postgres_table_.+", Action: "drop"}}},
+		{name: "valid labeldrop", valid: true, in: Configs{{Regex: "instance", Action: "labeldrop"}}},
+		{name: "replace without target", valid: false, in: Configs{{SourceLabels: []string{"datname"}}}},
+		{name: "keep without source", valid: false, in: Configs{{Regex: "test", Action: "keep"}}},
+		{name: "labelkeep with target", valid: false, in: Configs{{TargetLabel: "test", Action: "labelkeep"}}},
+		{name: "unknown action", valid: false, in: Configs{{SourceLabels: []string{"datname"}, Action: "unknown"}}},
+		{name: "invalid regex", valid: false, in: Configs{{SourceLabels: []string{"datname"}, Regex: "[", Action: "drop"}}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.in.Compile()
+			if tc.valid {
+				assert.NoError(t, err)
+				for _, c := range tc.in {
+					assert.NotNil(t, c.RegexRE)
+				}
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestConfigs_Process(t *testing.T) {
+	var testcases = []struct {
+		name    string
+		configs Configs
+		in      map[string]string
+		want    map[string]string
+	}{
+		{
+			name:    "drop by name and label",
+			configs: Configs{{SourceLabels: []string{"__name__", "schema"}, Regex: "postgres_table_.+;pg_temp.*", Action: "drop"}},
+			in:      map[string]string{"__name__": "postgres_table_seq_scan_total", "schema": "pg_temp_3"},
+			want:    nil,
+		},
+		{
+			name:    "drop not matched",
+			configs: Configs{{SourceLabels: []string{"__name__", "schema"}, Regex: "postgres_table_.+;pg_temp.*", Action: "drop"}},
+			in:      map[string]string{"__name__": "postgres_table_seq_scan_total", "schema": "public"},
+			want:    map[string]string{"__name__": "postgres_table_seq_scan_total", "schema": "public"},
+		},
+		{
+			name:    "keep matched",
+			configs: Configs{{SourceLabels: []string{"datname"}, Regex: "app.*", Action: "keep"}},
+			in:      map[string]string{"__name__": "postgres_database_size_bytes", "datname": "app1"},
+			want:    map[string]string{"__name__": "postgres_database_size_bytes", "datname": "app1"},
+		},
+		{
+			name:    "keep not matched",
+			configs: Configs{{SourceLabels: []string{"datname"}, Regex: "app.*", Action: "keep"}},
+			in:      map[string]string{"__name__": "postgres_database_size_bytes", "datname": "postgres"},
+			want:    nil,
+		},
+		{
+			name:    "replace with capture group",
+			configs: Configs{{SourceLabels: []string{"datname"}, Regex: "(.+)_production", TargetLabel: "datname", Replacement: "$1"}},
+			in:      map[string]string{"__name__": "postgres_database_size_bytes", "datname": "app_production"},
+			want:    map[string]string{"__name__": "postgres_database_size_bytes", "datname": "app"},
+		},
+		{
+			name:    "replace with empty value removes label",
+			configs: Configs{{SourceLabels: []string{"datname"}, TargetLabel: "datname", Replacement: ""}},
+			in:      map[string]string{"__name__": "postgres_database_size_bytes", "datname": "app"},
+			want:    map[string]string{"__name__": "postgres_database_size_bytes"},
+		},
+		{
+			name:    "rename metric",
+			configs: Configs{{SourceLabels: []string{"__name__"}, Regex: "postgres_(.+)", TargetLabel: "__name__", Replacement: "pg_$1"}},
+			in:      map[string]string{"__name__": "postgres_up", "instance": "test"},
+			want:    map[string]string{"__name__": "pg_up", "instance": "test"},
+		},
+		{
+			name:    "labeldrop",
+			configs: Configs{{Regex: "instance|service_id", Action: "labeldrop"}},
+			in:      map[string]string{"__name__": "postgres_up", "instance": "test", "service_id": "postgres:5432", "datname": "app"},
+			want:    map[string]string{"__name__": "postgres_up", "datname": "app"},
+		},
+		{
+			name:    "labelkeep keeps metric name",
+			configs: Configs{{Regex: "datname", Action: "labelkeep"}},
+			in:      map[string]string{"__name__": "postgres_up", "instance": "test", "datname": "app"},
+			want:    map[string]string{"__name__": "postgres_up", "datname": "app"},
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.NoError(t, tc.configs.Compile())
+			if tc.want == nil {
+				assert.False(t, tc.configs.Process(tc.in))
+				return
+			}
+			assert.True(t, tc.configs.Process(tc.in))
+			assert.Equal(t, tc.want, tc.in)
+		})
+	}
+}
+
+func TestConfigs_ProcessFamilies(t *testing.T) {
+	name1, name2, help, label, value1, value2 := "metric1", "metric2", "Example metric.", "example", "a", "b"
+	gauge, v := dto.MetricType_GAUGE, 1.0
+
+	families := []*dto.MetricFamily{
+		{
+			Name: &name1, Help: &help, Type: &gauge,
+			Metric: []*dto.Metric{
+				{Label: []*dto.LabelPair{{Name: &label, Value: &value1}}, Gauge: &dto.Gauge{Value: &v}},
+				{Label: []*dto.LabelPair{{Name: &label, Value: &value2}}, Gauge: &dto.Gauge{Value: &v}},
+			},
+		},
+		{
+			Name: &name2, Help: &help, Type: &gauge,
+			Metric: []*dto.Metric{{Gauge: &dto.Gauge{Value: &v}}},
+		},
+	}
+
+	configs := Configs{
+		{SourceLabels: []string{"__name__"}, Regex: "metric2", Action: "drop"},
+		{SourceLabels: []string{"example"}, Regex: "b", TargetLabel: "__name__", Replacement: "metric3"},
+		{TargetLabel: "env", Replacement: "test"},
+	}
+	assert.NoError(t, configs.Compile())
+
+	got := configs.ProcessFamilies(families)
+	assert.Len(t, got, 2)
+
+	assert.Equal(t, "metric1", got[0].GetName())
+	assert.Equal(t, help, got[0].GetHelp())
+	assert.Len(t, got[0].Metric, 1)
+	assert.Equal(t, "env", got[0].Metric[0].Label[0].GetName())
+	assert.Equal(t, "example", got[0].Metric[0].Label[1].GetName())
+	assert.Equal(t, "a", got[0].Metric[0].Label[1].GetValue())
+
+	assert.Equal(t, "metric3", got[1].GetName())
+	assert.Equal(t, dto.MetricType_GAUGE, got[1].GetType())
+	assert.Len(t, got[1].Metric, 1)
+	assert.Equal(t, "b", got[1].Metric[0].Label[1].GetValue())
+}
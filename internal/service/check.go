@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/weaponry/pgscv/internal/collector"
+	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/model"
+	"sort"
+)
+
+// ServiceCheck describes result of the service's check: connection to the service and single run of every enabled
+// collector.
+type ServiceCheck struct {
+	// ServiceID is the ID of the service, for services failed to connect the type of the service is used.
+	ServiceID string
+	// Conninfo is the connection string with removed password.
+	Conninfo string
+	// Err describes why the service could not be connected or set up.
+	Err error
+	// Collectors contains results of collectors runs.
+	Collectors []collector.CheckResult
+}
+
+// Failed returns true if the service or any of its collectors failed.
+func (c ServiceCheck) Failed() bool {
+	if c.Err != nil {
+		return true
+	}
+
+	for _, r := range c.Collectors {
+		if r.Failed() {
+			return true
+		}
+	}
+
+	return false
+}
+
+// check adds services defined in config or discovers them once, adds services defined in files, sets up collectors of
+// services and runs every collector once. Services which failed to connect are reported too.
+func (repo *Repository) check(ctx context.Context, config Config) []ServiceCheck {
+	var checks []ServiceCheck
+
+	if config.ConnSettings == nil {
+		log.Info("check: discovering services")
+		repo.setConfig(config)
+		repo.addService("system:0", Service{ServiceID: "system:0", ConnSettings: ConnSetting{ServiceType: model.ServiceTypeSystem}})
+		repo.discoverServices()
+	} else {
+		// Services which failed to connect are not added to the repo, check connections in advance to report errors.
+		for _, source := range config.ConnSettings {
+			cs, err := source.ResolvePassword()
+			if err == nil {
+				err = attemptConnect(cs.Conninfo)
+			}
+			if err != nil {
+				checks = append(checks, ServiceCheck{ServiceID: cs.ServiceType, Conninfo: sanitizeConninfo(cs.Conninfo), Err: err})
+			}
+		}
+
+		repo.addServicesFromConfig(config)
+	}
+
+	if len(config.FileSD.Files) > 0 {
+		log.Info("check: reading services from files")
+		targets, _ := readFileSDTargets(config.FileSD.Files)
+		for _, t := range targets {
+			cs, err := t.cs.ResolvePassword()
+			if err == nil {
+				err = attemptConnect(cs.Conninfo)
+			}
+			if err != nil {
+				checks = append(checks, ServiceCheck{ServiceID: cs.ServiceType, Conninfo: sanitizeConninfo(cs.Conninfo), Err: err})
+			}
+		}
+
+		repo.syncFileServices(config)
+	}
+
+	if err := repo.setupServices(config); err != nil {
+		log.Errorf("check: setup services failed: %s", err)
+	}
+
+	ids := repo.getServiceIDs()
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		s := repo.getService(id)
+		check := ServiceCheck{ServiceID: s.ServiceID, Conninfo: sanitizeConninfo(s.ConnSettings.Conninfo)}
+
+		mc, ok := s.Collector.(*collector.PgscvCollector)
+		if !ok {
+			check.Err = fmt.Errorf("service setup failed")
+			// Setup of Postgres services fails when service's properties can't be read, read them again to get the reason.
+			if s.ConnSettings.ServiceType == model.ServiceTypePostgresql {
+				if _, err := collector.NewPostgresServiceConfig(s.ConnSettings.Conninfo); err != nil {
+					check.Err = fmt.Errorf("service setup failed: %s", err)
+				}
+			}
+			checks = append(checks, check)
+			continue
+		}
+
+		log.Infof("check: running collectors of service [%s]", s.ServiceID)
+		check.Collectors = mc.Check(ctx)
+		checks = append(checks, check)
+	}
+
+	return checks
+}
@@ -0,0 +1,46 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/collector"
+	"github.com/weaponry/pgscv/internal/model"
+	"testing"
+)
+
+func TestRepository_check(t *testing.T) {
+	config := Config{
+		ConnSettings: []ConnSetting{
+			{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1 port=1 user=pgscv password=secret dbname=pgscv_fixtures connect_timeout=1"},
+		},
+		DisabledCollectors: []string{"system/cpu", "system/diskstats", "system/filesystems", "system/netdev", "system/network", "system/sysconfig"},
+	}
+
+	repo := NewRepository()
+	checks := repo.check(context.Background(), config)
+	assert.Len(t, checks, 2)
+
+	// Service is not available.
+	assert.Equal(t, "postgres", checks[0].ServiceID)
+	assert.Equal(t, "host=127.0.0.1 port=1 user=pgscv password=xxxxx dbname=pgscv_fixtures connect_timeout=1", checks[0].Conninfo)
+	assert.Error(t, checks[0].Err)
+	assert.True(t, checks[0].Failed())
+
+	// System service is always checked.
+	assert.Equal(t, "system:0", checks[1].ServiceID)
+	assert.NoError(t, checks[1].Err)
+	assert.Equal(t, []collector.CheckResult{
+		{Name: "system/loadaverage", Status: collector.CheckStatusOK},
+		{Name: "system/memory", Status: collector.CheckStatusOK},
+		{Name: "system/pgscv", Status: collector.CheckStatusOK},
+	}, checks[1].Collectors)
+	assert.False(t, checks[1].Failed())
+}
+
+func TestServiceCheck_Failed(t *testing.T) {
+	assert.False(t, ServiceCheck{}.Failed())
+	assert.True(t, ServiceCheck{Err: fmt.Errorf("failed")}.Failed())
+	assert.False(t, ServiceCheck{Collectors: []collector.CheckResult{{Status: collector.CheckStatusSkipped}}}.Failed())
+	assert.True(t, ServiceCheck{Collectors: []collector.CheckResult{{Status: collector.CheckStatusOK}, {Status: collector.CheckStatusPermissionDenied}}}.Failed())
+}
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/weaponry/pgscv/internal/model"
+	"os"
+	"sync"
+)
+
+// availabilityCollector collects availability metrics of services in the repo.
+type availabilityCollector struct {
+	services []Service
+	// up describes availability of the service according to its health checks.
+	up *prometheus.Desc
+	// failures describes total number of failed health checks of the service.
+	failures *prometheus.Desc
+}
+
+// newAvailabilityCollector creates collector of availability metrics of passed services.
+func newAvailabilityCollector(services []Service, instance string) *availabilityCollector {
+	labels := prometheus.Labels{"instance": instance}
+
+	return &availabilityCollector{
+		services: services,
+		up: prometheus.NewDesc(
+			prometheus.BuildFQName("pgscv", "service", "up"),
+			"Value is 1 if the last health check of the service succeeded, 0 otherwise.",
+			[]string{"service_id"}, labels,
+		),
+		failures: prometheus.NewDesc(
+			prometheus.BuildFQName("pgscv", "service", "healthcheck_failures_total"),
+			"Total number of failed health checks of the service.",
+			[]string{"service_id"}, labels,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector interface. Set of services changes over time, hence no descriptors are
+// sent and collector is unchecked.
+func (c *availabilityCollector) Describe(_ chan<- *prometheus.Desc) {}
+
+// Collect implements prometheus.Collector interface.
+func (c *availabilityCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range c.services {
+		// Availability of services with remote endpoints is reported even if their collectors are not created.
+		if s.ConnSettings.ServiceType == model.ServiceTypePostgresql || s.ConnSettings.ServiceType == model.ServiceTypePgbouncer {
+			var up float64
+			if s.TotalErrors == 0 {
+				up = 1
+			}
+			ch <- prometheus.MustNewConstMetric(c.up, prometheus.GaugeValue, up, s.ServiceID)
+			ch <- prometheus.MustNewConstMetric(c.failures, prometheus.CounterValue, float64(s.HealthcheckFailures), s.ServiceID)
+		}
+	}
+}
+
+// repoGatherer gathers metrics of all services in the repo using specified context. The gatherer is created for
+// every scrape, so its lifetime is limited by the scrape.
+type repoGatherer struct {
+	ctx  context.Context
+	repo *Repository
+}
+
+// newGatherer creates gatherer of services metrics which uses specified context.
+func (repo *Repository) newGatherer(ctx context.Context) prometheus.Gatherer {
+	return &repoGatherer{ctx: ctx, repo: repo}
+}
+
+// Gather implements prometheus.Gatherer interface. Metrics of services are gathered concurrently, relabeling rules
+// and cardinality limits are applied to each service separately, and then metrics of all services are merged.
+func (g *repoGatherer) Gather() ([]*dto.MetricFamily, error) {
+	var services []Service
+	var collectors []Collector
+	for _, id := range g.repo.getServiceIDs() {
+		s := g.repo.getService(id)
+		services = append(services, s)
+		if s.Collector != nil {
+			collectors = append(collectors, s.Collector)
+		}
+	}
+
+	wg := sync.WaitGroup{}
+	gatherers := make(prometheus.Gatherers, len(collectors))
+	for i, sc := range collectors {
+		wg.Add(1)
+		go func(i int, sc Collector) {
+			families, err := sc.Gather(g.ctx)
+			gatherers[i] = prometheus.GathererFunc(func() ([]*dto.MetricFamily, error) { return families, err })
+			wg.Done()
+		}(i, sc)
+	}
+
+	wg.Wait()
+
+	hostname, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(newAvailabilityCollector(services, hostname))
+	gatherers = append(gatherers, registry)
+
+	// Gathered metrics are merged and checked for consistency.
+	return gatherers.Gather()
+}
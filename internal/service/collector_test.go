@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRepository_newGatherer(t *testing.T) {
+	r := NewRepository()
+	// Filesystems collector is disabled, because mounts of test environment might produce duplicate series.
+	config := Config{ConnSettings: []ConnSetting{}, DisabledCollectors: []string{"system/filesystems"}}
+	r.addServicesFromConfig(config)
+	assert.NoError(t, r.setupServices(config))
+
+	families, err := r.newGatherer(context.Background()).Gather()
+	assert.NoError(t, err)
+	assert.NotEqual(t, 0, len(families))
+
+	// Families are merged and sorted by name.
+	for i := 1; i < len(families); i++ {
+		assert.Less(t, families[i-1].GetName(), families[i].GetName())
+	}
+
+	// Empty repo has no metrics.
+	families, err = NewRepository().newGatherer(context.Background()).Gather()
+	assert.NoError(t, err)
+	assert.Len(t, families, 0)
+}
+
+func TestRepository_newGatherer_serviceUp(t *testing.T) {
+	r := NewRepository()
+	s := TestPgbouncerService()
+	r.addService(s.ServiceID, s)
+
+	gatherUp := func() map[string]float64 {
+		families, err := r.newGatherer(context.Background()).Gather()
+		assert.NoError(t, err)
+
+		values := map[string]float64{}
+		for _, mf := range families {
+			for _, m := range mf.GetMetric() {
+				assert.Equal(t, "instance", m.GetLabel()[0].GetName())
+				assert.Equal(t, "pgbouncer:6432", m.GetLabel()[1].GetValue())
+				switch mf.GetName() {
+				case "pgscv_service_up":
+					values["up"] = m.GetGauge().GetValue()
+				case "pgscv_service_healthcheck_failures_total":
+					values["failures"] = m.GetCounter().GetValue()
+				}
+			}
+		}
+		return values
+	}
+
+	// Service without collector is reported.
+	assert.Equal(t, map[string]float64{"up": 1, "failures": 0}, gatherUp())
+
+	r.markServiceFailed(s.ServiceID)
+	r.markServiceFailed(s.ServiceID)
+	assert.Equal(t, map[string]float64{"up": 0, "failures": 2}, gatherUp())
+
+	// Total number of failures is kept when service recovers.
+	r.markServiceHealthy(s.ServiceID)
+	assert.Equal(t, map[string]float64{"up": 1, "failures": 2}, gatherUp())
+}
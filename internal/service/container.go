@@ -0,0 +1,218 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	// dockerContainersDir is the directory where Docker keeps metadata of containers.
+	dockerContainersDir = "/var/lib/docker/containers"
+	// podmanContainersFile is the file where Podman (containers/storage) keeps names of containers.
+	podmanContainersFile = "/var/lib/containers/storage/overlay-containers/containers.json"
+)
+
+// containerIDRE matches container ID in cgroup path, e.g. /docker/<id>, /system.slice/docker-<id>.scope,
+// /machine.slice/libpod-<id>.scope or /kubepods/burstable/pod<uid>/<id>.
+var containerIDRE = regexp.MustCompile(`[0-9a-f]{64}`)
+
+// containerInfo describes container where the process is running.
+type containerInfo struct {
+	id    string      // container ID
+	name  string      // container name, empty if name is unknown
+	ports map[int]int // published ports, container's port is the key and host's port is the value
+}
+
+// shortID returns abbreviated container ID, as it is shown by container engines.
+func (c containerInfo) shortID() string {
+	if len(c.id) > 12 {
+		return c.id[:12]
+	}
+	return c.id
+}
+
+// labels returns labels extended with ID and name of the container. Passed labels have priority over container's labels.
+func (c containerInfo) labels(labels map[string]string) map[string]string {
+	merged := map[string]string{"container_id": c.shortID()}
+	if c.name != "" {
+		merged["container_name"] = c.name
+	}
+
+	for name, value := range labels {
+		merged[name] = value
+	}
+
+	return merged
+}
+
+// newContainerInfo returns info about container where the process with specified pid is running. Empty info is
+// returned for processes running outside of containers.
+func newContainerInfo(pid int32) (containerInfo, error) {
+	id, err := parseContainerID(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil || id == "" {
+		return containerInfo{}, err
+	}
+
+	info := containerInfo{id: id}
+
+	// Docker keeps name and published ports in container's config, Podman keeps names in storage metadata.
+	if name, ports, err := readDockerContainerConfig(filepath.Join(dockerContainersDir, id, "config.v2.json")); err == nil {
+		info.name, info.ports = name, ports
+	} else if name, err := readPodmanContainerName(podmanContainersFile, id); err == nil {
+		info.name = name
+	}
+
+	return info, nil
+}
+
+// parseContainerID reads cgroup file of the process and returns ID of the container, empty if the process is not
+// running in a container.
+func parseContainerID(cgroupFile string) (string, error) {
+	content, err := os.ReadFile(filepath.Clean(cgroupFile))
+	if err != nil {
+		return "", err
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		// Lines are in format hierarchy-ID:controller-list:cgroup-path.
+		parts := strings.SplitN(scanner.Text(), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+
+		if id := containerIDRE.FindString(parts[2]); id != "" {
+			return id, nil
+		}
+	}
+
+	return "", scanner.Err()
+}
+
+// readDockerContainerConfig reads name and published TCP ports of the container from Docker's container config.
+func readDockerContainerConfig(configFile string) (string, map[int]int, error) {
+	content, err := os.ReadFile(filepath.Clean(configFile))
+	if err != nil {
+		return "", nil, err
+	}
+
+	var config struct {
+		Name            string `json:"Name"`
+		NetworkSettings struct {
+			Ports map[string][]struct {
+				HostIP   string `json:"HostIp"`
+				HostPort string `json:"HostPort"`
+			} `json:"Ports"`
+		} `json:"NetworkSettings"`
+	}
+
+	if err := json.Unmarshal(content, &config); err != nil {
+		return "", nil, err
+	}
+
+	ports := map[int]int{}
+	for spec, bindings := range config.NetworkSettings.Ports {
+		if !strings.HasSuffix(spec, "/tcp") || len(bindings) == 0 {
+			continue
+		}
+
+		containerPort, err := strconv.Atoi(strings.TrimSuffix(spec, "/tcp"))
+		if err != nil {
+			continue
+		}
+
+		hostPort, err := strconv.Atoi(bindings[0].HostPort)
+		if err != nil {
+			continue
+		}
+
+		ports[containerPort] = hostPort
+	}
+
+	return strings.TrimPrefix(config.Name, "/"), ports, nil
+}
+
+// readPodmanContainerName reads name of the container from Podman's storage metadata.
+func readPodmanContainerName(containersFile string, id string) (string, error) {
+	content, err := os.ReadFile(filepath.Clean(containersFile))
+	if err != nil {
+		return "", err
+	}
+
+	var containers []struct {
+		ID    string   `json:"id"`
+		Names []string `json:"names"`
+	}
+
+	if err := json.Unmarshal(content, &containers); err != nil {
+		return "", err
+	}
+
+	for _, c := range containers {
+		if c.ID == id && len(c.Names) > 0 {
+			return c.Names[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("container %s not found", id)
+}
+
+// sameNetNamespace returns true if the process with specified pid uses the same network namespace as pgSCV. Processes
+// which namespace can't be read are considered to be in the same namespace.
+func sameNetNamespace(pid int32) bool {
+	self, err := os.Readlink("/proc/self/ns/net")
+	if err != nil {
+		return true
+	}
+
+	ns, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/net", pid))
+	if err != nil {
+		return true
+	}
+
+	return self == ns
+}
+
+// containerConnectionParams returns parameters for connecting to Postgres running in container. Unix socket is
+// accessed through the root directory of the postmaster process. TCP connection is made to the published port, or to
+// the listen address when the container uses host's network.
+func containerConnectionParams(p connectionParams, root string, container containerInfo, sameNetwork bool) (connectionParams, connectionParams) {
+	unix, tcp := p, p
+
+	unix.listenAddr = ""
+	if p.unixSocketDirPath != "" {
+		unix.unixSocketDirPath = filepath.Join(root, p.unixSocketDirPath)
+	}
+
+	tcp.unixSocketDirPath = ""
+	if port, ok := container.ports[p.listenPort]; ok {
+		tcp.listenAddr, tcp.listenPort = defaultHost, port
+	} else if !sameNetwork {
+		tcp.listenAddr = ""
+	}
+
+	return unix, tcp
+}
+
+// readProcessEnv returns value of the environment variable of the process, empty if variable is not set.
+func readProcessEnv(pid int32, name string) string {
+	content, err := os.ReadFile(fmt.Sprintf("/proc/%d/environ", pid))
+	if err != nil {
+		return ""
+	}
+
+	for _, kv := range strings.Split(string(content), "\x00") {
+		if strings.HasPrefix(kv, name+"=") {
+			return strings.TrimPrefix(kv, name+"=")
+		}
+	}
+
+	return ""
+}
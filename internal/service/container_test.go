@@ -0,0 +1,123 @@
+package service
+
+import (
+	"github.com/shirou/gopsutil/process"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"testing"
+)
+
+const testContainerID = "3f4b1c9a2d7e8f60a1b2c3d4e5f60718293a4b5c6d7e8f90a1b2c3d4e5f60718"
+
+func Test_parseContainerID(t *testing.T) {
+	testcases := []struct {
+		golden string
+		want   string
+	}{
+		{golden: "cgroup.v1", want: testContainerID},
+		{golden: "cgroup.v2", want: testContainerID},
+		{golden: "cgroup.libpod", want: testContainerID},
+		{golden: "cgroup.host", want: ""},
+	}
+
+	for _, tc := range testcases {
+		got, err := parseContainerID("testdata/container.d/" + tc.golden + ".golden")
+		assert.NoError(t, err)
+		assert.Equal(t, tc.want, got)
+	}
+
+	_, err := parseContainerID("testdata/container.d/unknown.golden")
+	assert.Error(t, err)
+}
+
+func Test_readDockerContainerConfig(t *testing.T) {
+	name, ports, err := readDockerContainerConfig("testdata/container.d/config.v2.json.golden")
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres-main", name)
+	assert.Equal(t, map[int]int{5432: 15432}, ports)
+
+	_, _, err = readDockerContainerConfig("testdata/container.d/invalid.json.golden")
+	assert.Error(t, err)
+	_, _, err = readDockerContainerConfig("testdata/container.d/unknown.golden")
+	assert.Error(t, err)
+}
+
+func Test_readPodmanContainerName(t *testing.T) {
+	name, err := readPodmanContainerName("testdata/container.d/containers.json.golden", testContainerID)
+	assert.NoError(t, err)
+	assert.Equal(t, "postgres-main", name)
+
+	_, err = readPodmanContainerName("testdata/container.d/containers.json.golden", "1234")
+	assert.Error(t, err)
+	_, err = readPodmanContainerName("testdata/container.d/invalid.json.golden", testContainerID)
+	assert.Error(t, err)
+}
+
+func Test_containerInfo_labels(t *testing.T) {
+	c := containerInfo{id: testContainerID, name: "postgres-main"}
+	assert.Equal(t, "3f4b1c9a2d7e", c.shortID())
+	assert.Equal(t, map[string]string{"container_id": "3f4b1c9a2d7e", "container_name": "postgres-main"}, c.labels(nil))
+
+	// User-defined labels have priority.
+	assert.Equal(t,
+		map[string]string{"container_id": "3f4b1c9a2d7e", "container_name": "main", "cluster": "main"},
+		c.labels(map[string]string{"container_name": "main", "cluster": "main"}),
+	)
+
+	// Unknown name is not used.
+	assert.Equal(t, map[string]string{"container_id": "3f4b1c9a2d7e"}, containerInfo{id: testContainerID}.labels(nil))
+}
+
+func Test_containerConnectionParams(t *testing.T) {
+	p := connectionParams{listenAddr: defaultHost, listenPort: 5432, unixSocketDirPath: "/var/run/postgresql"}
+	root := "/proc/123/root"
+
+	testcases := []struct {
+		container   containerInfo
+		sameNetwork bool
+		wantUnix    connectionParams
+		wantTCP     connectionParams
+	}{
+		{
+			// published port
+			container: containerInfo{id: testContainerID, ports: map[int]int{5432: 15432}},
+			wantUnix:  connectionParams{listenPort: 5432, unixSocketDirPath: "/proc/123/root/var/run/postgresql"},
+			wantTCP:   connectionParams{listenAddr: defaultHost, listenPort: 15432},
+		},
+		{
+			// host network
+			container:   containerInfo{id: testContainerID},
+			sameNetwork: true,
+			wantUnix:    connectionParams{listenPort: 5432, unixSocketDirPath: "/proc/123/root/var/run/postgresql"},
+			wantTCP:     connectionParams{listenAddr: defaultHost, listenPort: 5432},
+		},
+		{
+			// isolated network without published ports
+			container: containerInfo{id: testContainerID},
+			wantUnix:  connectionParams{listenPort: 5432, unixSocketDirPath: "/proc/123/root/var/run/postgresql"},
+			wantTCP:   connectionParams{listenPort: 5432},
+		},
+	}
+
+	for _, tc := range testcases {
+		unix, tcp := containerConnectionParams(p, root, tc.container, tc.sameNetwork)
+		assert.Equal(t, tc.wantUnix, unix)
+		assert.Equal(t, tc.wantTCP, tcp)
+	}
+}
+
+func Test_readProcessEnv(t *testing.T) {
+	pid := int32(os.Getpid())
+	assert.Equal(t, os.Getenv("PATH"), readProcessEnv(pid, "PATH"))
+	assert.Equal(t, "", readProcessEnv(pid, "PGSCV_UNKNOWN_VARIABLE"))
+	assert.Equal(t, "", readProcessEnv(-1, "PATH"))
+}
+
+func Test_isPostmaster(t *testing.T) {
+	proc, err := process.NewProcess(int32(os.Getpid()))
+	assert.NoError(t, err)
+
+	// Parent of tests process is not postgres.
+	assert.True(t, isPostmaster(proc))
+	assert.True(t, sameNetNamespace(proc.Pid))
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/weaponry/pgscv/internal/log"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// passwordCommandTimeout defines maximum duration of the password command run.
+const passwordCommandTimeout = 10 * time.Second
+
+// ResolvePassword returns connection settings which conninfo contains the password read from the password file or
+// the password command. Settings are returned as is when neither password file nor command is specified.
+func (cs ConnSetting) ResolvePassword() (ConnSetting, error) {
+	password, err := cs.readPassword()
+	if err != nil {
+		return cs, err
+	}
+
+	return cs.withPassword(password)
+}
+
+// hasPasswordSource returns true if password should be read from the password file or the password command.
+func (cs ConnSetting) hasPasswordSource() bool {
+	return cs.PasswordFile != "" || cs.PasswordCommand != ""
+}
+
+// readPassword reads password from the password file or from output of the password command. Trailing newlines are
+// removed. Empty password is returned when neither password file nor command is specified.
+func (cs ConnSetting) readPassword() (string, error) {
+	switch {
+	case cs.PasswordFile != "":
+		content, err := os.ReadFile(filepath.Clean(cs.PasswordFile))
+		if err != nil {
+			return "", fmt.Errorf("read password file failed: %s", err)
+		}
+
+		return strings.TrimRight(string(content), "\r\n"), nil
+	case cs.PasswordCommand != "":
+		ctx, cancel := context.WithTimeout(context.Background(), passwordCommandTimeout)
+		defer cancel()
+
+		out, err := exec.CommandContext(ctx, "/bin/sh", "-c", cs.PasswordCommand).Output() // #nosec G204
+		if err != nil {
+			return "", fmt.Errorf("run password command failed: %s", err)
+		}
+
+		return strings.TrimRight(string(out), "\r\n"), nil
+	default:
+		return "", nil
+	}
+}
+
+// withPassword returns connection settings with password added to conninfo. Password specified in conninfo is
+// replaced. Settings are returned as is when password is empty.
+func (cs ConnSetting) withPassword(password string) (ConnSetting, error) {
+	if password == "" {
+		return cs, nil
+	}
+
+	if strings.HasPrefix(cs.Conninfo, "postgres://") || strings.HasPrefix(cs.Conninfo, "postgresql://") {
+		u, err := url.Parse(cs.Conninfo)
+		if err != nil {
+			return cs, fmt.Errorf("invalid conninfo: %s", err)
+		}
+
+		q := u.Query()
+		if q.Get("password") != "" {
+			q.Del("password")
+			u.RawQuery = q.Encode()
+		}
+
+		u.User = url.UserPassword(u.User.Username(), password)
+		cs.Conninfo = u.String()
+		return cs, nil
+	}
+
+	// In 'keyword = value' format the last value of the keyword is used.
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(password)
+	cs.Conninfo = fmt.Sprintf("%s password='%s'", cs.Conninfo, escaped)
+	return cs, nil
+}
+
+// refreshCredentials re-reads password of the service. If password has been changed, connection settings of the service
+// are updated and its collector is removed, it should be created again using new settings. Returns true if password
+// has been changed.
+func (repo *Repository) refreshCredentials(id string) bool {
+	s := repo.getService(id)
+	if !s.source.hasPasswordSource() {
+		return false
+	}
+
+	cs, err := s.source.ResolvePassword()
+	if err != nil {
+		log.Warnf("service [%s] re-read password failed: %s", id, err)
+		return false
+	}
+
+	if cs.Conninfo == s.ConnSettings.Conninfo {
+		log.Debugf("service [%s] password has not been changed", id)
+		return false
+	}
+
+	if s.Collector != nil {
+		s.Collector.Close()
+		s.Collector = nil
+	}
+	s.ConnSettings = cs
+	repo.addService(id, s)
+
+	log.Infof("service [%s] password has been changed, re-connecting", id)
+	return true
+}
+
+// newAuthFailureHandler returns function which notifies the repo that collectors failed to authenticate. Password of
+// the service is re-read and its collector is re-created in background.
+func (repo *Repository) newAuthFailureHandler(id string) func() {
+	return func() {
+		repo.notify(id, notifyAuthFailure)
+	}
+}
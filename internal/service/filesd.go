@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/fsnotify/fsnotify"
+	"github.com/jackc/pgx/v4"
+	"github.com/weaponry/pgscv/internal/log"
+	"gopkg.in/yaml.v2"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultFileSDRefreshInterval defines how often files are re-read when refresh interval is not specified.
+const defaultFileSDRefreshInterval = 5 * time.Minute
+
+// FileSDConfig defines files with definitions of services. Files are watched for changes and re-read periodically,
+// services in the repo are synchronized with services defined in files.
+type FileSDConfig struct {
+	// Files defines paths of files in JSON or YAML format, the last element of the path might be a glob pattern.
+	Files []string `yaml:"files"`
+	// RefreshInterval defines how often files are re-read, services failed to connect are added at re-read.
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+}
+
+// Validate checks file patterns are valid.
+func (c FileSDConfig) Validate() error {
+	for _, pattern := range c.Files {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid file pattern '%s': %s", pattern, err)
+		}
+	}
+
+	if c.RefreshInterval < 0 {
+		return fmt.Errorf("refresh_interval should not be negative")
+	}
+
+	return nil
+}
+
+// fileSDTarget describes the service defined in the file.
+type fileSDTarget struct {
+	key  string      // key of the service in the repo
+	file string      // file where the service is defined
+	cs   ConnSetting // connection settings of the service
+}
+
+// startFileDiscovery synchronizes services in the repo with services defined in files. Files are synchronized at
+// start, when they are changed, when configuration is reloaded and every refresh interval. Passed configuration is
+// used at start, current configuration of the repo is used after that.
+func (repo *Repository) startFileDiscovery(ctx context.Context, config Config) error {
+	log.Debug("starting file discovery loop")
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = watcher.Close() }()
+
+	watched := map[string]bool{}
+
+	for {
+		updateFileSDWatches(watcher, watched, config.FileSD.Files)
+		repo.syncFileServices(config)
+
+		interval := config.FileSD.RefreshInterval
+		if interval == 0 {
+			interval = defaultFileSDRefreshInterval
+		}
+
+		if !waitFileSDChanges(ctx, watcher, repo.fileSDCh, config.FileSD.Files, interval) {
+			log.Info("file discovery: exit signaled")
+			return nil
+		}
+
+		config = repo.getConfig()
+	}
+}
+
+// waitFileSDChanges waits until files matching patterns are changed, configuration is reloaded or refresh interval
+// is elapsed. Returns false if context is canceled.
+func waitFileSDChanges(ctx context.Context, watcher *fsnotify.Watcher, reloadCh <-chan struct{}, patterns []string, interval time.Duration) bool {
+	timer := time.NewTimer(interval)
+	defer timer.Stop()
+
+	// Single update of the file might produce series of events, synchronize once when events stop.
+	var debounce <-chan time.Time
+
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return false
+			}
+			if matchFileSDPatterns(patterns, event.Name) {
+				debounce = time.After(time.Second)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return false
+			}
+			log.Warnf("file discovery: watcher failed: %s; ignore", err)
+		case <-debounce:
+			log.Debug("file discovery: files changed")
+			return true
+		case <-reloadCh:
+			return true
+		case <-timer.C:
+			return true
+		}
+	}
+}
+
+// updateFileSDWatches watches directories of files matching patterns. Directories are watched instead of files,
+// because files might be created later or replaced by renaming.
+func updateFileSDWatches(watcher *fsnotify.Watcher, watched map[string]bool, patterns []string) {
+	wanted := map[string]bool{}
+	for _, pattern := range patterns {
+		wanted[filepath.Dir(pattern)] = true
+	}
+
+	for dir := range watched {
+		if !wanted[dir] {
+			_ = watcher.Remove(dir)
+			delete(watched, dir)
+		}
+	}
+
+	for dir := range wanted {
+		if watched[dir] {
+			continue
+		}
+
+		if err := watcher.Add(dir); err != nil {
+			log.Warnf("file discovery: watch %s failed: %s; changes will be noticed at refresh", dir, err)
+			continue
+		}
+
+		watched[dir] = true
+		log.Infof("file discovery: watching for changes in %s", dir)
+	}
+}
+
+// matchFileSDPatterns returns true if file matches any of patterns.
+func matchFileSDPatterns(patterns []string, file string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(filepath.Clean(pattern), filepath.Clean(file)); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// syncFileServices reads files and synchronizes services in the repo with services defined in files: adds new
+// services, removes services which are not defined anymore and re-creates services which settings have been changed.
+// Services defined in files which could not be read are kept.
+func (repo *Repository) syncFileServices(config Config) {
+	repo.updateMu.Lock()
+	defer repo.updateMu.Unlock()
+
+	targets, failed := readFileSDTargets(config.FileSD.Files)
+
+	wanted := map[string]fileSDTarget{}
+	unique := make([]fileSDTarget, 0, len(targets))
+	for _, t := range targets {
+		if _, ok := wanted[t.key]; ok {
+			log.Warnf("file discovery: service %s is defined more than once, skip definition in %s", t.key, t.file)
+			continue
+		}
+		wanted[t.key] = t
+		unique = append(unique, t)
+	}
+
+	for _, id := range repo.getServiceIDs() {
+		s := repo.getService(id)
+		if s.sdFile == "" || failed[s.sdFile] {
+			continue
+		}
+
+		if t, ok := wanted[id]; ok && t.file == s.sdFile && t.cs.equal(s.source) {
+			continue
+		}
+
+		repo.removeService(id)
+		log.Infof("file discovery: service [%s] removed", s.ServiceID)
+	}
+
+	for _, t := range unique {
+		// Service is already added, or it is defined in config file or auto-discovered.
+		if s := repo.getService(t.key); s.ServiceID != "" {
+			continue
+		}
+
+		key, s, err := newServiceFromConnSetting(t.cs)
+		if err != nil {
+			log.Warnf("file discovery: %s: %s, skip", sanitizeConninfo(t.cs.Conninfo), err)
+			continue
+		}
+
+		s.sdFile = t.file
+		repo.addService(key, s)
+		log.Infof("file discovery: service added [%s] from %s", s.ServiceID, t.file)
+	}
+
+	if err := repo.setupServices(config); err != nil {
+		log.Warnf("file discovery: services setup failed: %s", err)
+	}
+}
+
+// readFileSDTargets reads services from files matching patterns. Returns services and files which could not be read.
+func readFileSDTargets(patterns []string) ([]fileSDTarget, map[string]bool) {
+	var targets []fileSDTarget
+	failed := map[string]bool{}
+
+	for _, pattern := range patterns {
+		files, err := filepath.Glob(pattern)
+		if err != nil {
+			log.Warnf("file discovery: invalid pattern %s: %s; skip", pattern, err)
+			continue
+		}
+
+		for _, file := range files {
+			settings, err := readFileSDFile(file)
+			if err != nil {
+				log.Warnf("file discovery: read %s failed: %s; keep its services", file, err)
+				failed[file] = true
+				continue
+			}
+
+			for _, cs := range settings {
+				pgconfig, err := pgx.ParseConfig(cs.Conninfo)
+				if err != nil {
+					continue // already checked by validation
+				}
+				targets = append(targets, fileSDTarget{key: newServiceKey(cs.ServiceType, pgconfig), file: file, cs: cs})
+			}
+		}
+	}
+
+	return targets, failed
+}
+
+// readFileSDFile reads and validates services defined in the file. Files with '.json' extension are parsed as JSON,
+// other files are parsed as YAML.
+func readFileSDFile(file string) ([]ConnSetting, error) {
+	content, err := os.ReadFile(filepath.Clean(file))
+	if err != nil {
+		return nil, err
+	}
+
+	var settings []ConnSetting
+	if strings.ToLower(filepath.Ext(file)) == ".json" {
+		err = json.Unmarshal(content, &settings)
+	} else {
+		err = yaml.Unmarshal(content, &settings)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cs := range settings {
+		if err := cs.Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return settings, nil
+}
@@ -0,0 +1,124 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/model"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileSDConfig_Validate(t *testing.T) {
+	assert.NoError(t, FileSDConfig{}.Validate())
+	assert.NoError(t, FileSDConfig{Files: []string{"/etc/pgscv/targets/*.yaml", "/etc/pgscv/targets.json"}, RefreshInterval: time.Minute}.Validate())
+	assert.Error(t, FileSDConfig{Files: []string{"/etc/pgscv/targets/[.yaml"}}.Validate())
+	assert.Error(t, FileSDConfig{RefreshInterval: -time.Minute}.Validate())
+}
+
+func Test_matchFileSDPatterns(t *testing.T) {
+	patterns := []string{"/etc/pgscv/targets/*.yaml", "/etc/pgscv/targets.json"}
+
+	assert.True(t, matchFileSDPatterns(patterns, "/etc/pgscv/targets/main.yaml"))
+	assert.True(t, matchFileSDPatterns(patterns, "/etc/pgscv/targets.json"))
+	assert.False(t, matchFileSDPatterns(patterns, "/etc/pgscv/targets/main.yaml.swp"))
+	assert.False(t, matchFileSDPatterns(patterns, "/etc/pgscv/pgscv.yaml"))
+	assert.False(t, matchFileSDPatterns(nil, "/etc/pgscv/targets.json"))
+}
+
+func Test_readFileSDFile(t *testing.T) {
+	for _, file := range []string{"testdata/filesd.d/services.json", "testdata/filesd.d/services.yaml"} {
+		settings, err := readFileSDFile(file)
+		assert.NoError(t, err)
+		assert.Len(t, settings, 2)
+
+		assert.Equal(t, model.ServiceTypePostgresql, settings[0].ServiceType)
+		assert.Equal(t, "host=127.0.0.1 port=5432 user=pgscv dbname=pgscv_fixtures", settings[0].Conninfo)
+		assert.Equal(t, map[string]string{"cluster": "main"}, settings[0].Labels)
+
+		assert.Equal(t, model.ServiceTypePgbouncer, settings[1].ServiceType)
+		assert.Equal(t, []string{"pgbouncer/settings"}, settings[1].DisableCollectors)
+	}
+
+	_, err := readFileSDFile("testdata/filesd.d/invalid.yaml")
+	assert.Error(t, err)
+	_, err = readFileSDFile("testdata/filesd.d/unknown.yaml")
+	assert.Error(t, err)
+}
+
+func Test_readFileSDTargets(t *testing.T) {
+	targets, failed := readFileSDTargets([]string{"testdata/filesd.d/*.yaml"})
+	assert.Len(t, targets, 2)
+	assert.Equal(t, "postgres:127.0.0.1:5432", targets[0].key)
+	assert.Equal(t, "pgbouncer:127.0.0.1:6432", targets[1].key)
+	assert.Equal(t, "testdata/filesd.d/services.yaml", targets[0].file)
+	assert.Equal(t, map[string]bool{"testdata/filesd.d/invalid.yaml": true}, failed)
+
+	targets, failed = readFileSDTargets([]string{"testdata/filesd.d/unknown.json"})
+	assert.Len(t, targets, 0)
+	assert.Len(t, failed, 0)
+}
+
+func TestRepository_syncFileServices(t *testing.T) {
+	dir, err := os.MkdirTemp("", "pgscv-filesd-")
+	assert.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	file := filepath.Join(dir, "services.yaml")
+	content, err := os.ReadFile("testdata/filesd.d/services.yaml")
+	assert.NoError(t, err)
+	assert.NoError(t, os.WriteFile(file, content, 0600))
+
+	config := Config{FileSD: FileSDConfig{Files: []string{filepath.Join(dir, "*.yaml")}}}
+
+	r := NewRepository()
+	r.addService("system:0", Service{ServiceID: "system:0", ConnSettings: ConnSetting{ServiceType: model.ServiceTypeSystem}})
+
+	r.syncFileServices(config)
+	assert.Equal(t, 3, r.totalServices())
+	assert.Equal(t, file, r.getService("postgres:127.0.0.1:5432").sdFile)
+	assert.Equal(t, "main", r.getService("postgres:127.0.0.1:5432").ConnSettings.Labels["cluster"])
+	assert.NotNil(t, r.getService("postgres:127.0.0.1:5432").Collector)
+
+	// Invalid file, services are kept.
+	assert.NoError(t, os.WriteFile(file, []byte("invalid"), 0600))
+	r.syncFileServices(config)
+	assert.Equal(t, 3, r.totalServices())
+
+	// Service is removed from file.
+	assert.NoError(t, os.WriteFile(file, []byte("- service_type: postgres\n  conninfo: host=127.0.0.1 port=5432 user=pgscv dbname=pgscv_fixtures\n  labels: {cluster: main}\n"), 0600))
+	r.syncFileServices(config)
+	assert.Equal(t, 2, r.totalServices())
+	assert.Equal(t, "", r.getService("pgbouncer:127.0.0.1:6432").ServiceID)
+
+	// File is removed.
+	assert.NoError(t, os.Remove(file))
+	r.syncFileServices(config)
+	assert.Equal(t, 1, r.totalServices())
+	assert.Equal(t, "system:0", r.getService("system:0").ServiceID)
+
+	r.close()
+}
+
+func TestRepository_syncFileServices_unavailable(t *testing.T) {
+	dir, err := os.MkdirTemp("", "pgscv-filesd-")
+	assert.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	file := filepath.Join(dir, "services.json")
+	assert.NoError(t, os.WriteFile(file, []byte(`[
+		{"service_type": "postgres", "conninfo": "host=127.0.0.1 port=1"},
+		{"service_type": "pgbouncer", "conninfo": "host=127.0.0.1 port=6432 user=pgscv dbname=pgbouncer"}
+	]`), 0600))
+
+	// Unavailable service is not added, service defined in config file is not replaced by file discovery.
+	cs := TestPgbouncerService().ConnSettings
+	r := NewRepository()
+	r.addService("pgbouncer:127.0.0.1:6432", Service{ServiceID: "pgbouncer:6432", ConnSettings: cs, source: cs})
+
+	r.syncFileServices(Config{FileSD: FileSDConfig{Files: []string{file}}})
+	assert.Equal(t, 1, r.totalServices())
+	assert.Equal(t, "", r.getService("pgbouncer:127.0.0.1:6432").sdFile)
+
+	r.close()
+}
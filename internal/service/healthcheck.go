@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/model"
+	"github.com/weaponry/pgscv/internal/store"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHealthcheckInterval defines default interval between health checks of services.
+	defaultHealthcheckInterval = 60 * time.Second
+	// defaultHealthcheckFailureThreshold defines default number of failed health checks in a row after which the
+	// service is removed.
+	defaultHealthcheckFailureThreshold = 10
+	// defaultHealthcheckMaxBackoff defines default maximum interval between health checks of failing services.
+	defaultHealthcheckMaxBackoff = 10 * time.Minute
+	// healthcheckTimeout defines maximum duration of connecting to the service during health check.
+	healthcheckTimeout = 10 * time.Second
+	// healthcheckConcurrency defines maximum number of services checked concurrently.
+	healthcheckConcurrency = 8
+)
+
+// HealthcheckConfig defines settings of health checks of services with remote endpoints (Postgres and Pgbouncer).
+type HealthcheckConfig struct {
+	// Interval defines interval between health checks of healthy services.
+	Interval time.Duration `yaml:"interval"`
+	// FailureThreshold defines number of failed health checks in a row after which service is removed.
+	FailureThreshold int `yaml:"failure_threshold"`
+	// MaxBackoff defines maximum interval between health checks of failing services. Interval between checks of
+	// failing service is doubled after each failure.
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+	// KeepStatic defines services defined in config file are kept in the repo and reported as down when failure
+	// threshold is reached. By default, they are removed, the same as auto-discovered services. Services defined in
+	// file discovery files are never removed, they are managed by the files.
+	KeepStatic bool `yaml:"keep_static_services"`
+}
+
+// Validate checks health checks settings are valid.
+func (c HealthcheckConfig) Validate() error {
+	if c.Interval < 0 || c.FailureThreshold < 0 || c.MaxBackoff < 0 {
+		return fmt.Errorf("interval, failure_threshold and max_backoff should not be negative")
+	}
+
+	if c.MaxBackoff > 0 && c.Interval > 0 && c.MaxBackoff < c.Interval {
+		return fmt.Errorf("max_backoff should not be less than interval")
+	}
+
+	return nil
+}
+
+// withDefaults returns settings where unspecified values are replaced with defaults.
+func (c HealthcheckConfig) withDefaults() HealthcheckConfig {
+	if c.Interval == 0 {
+		c.Interval = defaultHealthcheckInterval
+	}
+	if c.FailureThreshold == 0 {
+		c.FailureThreshold = defaultHealthcheckFailureThreshold
+	}
+	if c.MaxBackoff == 0 {
+		c.MaxBackoff = defaultHealthcheckMaxBackoff
+	}
+	if c.MaxBackoff < c.Interval {
+		c.MaxBackoff = c.Interval
+	}
+
+	return c
+}
+
+// backoffChecks returns number of health checks skipped after specified number of failures in a row. Interval between
+// checks is doubled after each failure until it reaches maximum backoff.
+func (c HealthcheckConfig) backoffChecks(failures int) int {
+	intervals := 1
+	for i := 1; i < failures && time.Duration(intervals*2)*c.Interval <= c.MaxBackoff; i++ {
+		intervals *= 2
+	}
+
+	return intervals - 1
+}
+
+// startHealthchecks periodically performs health checks of services.
+func (repo *Repository) startHealthchecks(ctx context.Context) {
+	log.Debug("starting services health checks loop")
+
+	for {
+		// Interval is taken from current configuration, it might be changed at configuration reload.
+		interval := repo.getConfig().Healthcheck.withDefaults().Interval
+
+		select {
+		case <-time.After(interval):
+			repo.healthcheckServices(ctx)
+		case <-ctx.Done():
+			log.Info("services health checks: exit signaled")
+			return
+		}
+	}
+}
+
+// healthcheckServices performs services health checks and remove those who don't respond too long. Failing services
+// are checked with exponential backoff.
+func (repo *Repository) healthcheckServices(ctx context.Context) {
+	log.Debug("services healthcheck started")
+
+	// Connecting to unavailable services might take long, hence services are checked concurrently and without blocking
+	// other updates of the repo. Results are applied at once after all checks.
+	results := map[string]error{}
+	conninfos := map[string]string{}
+	for _, id := range repo.getServiceIDs() {
+		service := repo.getService(id)
+
+		switch service.ConnSettings.ServiceType {
+		case model.ServiceTypePostgresql, model.ServiceTypePgbouncer:
+			if repo.skipHealthcheck(id) {
+				log.Debugf("service [%s] health check postponed", id)
+				continue
+			}
+
+			conninfos[id] = service.ConnSettings.Conninfo
+		default:
+			continue
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, healthcheckConcurrency)
+	for id, conninfo := range conninfos {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(id, conninfo string) {
+			defer func() { <-sem; wg.Done() }()
+
+			err := attemptConnectContext(ctx, conninfo, healthcheckTimeout)
+
+			mu.Lock()
+			results[id] = err
+			mu.Unlock()
+		}(id, conninfo)
+	}
+
+	wg.Wait()
+
+	// Health checks are interrupted at exit, don't count them as failures.
+	if ctx.Err() != nil {
+		return
+	}
+
+	repo.updateMu.Lock()
+	defer repo.updateMu.Unlock()
+
+	config := repo.getConfig()
+	settings := config.Healthcheck.withDefaults()
+
+	var setup bool
+
+	for id, err := range results {
+		service := repo.getService(id)
+
+		// Service has been removed or re-created with other settings during check, e.g. by configuration reload.
+		if service.ServiceID == "" || service.ConnSettings.Conninfo != conninfos[id] {
+			continue
+		}
+
+		// Password might have been changed, re-read it, connection with new password is checked at next check.
+		if store.IsAuthError(err) && repo.refreshCredentials(id) {
+			setup = true
+			continue
+		}
+
+		if err == nil {
+			if service.TotalErrors > 0 {
+				log.Infof("service [%s] recovered after %d failures", id, service.TotalErrors)
+			}
+			repo.markServiceHealthy(id)
+
+			// Collector of the service might not have been created when the service was not available.
+			if service.Collector == nil {
+				setup = true
+			}
+			continue
+		}
+
+		totalErrors := service.TotalErrors + 1
+		switch {
+		case totalErrors < settings.FailureThreshold:
+			log.Warnf("service [%s] failed: %s; tries remain %d/%d", id, err, totalErrors, settings.FailureThreshold)
+		case service.sdFile != "" || (service.static && settings.KeepStatic):
+			log.Errorf("service [%s] failed: %s; too many failures %d/%d, keep statically configured service", id, err, totalErrors, settings.FailureThreshold)
+		default:
+			repo.removeService(id)
+			log.Errorf("service [%s] removed: too many failures %d/%d", id, totalErrors, settings.FailureThreshold)
+			continue
+		}
+
+		repo.markServiceFailed(id)
+		repo.postponeHealthcheck(id, settings.backoffChecks(totalErrors))
+	}
+
+	// Collectors of services with re-read password have been removed, and collectors of recovered services might be
+	// missing, create them.
+	if setup {
+		if err := repo.setupServices(config); err != nil {
+			log.Warnf("services setup failed: %s", err)
+		}
+	}
+
+	log.Debug("services healthcheck finished")
+}
+
+// postponeHealthcheck sets number of health checks of the service which should be skipped.
+func (repo *Repository) postponeHealthcheck(id string, checks int) {
+	repo.Lock()
+	if s, ok := repo.Services[id]; ok {
+		s.skipChecks = checks
+		repo.Services[id] = s
+	}
+	repo.Unlock()
+}
+
+// skipHealthcheck returns true if health check of the service should be skipped, and decrements number of checks
+// which should be skipped.
+func (repo *Repository) skipHealthcheck(id string) bool {
+	repo.Lock()
+	defer repo.Unlock()
+
+	s, ok := repo.Services[id]
+	if !ok || s.skipChecks == 0 {
+		return false
+	}
+
+	s.skipChecks--
+	repo.Services[id] = s
+	return true
+}
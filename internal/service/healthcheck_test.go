@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/model"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestHealthcheckConfig_Validate(t *testing.T) {
+	assert.NoError(t, HealthcheckConfig{}.Validate())
+	assert.NoError(t, HealthcheckConfig{Interval: time.Minute, FailureThreshold: 3, MaxBackoff: 5 * time.Minute}.Validate())
+	assert.Error(t, HealthcheckConfig{Interval: -time.Minute}.Validate())
+	assert.Error(t, HealthcheckConfig{FailureThreshold: -1}.Validate())
+	assert.Error(t, HealthcheckConfig{MaxBackoff: -time.Minute}.Validate())
+	assert.Error(t, HealthcheckConfig{Interval: time.Minute, MaxBackoff: time.Second}.Validate())
+}
+
+func TestHealthcheckConfig_withDefaults(t *testing.T) {
+	assert.Equal(t,
+		HealthcheckConfig{Interval: defaultHealthcheckInterval, FailureThreshold: defaultHealthcheckFailureThreshold, MaxBackoff: defaultHealthcheckMaxBackoff},
+		HealthcheckConfig{}.withDefaults(),
+	)
+
+	// Max backoff is not less than interval.
+	assert.Equal(t,
+		HealthcheckConfig{Interval: time.Hour, FailureThreshold: 3, MaxBackoff: time.Hour, KeepStatic: true},
+		HealthcheckConfig{Interval: time.Hour, FailureThreshold: 3, KeepStatic: true}.withDefaults(),
+	)
+}
+
+func TestHealthcheckConfig_backoffChecks(t *testing.T) {
+	c := HealthcheckConfig{Interval: time.Minute, MaxBackoff: 5 * time.Minute}
+
+	var got []int
+	for failures := 1; failures <= 5; failures++ {
+		got = append(got, c.backoffChecks(failures))
+	}
+
+	// Intervals between checks are 1m, 2m, 4m, and then limited by max backoff.
+	assert.Equal(t, []int{0, 1, 3, 3, 3}, got)
+}
+
+func TestRepository_healthcheckServices_backoff(t *testing.T) {
+	r := NewRepository()
+	r.setConfig(Config{Healthcheck: HealthcheckConfig{Interval: time.Minute, FailureThreshold: 3, MaxBackoff: 10 * time.Minute}})
+
+	cs := ConnSetting{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1 port=1 user=pgscv dbname=pgscv_fixtures"}
+	r.addService("postgres:1", Service{ServiceID: "postgres:1", ConnSettings: cs, source: cs})
+
+	var errors []int
+	for i := 0; i < 3; i++ {
+		r.healthcheckServices(context.Background())
+		errors = append(errors, r.getService("postgres:1").TotalErrors)
+	}
+
+	// The second failure postpones the next check.
+	assert.Equal(t, []int{1, 2, 2}, errors)
+	assert.Equal(t, 2, r.getService("postgres:1").HealthcheckFailures)
+
+	// Threshold is reached, service is removed.
+	r.healthcheckServices(context.Background())
+	assert.Equal(t, 0, r.totalServices())
+}
+
+func TestRepository_healthcheckServices_static(t *testing.T) {
+	cs := ConnSetting{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1 port=1 user=pgscv dbname=pgscv_fixtures"}
+
+	// Default settings: services defined in config file are removed, services from files survive the threshold.
+	r := NewRepository()
+	r.setConfig(Config{Healthcheck: HealthcheckConfig{Interval: time.Minute, FailureThreshold: 2, MaxBackoff: time.Minute}})
+	r.addService("postgres:1", Service{ServiceID: "postgres:1", ConnSettings: cs, source: cs, static: true})
+	r.addService("postgres:2", Service{ServiceID: "postgres:2", ConnSettings: cs, source: cs, static: true, sdFile: "/tmp/services.yaml"})
+
+	for i := 0; i < 3; i++ {
+		r.healthcheckServices(context.Background())
+	}
+
+	assert.Equal(t, []string{"postgres:2"}, r.getServiceIDs())
+	assert.Equal(t, 3, r.getService("postgres:2").TotalErrors)
+	assert.Equal(t, 3, r.getService("postgres:2").HealthcheckFailures)
+
+	// Services defined in config file are kept when it is enabled, auto-discovered service is removed anyway.
+	r = NewRepository()
+	r.setConfig(Config{Healthcheck: HealthcheckConfig{Interval: time.Minute, FailureThreshold: 2, MaxBackoff: time.Minute, KeepStatic: true}})
+	r.addService("postgres:1", Service{ServiceID: "postgres:1", ConnSettings: cs, source: cs, static: true})
+	r.addService("postgres:2", Service{ServiceID: "postgres:2", ConnSettings: cs, source: cs, static: true, sdFile: "/tmp/services.yaml"})
+	r.addService("postgres:3", Service{ServiceID: "postgres:3", ConnSettings: cs, source: cs})
+
+	for i := 0; i < 3; i++ {
+		r.healthcheckServices(context.Background())
+	}
+
+	ids := r.getServiceIDs()
+	sort.Strings(ids)
+	assert.Equal(t, []string{"postgres:1", "postgres:2"}, ids)
+	assert.Equal(t, 3, r.getService("postgres:1").TotalErrors)
+}
+
+func TestRepository_healthcheckServices_concurrent(t *testing.T) {
+	cs := ConnSetting{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1 port=1 user=pgscv dbname=pgscv_fixtures"}
+
+	// Number of services exceeds number of concurrent checks, all services are checked.
+	r := NewRepository()
+	for i := 0; i < healthcheckConcurrency*2+1; i++ {
+		id := fmt.Sprintf("postgres:%d", i)
+		r.addService(id, Service{ServiceID: id, ConnSettings: cs, source: cs})
+	}
+
+	r.healthcheckServices(context.Background())
+	for _, id := range r.getServiceIDs() {
+		assert.Equal(t, 1, r.getService(id).TotalErrors)
+	}
+}
+
+func TestRepository_healthcheckServices_canceled(t *testing.T) {
+	cs := ConnSetting{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1 port=1 user=pgscv dbname=pgscv_fixtures"}
+
+	r := NewRepository()
+	r.addService("postgres:1", Service{ServiceID: "postgres:1", ConnSettings: cs, source: cs})
+
+	// Checks interrupted at exit are not counted as failures.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.healthcheckServices(ctx)
+	assert.Equal(t, 0, r.getService("postgres:1").TotalErrors)
+}
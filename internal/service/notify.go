@@ -0,0 +1,77 @@
+package service
+
+import (
+	"context"
+	"github.com/weaponry/pgscv/internal/log"
+)
+
+// notificationsBuffer defines number of notifications which could be pending. Notifications over the buffer are
+// dropped, they are sent again at next scrape.
+const notificationsBuffer = 16
+
+// Kinds of notifications sent by collectors of services.
+const (
+	notifyAuthFailure  = iota // collectors failed to authenticate, password of the service should be re-read
+	notifyLabelsChange        // labels of the service have been changed, collector of the service should be re-created
+)
+
+// notification is sent by collector of the service during scrape. Handling of notification changes services and
+// connects to them, hence it is made in background and doesn't block scrapes.
+type notification struct {
+	id   string // ID of the service
+	kind int    // kind of the notification
+}
+
+// notify sends notification about the service without blocking, notification is dropped when too many notifications
+// are pending.
+func (repo *Repository) notify(id string, kind int) {
+	select {
+	case repo.notifyCh <- notification{id: id, kind: kind}:
+	default:
+		log.Debugf("service [%s] too many pending notifications, drop notification", id)
+	}
+}
+
+// startNotificationsHandling handles notifications sent by collectors of services until context is done.
+func (repo *Repository) startNotificationsHandling(ctx context.Context) {
+	log.Debug("starting services notifications handling loop")
+
+	for {
+		select {
+		case n := <-repo.notifyCh:
+			repo.handleNotification(n)
+		case <-ctx.Done():
+			log.Info("services notifications handling: exit signaled")
+			return
+		}
+	}
+}
+
+// handleNotification updates the service according to the notification and re-creates its collector if necessary.
+func (repo *Repository) handleNotification(n notification) {
+	repo.updateMu.Lock()
+	defer repo.updateMu.Unlock()
+
+	switch n.kind {
+	case notifyAuthFailure:
+		if !repo.refreshCredentials(n.id) {
+			return
+		}
+	case notifyLabelsChange:
+		s := repo.getService(n.id)
+		if s.Collector == nil {
+			return
+		}
+
+		s.Collector.Close()
+		s.Collector = nil
+		repo.addService(n.id, s)
+		log.Infof("service [%s] labels have been changed, re-creating collectors", n.id)
+	default:
+		return
+	}
+
+	if err := repo.setupServices(repo.getConfig()); err != nil {
+		log.Warnf("service [%s] setup failed: %s", n.id, err)
+	}
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/model"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRepository_notify(t *testing.T) {
+	r := NewRepository()
+
+	// Notifications over the buffer are dropped, sending is not blocked.
+	for i := 0; i < notificationsBuffer+5; i++ {
+		r.newAuthFailureHandler("postgres:5432")()
+	}
+	assert.Len(t, r.notifyCh, notificationsBuffer)
+	assert.Equal(t, notification{id: "postgres:5432", kind: notifyAuthFailure}, <-r.notifyCh)
+}
+
+func TestRepository_handleNotification_authFailure(t *testing.T) {
+	dir, err := os.MkdirTemp("", "pgscv-notify-")
+	assert.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	passwordFile := filepath.Join(dir, "password")
+	assert.NoError(t, os.WriteFile(passwordFile, []byte("old"), 0600))
+
+	source := ConnSetting{ServiceType: model.ServiceTypePgbouncer, Conninfo: "host=127.0.0.1 port=6432 user=pgscv dbname=pgbouncer", PasswordFile: passwordFile}
+	cs, err := source.ResolvePassword()
+	assert.NoError(t, err)
+
+	r := NewRepository()
+	r.addService("pgbouncer:6432", Service{ServiceID: "pgbouncer:6432", ConnSettings: cs, source: source})
+	assert.NoError(t, r.setupServices(Config{}))
+
+	old := r.getService("pgbouncer:6432").Collector
+	assert.NotNil(t, old)
+
+	// Password is not changed, collector is kept.
+	r.handleNotification(notification{id: "pgbouncer:6432", kind: notifyAuthFailure})
+	assert.True(t, old == r.getService("pgbouncer:6432").Collector)
+
+	// Password is changed, collector is re-created with new password.
+	assert.NoError(t, os.WriteFile(passwordFile, []byte("new"), 0600))
+	r.handleNotification(notification{id: "pgbouncer:6432", kind: notifyAuthFailure})
+
+	s := r.getService("pgbouncer:6432")
+	assert.NotNil(t, s.Collector)
+	assert.True(t, old != s.Collector)
+
+	pgconfig, err := pgx.ParseConfig(s.ConnSettings.Conninfo)
+	assert.NoError(t, err)
+	assert.Equal(t, "new", pgconfig.Password)
+}
+
+func TestRepository_startNotificationsHandling(t *testing.T) {
+	r := NewRepository()
+	ctx, cancel := context.WithCancel(context.Background())
+
+	done := make(chan struct{})
+	go func() {
+		r.startNotificationsHandling(ctx)
+		close(done)
+	}()
+
+	// Notifications about unknown services are ignored.
+	r.notify("postgres:5432", notifyAuthFailure)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,146 @@
+package service
+
+import (
+	"fmt"
+	"github.com/weaponry/pgscv/internal/collector"
+	"github.com/weaponry/pgscv/internal/filter"
+	"github.com/weaponry/pgscv/internal/patroni"
+	"regexp"
+	"strings"
+)
+
+// labelNameRE matches valid names of Prometheus labels.
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Overrides defines service-specific settings which override global settings.
+type Overrides struct {
+	// DisableCollectors defines collectors disabled for the service, it is used instead of globally disabled collectors.
+	DisableCollectors []string `yaml:"disable_collectors" json:"disable_collectors"`
+	// Filters defines filters of the service, they replace global filters with the same names.
+	Filters filter.Filters `yaml:"filters" json:"filters"`
+	// Labels defines extra constant labels attached to all metrics of the service.
+	Labels map[string]string `yaml:"labels" json:"labels"`
+	// PatroniURL defines URL of Patroni REST API of the member which manages Postgres service. Patroni member's
+	// cluster, name and role are attached to metrics of the service as labels.
+	PatroniURL string `yaml:"patroni_url" json:"patroni_url"`
+}
+
+// Validate checks overrides contain known collectors, valid labels and Patroni URL, and compiles filters.
+func (o Overrides) Validate() error {
+	for _, name := range o.DisableCollectors {
+		if name != "system" && name != "postgres" && name != "pgbouncer" && !collector.IsKnown(name) {
+			return fmt.Errorf("unknown collector '%s'", name)
+		}
+	}
+
+	for name := range o.Labels {
+		if !labelNameRE.MatchString(name) {
+			return fmt.Errorf("invalid label name '%s'", name)
+		}
+
+		// Labels "collector" and "metric" are used by self-instrumentation metrics attached to each service.
+		if name == "instance" || name == "service_id" || name == "collector" || name == "metric" || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("label '%s' is reserved", name)
+		}
+	}
+
+	if o.PatroniURL != "" {
+		if err := patroni.ValidateURL(o.PatroniURL); err != nil {
+			return err
+		}
+	}
+
+	return o.Filters.Compile()
+}
+
+// DisabledCollectors returns collectors disabled for the service.
+func (o Overrides) DisabledCollectors(global []string) []string {
+	if o.DisableCollectors != nil {
+		return o.DisableCollectors
+	}
+
+	return global
+}
+
+// MergeFilters returns global filters merged with filters of the service.
+func (o Overrides) MergeFilters(global filter.Filters) filter.Filters {
+	if len(o.Filters) == 0 {
+		return global
+	}
+
+	filters := filter.New()
+	for name, f := range global {
+		filters[name] = f
+	}
+	for name, f := range o.Filters {
+		filters[name] = f
+	}
+
+	return filters
+}
+
+// equal returns true if overrides have the same settings.
+func (o Overrides) equal(other Overrides) bool {
+	if (o.DisableCollectors == nil) != (other.DisableCollectors == nil) || !stringsEqual(o.DisableCollectors, other.DisableCollectors) {
+		return false
+	}
+
+	if !filtersEqual(o.Filters, other.Filters) || o.PatroniURL != other.PatroniURL || len(o.Labels) != len(other.Labels) {
+		return false
+	}
+
+	for name, value := range o.Labels {
+		if v, ok := other.Labels[name]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DiscoveryRule defines overrides applied to auto-discovered services which match the rule. Service should match all
+// criteria specified in the rule.
+type DiscoveryRule struct {
+	// ServiceType matches services of the type, empty value matches services of any type.
+	ServiceType string `yaml:"service_type"`
+	// Port matches services listening on the port, zero matches any port.
+	Port int `yaml:"port"`
+	// DataDirectory matches Postgres services with the data directory, empty value matches any data directory.
+	DataDirectory string `yaml:"data_directory"`
+	// Overrides defines settings applied to matched services.
+	Overrides `yaml:",inline"`
+}
+
+// match returns true if the service matches the rule.
+func (r DiscoveryRule) match(serviceType string, port int, dataDirectory string) bool {
+	return (r.ServiceType == "" || r.ServiceType == serviceType) &&
+		(r.Port == 0 || r.Port == port) &&
+		(r.DataDirectory == "" || r.DataDirectory == dataDirectory)
+}
+
+// discoveryOverrides returns overrides of the first rule matching the service, empty overrides if no rules match.
+func discoveryOverrides(rules []DiscoveryRule, serviceType string, port int, dataDirectory string) Overrides {
+	for _, r := range rules {
+		if r.match(serviceType, port, dataDirectory) {
+			return r.Overrides
+		}
+	}
+
+	return Overrides{}
+}
+
+// discoveryRulesEqual returns true if rules have the same settings in the same order.
+func discoveryRulesEqual(a, b []DiscoveryRule) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].ServiceType != b[i].ServiceType || a[i].Port != b[i].Port || a[i].DataDirectory != b[i].DataDirectory ||
+			!a[i].Overrides.equal(b[i].Overrides) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/collector"
+	"github.com/weaponry/pgscv/internal/filter"
+	"github.com/weaponry/pgscv/internal/model"
+	"testing"
+)
+
+func TestOverrides_Validate(t *testing.T) {
+	testcases := []struct {
+		valid bool
+		in    Overrides
+	}{
+		{valid: true, in: Overrides{}},
+		{valid: true, in: Overrides{
+			DisableCollectors: []string{"postgres/logs", "system"},
+			Filters:           filter.Filters{"netdev/device": {Exclude: "docker"}},
+			Labels:            map[string]string{"cluster": "main", "env": "prod"},
+			PatroniURL:        "http://127.0.0.1:8008",
+		}},
+		{valid: false, in: Overrides{DisableCollectors: []string{"postgres/unknown"}}},
+		{valid: false, in: Overrides{Filters: filter.Filters{"netdev/device": {Exclude: "["}}}},
+		{valid: false, in: Overrides{Labels: map[string]string{"invalid-name": "value"}}},
+		{valid: false, in: Overrides{Labels: map[string]string{"service_id": "value"}}},
+		{valid: false, in: Overrides{Labels: map[string]string{"collector": "value"}}},
+		{valid: false, in: Overrides{Labels: map[string]string{"__name__": "value"}}},
+		{valid: false, in: Overrides{PatroniURL: "127.0.0.1:8008"}},
+	}
+
+	for _, tc := range testcases {
+		if tc.valid {
+			assert.NoError(t, tc.in.Validate())
+		} else {
+			assert.Error(t, tc.in.Validate())
+		}
+	}
+}
+
+func TestOverrides_DisabledCollectors(t *testing.T) {
+	global := []string{"postgres/logs"}
+	assert.Equal(t, global, Overrides{}.DisabledCollectors(global))
+	assert.Equal(t, []string{"postgres/tables"}, Overrides{DisableCollectors: []string{"postgres/tables"}}.DisabledCollectors(global))
+
+	// Empty list enables all collectors.
+	assert.Equal(t, []string{}, Overrides{DisableCollectors: []string{}}.DisabledCollectors(global))
+}
+
+func TestOverrides_MergeFilters(t *testing.T) {
+	global := filter.Filters{"netdev/device": {Exclude: "docker"}, "diskstats/device": {Exclude: "loop"}}
+	assert.Equal(t, global, Overrides{}.MergeFilters(global))
+
+	got := Overrides{Filters: filter.Filters{"netdev/device": {Exclude: "veth"}}}.MergeFilters(global)
+	assert.Equal(t, filter.Filters{"netdev/device": {Exclude: "veth"}, "diskstats/device": {Exclude: "loop"}}, got)
+
+	// Global filters are not changed.
+	assert.Equal(t, "docker", global["netdev/device"].Exclude)
+}
+
+func TestOverrides_equal(t *testing.T) {
+	o := Overrides{
+		DisableCollectors: []string{"postgres/logs"},
+		Filters:           filter.Filters{"netdev/device": {Exclude: "docker"}},
+		Labels:            map[string]string{"cluster": "main"},
+	}
+
+	assert.True(t, o.equal(Overrides{
+		DisableCollectors: []string{"postgres/logs"},
+		Filters:           filter.Filters{"netdev/device": {Exclude: "docker"}},
+		Labels:            map[string]string{"cluster": "main"},
+	}))
+	assert.False(t, o.equal(Overrides{Filters: o.Filters, Labels: o.Labels}))
+	assert.False(t, o.equal(Overrides{DisableCollectors: o.DisableCollectors, Labels: o.Labels}))
+	assert.False(t, o.equal(Overrides{DisableCollectors: o.DisableCollectors, Filters: o.Filters, Labels: map[string]string{"cluster": "other"}}))
+	assert.False(t, Overrides{}.equal(Overrides{DisableCollectors: []string{}}))
+	assert.False(t, Overrides{}.equal(Overrides{PatroniURL: "http://127.0.0.1:8008"}))
+}
+
+func Test_discoveryOverrides(t *testing.T) {
+	rules := []DiscoveryRule{
+		{ServiceType: model.ServiceTypePostgresql, DataDirectory: "/data/main", Overrides: Overrides{Labels: map[string]string{"cluster": "main"}}},
+		{Port: 5433, Overrides: Overrides{Labels: map[string]string{"cluster": "other"}}},
+	}
+
+	assert.Equal(t, "main", discoveryOverrides(rules, model.ServiceTypePostgresql, 5432, "/data/main").Labels["cluster"])
+	assert.Equal(t, "main", discoveryOverrides(rules, model.ServiceTypePostgresql, 5433, "/data/main").Labels["cluster"])
+	assert.Equal(t, "other", discoveryOverrides(rules, model.ServiceTypePgbouncer, 5433, "").Labels["cluster"])
+	assert.Equal(t, Overrides{}, discoveryOverrides(rules, model.ServiceTypePgbouncer, 6432, ""))
+	assert.Equal(t, Overrides{}, discoveryOverrides(nil, model.ServiceTypePostgresql, 5432, "/data/main"))
+}
+
+func Test_discoveryRulesEqual(t *testing.T) {
+	a := []DiscoveryRule{{Port: 5432, Overrides: Overrides{Labels: map[string]string{"cluster": "main"}}}}
+	assert.True(t, discoveryRulesEqual(a, []DiscoveryRule{{Port: 5432, Overrides: Overrides{Labels: map[string]string{"cluster": "main"}}}}))
+	assert.False(t, discoveryRulesEqual(a, []DiscoveryRule{{Port: 5433, Overrides: Overrides{Labels: map[string]string{"cluster": "main"}}}}))
+	assert.False(t, discoveryRulesEqual(a, []DiscoveryRule{{Port: 5432}}))
+	assert.False(t, discoveryRulesEqual(a, nil))
+}
+
+func TestRepository_setupServices_overrides(t *testing.T) {
+	cs := TestPgbouncerService().ConnSettings
+	cs.Overrides = Overrides{
+		DisableCollectors: []string{"pgbouncer/settings"},
+		Filters:           filter.Filters{"netdev/device": {Exclude: "veth"}},
+		Labels:            map[string]string{"cluster": "main"},
+	}
+
+	r := NewRepository()
+	r.addService("pgbouncer:6432", Service{ServiceID: "pgbouncer:6432", ConnSettings: cs, source: cs})
+
+	config := Config{
+		DisabledCollectors: []string{"pgbouncer/stats"},
+		Filters:            filter.Filters{"netdev/device": {Exclude: "docker"}, "diskstats/device": {Exclude: "loop"}},
+	}
+	assert.NoError(t, r.setupServices(config))
+
+	mc, ok := r.getService("pgbouncer:6432").Collector.(*collector.PgscvCollector)
+	assert.True(t, ok)
+	assert.Contains(t, mc.Collectors, "pgbouncer/stats")
+	assert.NotContains(t, mc.Collectors, "pgbouncer/settings")
+	assert.Equal(t, "veth", mc.Config.Filters["netdev/device"].Exclude)
+	assert.Equal(t, "loop", mc.Config.Filters["diskstats/device"].Exclude)
+	assert.Equal(t, map[string]string{"cluster": "main"}, mc.Config.ConstLabels)
+}
@@ -0,0 +1,41 @@
+package service
+
+import (
+	"context"
+	"github.com/weaponry/pgscv/internal/collector"
+	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/patroni"
+)
+
+// setupPatroni reads labels of Patroni member which manages the service and adds them to the collector's config.
+// Labels defined by user have priority over Patroni labels. When Patroni is not available, the service is set up
+// without Patroni labels, and the collector is re-created when Patroni becomes available.
+func (repo *Repository) setupPatroni(id string, patroniURL string, config *collector.Config) {
+	labels, err := patroni.NewClient(patroniURL).Labels(context.Background())
+	if err != nil {
+		log.Warnf("service [%s] read Patroni member labels failed: %s; skip labels", id, err)
+	}
+
+	merged := map[string]string{}
+	for name, value := range labels {
+		if value != "" {
+			merged[name] = value
+		}
+	}
+	for name, value := range config.ConstLabels {
+		merged[name] = value
+	}
+
+	config.PatroniURL = patroniURL
+	config.PatroniLabels = labels
+	config.ConstLabels = merged
+	config.OnLabelsChange = repo.newLabelsChangeHandler(id)
+}
+
+// newLabelsChangeHandler returns function which notifies the repo that labels of the service have been changed. The
+// collector of the service is re-created in background.
+func (repo *Repository) newLabelsChangeHandler(id string) func() {
+	return func() {
+		repo.notify(id, notifyLabelsChange)
+	}
+}
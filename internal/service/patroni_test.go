@@ -0,0 +1,58 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/collector"
+	"github.com/weaponry/pgscv/internal/patroni"
+	"testing"
+)
+
+func TestRepository_setupPatroni(t *testing.T) {
+	srv := patroni.NewTestServer(patroni.TestLeaderStatus, patroni.TestCluster)
+	defer srv.Close()
+
+	r := NewRepository()
+
+	// User-defined labels have priority.
+	config := collector.Config{ConstLabels: map[string]string{"cluster": "main"}}
+	r.setupPatroni("postgres:5432", srv.URL, &config)
+	assert.Equal(t, srv.URL, config.PatroniURL)
+	assert.Equal(t, map[string]string{"cluster": "demo", "member": "node1", "role": "leader"}, config.PatroniLabels)
+	assert.Equal(t, map[string]string{"cluster": "main", "member": "node1", "role": "leader"}, config.ConstLabels)
+	assert.NotNil(t, config.OnLabelsChange)
+
+	// Patroni is not available, labels are not added.
+	config = collector.Config{}
+	r.setupPatroni("postgres:5432", "http://127.0.0.1:1", &config)
+	assert.Nil(t, config.PatroniLabels)
+	assert.Equal(t, map[string]string{}, config.ConstLabels)
+	assert.NotNil(t, config.OnLabelsChange)
+}
+
+func TestRepository_newLabelsChangeHandler(t *testing.T) {
+	r := NewRepository()
+
+	// Handler doesn't change the service, it only sends notification.
+	r.newLabelsChangeHandler("pgbouncer:6432")()
+	assert.Equal(t, notification{id: "pgbouncer:6432", kind: notifyLabelsChange}, <-r.notifyCh)
+}
+
+func TestRepository_handleNotification_labelsChange(t *testing.T) {
+	cs := TestPgbouncerService().ConnSettings
+
+	r := NewRepository()
+	r.addService("pgbouncer:6432", Service{ServiceID: "pgbouncer:6432", ConnSettings: cs, source: cs})
+	assert.NoError(t, r.setupServices(Config{}))
+
+	old := r.getService("pgbouncer:6432").Collector
+	assert.NotNil(t, old)
+
+	r.handleNotification(notification{id: "pgbouncer:6432", kind: notifyLabelsChange})
+	assert.NotNil(t, r.getService("pgbouncer:6432").Collector)
+	assert.True(t, old != r.getService("pgbouncer:6432").Collector)
+
+	// Removed service is not added again.
+	r.removeService("pgbouncer:6432")
+	r.handleNotification(notification{id: "pgbouncer:6432", kind: notifyLabelsChange})
+	assert.Equal(t, 0, r.totalServices())
+}
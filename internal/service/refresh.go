@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"github.com/weaponry/pgscv/internal/collector"
+	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/model"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultRefreshInterval defines default interval between re-reading properties of services.
+	defaultRefreshInterval = time.Minute
+	// refreshTimeout defines maximum duration of reading properties of the service.
+	refreshTimeout = 10 * time.Second
+)
+
+// startServicesRefresh periodically re-reads properties of Postgres services and re-creates collectors of services
+// which properties have been changed, e.g. after promotion of standby, upgrade or changing shared_preload_libraries.
+func (repo *Repository) startServicesRefresh(ctx context.Context) {
+	log.Debug("starting services refresh loop")
+
+	for {
+		// Interval is taken from current configuration, it might be changed at configuration reload.
+		interval := repo.getConfig().RefreshInterval
+		if interval <= 0 {
+			interval = defaultRefreshInterval
+		}
+
+		select {
+		case <-time.After(interval):
+			repo.refreshServices(ctx)
+		case <-ctx.Done():
+			log.Info("services refresh: exit signaled")
+			return
+		}
+	}
+}
+
+// refreshServices re-reads properties of Postgres services and re-creates collectors of services which properties
+// differ from properties the collectors have been created with.
+func (repo *Repository) refreshServices(ctx context.Context) {
+	log.Debug("services refresh started")
+
+	// Reading properties of unavailable services might take long, hence properties are read without blocking other
+	// updates of the repo. Collectors are re-created at once after all services have been read.
+	configs := map[string]collector.PostgresServiceConfig{}
+	collectors := map[string]Collector{}
+	for _, id := range repo.getServiceIDs() {
+		s := repo.getService(id)
+		if s.ConnSettings.ServiceType != model.ServiceTypePostgresql {
+			continue
+		}
+
+		if _, ok := s.Collector.(*collector.PgscvCollector); !ok {
+			continue
+		}
+
+		readCtx, cancel := context.WithTimeout(ctx, refreshTimeout)
+		cfg, err := collector.NewPostgresServiceConfigContext(readCtx, s.ConnSettings.Conninfo)
+		cancel()
+		if err != nil {
+			// Unavailable services are handled by health checks.
+			log.Debugf("service [%s] read properties failed: %s; skip", id, err)
+			continue
+		}
+
+		configs[id], collectors[id] = cfg, s.Collector
+	}
+
+	// Refresh is interrupted at exit.
+	if ctx.Err() != nil {
+		return
+	}
+
+	repo.updateMu.Lock()
+	defer repo.updateMu.Unlock()
+
+	var changed bool
+	for id, cfg := range configs {
+		s := repo.getService(id)
+
+		// Collector has been re-created or the service has been removed during reading, e.g. by configuration reload.
+		if s.Collector != collectors[id] {
+			continue
+		}
+
+		mc := s.Collector.(*collector.PgscvCollector)
+		changes := mc.Config.PostgresServiceConfig.Changes(cfg)
+		if len(changes) == 0 {
+			continue
+		}
+
+		log.Infof("service [%s] properties have been changed (%s), re-creating collectors", id, strings.Join(changes, ", "))
+
+		s.Collector.Close()
+		s.Collector = nil
+		s.ConfigChanges++
+		repo.addService(id, s)
+		changed = true
+	}
+
+	if changed {
+		if err := repo.setupServices(repo.getConfig()); err != nil {
+			log.Warnf("services setup failed: %s", err)
+		}
+	}
+
+	log.Debug("services refresh finished")
+}
@@ -0,0 +1,53 @@
+package service
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/collector"
+	"github.com/weaponry/pgscv/internal/model"
+	"testing"
+)
+
+func TestRepository_refreshServices(t *testing.T) {
+	r := NewRepository()
+	r.addService("postgres:5432", TestPostgresService())
+	assert.NoError(t, r.setupServices(Config{}))
+
+	mc, ok := r.getService("postgres:5432").Collector.(*collector.PgscvCollector)
+	assert.True(t, ok)
+
+	// Properties are not changed, collector is kept.
+	r.refreshServices(context.Background())
+	assert.True(t, mc == r.getService("postgres:5432").Collector)
+	assert.Equal(t, 0, r.getService("postgres:5432").ConfigChanges)
+
+	// Emulate promotion of standby, collector is re-created.
+	mc.Config.InRecovery = !mc.Config.InRecovery
+	r.refreshServices(context.Background())
+
+	s := r.getService("postgres:5432")
+	assert.Equal(t, 1, s.ConfigChanges)
+	assert.NotNil(t, s.Collector)
+	assert.True(t, mc != s.Collector)
+	assert.Equal(t, 1, s.Collector.(*collector.PgscvCollector).Config.ConfigChanges)
+}
+
+func TestRepository_refreshServices_unavailable(t *testing.T) {
+	cs := ConnSetting{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1 port=1 user=pgscv dbname=pgscv_fixtures"}
+	mc, err := collector.NewPgscvCollector("postgres:1", collector.Factories{}, collector.Config{ServiceType: cs.ServiceType})
+	assert.NoError(t, err)
+
+	r := NewRepository()
+	r.addService("postgres:1", Service{ServiceID: "postgres:1", ConnSettings: cs, source: cs, Collector: mc})
+
+	// Properties of unavailable service can't be read, collector is kept.
+	r.refreshServices(context.Background())
+	assert.True(t, mc == r.getService("postgres:1").Collector)
+	assert.Equal(t, 0, r.getService("postgres:1").ConfigChanges)
+
+	// Refresh interrupted at exit doesn't change anything.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r.refreshServices(ctx)
+	assert.True(t, mc == r.getService("postgres:1").Collector)
+}
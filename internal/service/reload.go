@@ -0,0 +1,187 @@
+package service
+
+import (
+	"github.com/jackc/pgx/v4"
+	"github.com/weaponry/pgscv/internal/collector"
+	"github.com/weaponry/pgscv/internal/filter"
+	"github.com/weaponry/pgscv/internal/log"
+	"github.com/weaponry/pgscv/internal/model"
+	"github.com/weaponry/pgscv/internal/relabel"
+	"reflect"
+	"sort"
+)
+
+// reload applies new configuration to the repo: adds and removes services, and rebuilds collectors of services which
+// set of collectors or collectors settings have been changed. Unchanged services are left untouched.
+func (repo *Repository) reload(config Config) error {
+	log.Debug("reload: apply new services configuration")
+
+	repo.updateMu.Lock()
+	defer repo.updateMu.Unlock()
+
+	old := repo.getConfig()
+	repo.setConfig(config)
+
+	switch {
+	case (old.ConnSettings == nil) != (config.ConnSettings == nil):
+		// Auto-discovery is started (or not) once at startup.
+		log.Warnln("reload: switching between auto-discovery and services defined in config file requires restart; services are not changed")
+	case config.ConnSettings != nil:
+		repo.reloadServicesFromConfig(config)
+	case !reflect.DeepEqual(old.ConnDefaults, config.ConnDefaults) || !discoveryRulesEqual(old.DiscoveryRules, config.DiscoveryRules):
+		// Connection strings and overrides of discovered services are based on defaults and discovery rules. Remove
+		// discovered services, they will be discovered again using new settings.
+		for _, id := range repo.getServiceIDs() {
+			if s := repo.getService(id); s.ConnSettings.ServiceType == model.ServiceTypeSystem || s.sdFile != "" {
+				continue
+			}
+			repo.removeService(id)
+			log.Infof("reload: service [%s] removed, defaults or discovery rules changed", id)
+		}
+
+		if err := repo.lookupServices(config); err != nil {
+			log.Warnf("auto-discovery: services lookup failed: %s; skip", err)
+		}
+	}
+
+	// Settings which are common for all collectors.
+	rebuildAll := old.NoTrackMode != config.NoTrackMode || !filtersEqual(old.Filters, config.Filters) ||
+		!reflect.DeepEqual(old.CollectorsSettings, config.CollectorsSettings) || !relabelConfigsEqual(old.RelabelConfigs, config.RelabelConfigs) ||
+		old.CardinalityLimits != config.CardinalityLimits
+
+	for _, id := range repo.getServiceIDs() {
+		s := repo.getService(id)
+		if s.Collector == nil {
+			continue
+		}
+
+		serviceType, overrides := s.ConnSettings.ServiceType, s.ConnSettings.Overrides
+		oldEnabled := enabledCollectors(serviceType, overrides.DisabledCollectors(old.DisabledCollectors))
+		newEnabled := enabledCollectors(serviceType, overrides.DisabledCollectors(config.DisabledCollectors))
+		if rebuildAll || !stringsEqual(oldEnabled, newEnabled) {
+			s.Collector.Close()
+			s.Collector = nil
+			repo.addService(id, s)
+			log.Infof("reload: service [%s] collectors will be rebuilt", id)
+		}
+	}
+
+	// Files of file discovery might be changed, notify file discovery to synchronize services.
+	select {
+	case repo.fileSDCh <- struct{}{}:
+	default:
+	}
+
+	// Create collectors for new services and services with removed collectors.
+	return repo.setupServices(config)
+}
+
+// reloadServicesFromConfig synchronizes services in the repo with services defined in config file.
+func (repo *Repository) reloadServicesFromConfig(config Config) {
+	wanted := map[string]ConnSetting{}
+	for _, cs := range config.ConnSettings {
+		pgconfig, err := pgx.ParseConfig(cs.Conninfo)
+		if err != nil {
+			log.Warnf("%s: %s, skip", cs.Conninfo, err)
+			continue
+		}
+		wanted[newServiceKey(cs.ServiceType, pgconfig)] = cs
+	}
+
+	// Remove services which are not defined anymore or which connection settings have been changed.
+	for _, id := range repo.getServiceIDs() {
+		s := repo.getService(id)
+		if s.ConnSettings.ServiceType == model.ServiceTypeSystem || s.sdFile != "" {
+			continue
+		}
+
+		if cs, ok := wanted[id]; ok && cs.equal(s.source) {
+			delete(wanted, id)
+			continue
+		}
+
+		repo.removeService(id)
+		log.Infof("reload: service [%s] removed", s.ServiceID)
+	}
+
+	// Add new services and services with changed connection settings.
+	for _, cs := range config.ConnSettings {
+		pgconfig, err := pgx.ParseConfig(cs.Conninfo)
+		if err != nil {
+			continue
+		}
+		if _, ok := wanted[newServiceKey(cs.ServiceType, pgconfig)]; ok {
+			repo.addServiceFromConnSetting(cs)
+		}
+	}
+}
+
+// enabledCollectors returns sorted names of collectors enabled for the specified type of service.
+func enabledCollectors(serviceType string, disabled []string) []string {
+	factories := collector.Factories{}
+
+	switch serviceType {
+	case model.ServiceTypeSystem:
+		factories.RegisterSystemCollectors(disabled)
+	case model.ServiceTypePostgresql:
+		factories.RegisterPostgresCollectors(disabled)
+	case model.ServiceTypePgbouncer:
+		factories.RegisterPgbouncerCollectors(disabled)
+	}
+
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// filtersEqual returns true if filters have the same patterns.
+func filtersEqual(a, b filter.Filters) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for name, fa := range a {
+		fb, ok := b[name]
+		if !ok || fa.Include != fb.Include || fa.Exclude != fb.Exclude {
+			return false
+		}
+	}
+
+	return true
+}
+
+// relabelConfigsEqual returns true if relabeling rules have the same settings in the same order.
+func relabelConfigsEqual(a, b relabel.Configs) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if !stringsEqual(a[i].SourceLabels, b[i].SourceLabels) || a[i].Separator != b[i].Separator ||
+			a[i].Regex != b[i].Regex || a[i].TargetLabel != b[i].TargetLabel ||
+			a[i].Replacement != b[i].Replacement || a[i].Action != b[i].Action {
+			return false
+		}
+	}
+
+	return true
+}
+
+// stringsEqual returns true if slices have the same strings in the same order.
+func stringsEqual(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
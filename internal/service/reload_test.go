@@ -0,0 +1,87 @@
+package service
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/filter"
+	"github.com/weaponry/pgscv/internal/model"
+	"github.com/weaponry/pgscv/internal/relabel"
+	"testing"
+)
+
+func TestRepository_reload(t *testing.T) {
+	r := NewRepository()
+	config := Config{ConnSettings: []ConnSetting{}}
+	r.addServicesFromConfig(config)
+	assert.NoError(t, r.setupServices(config))
+
+	c1 := r.getService("system:0").Collector
+	assert.NotNil(t, c1)
+
+	// Nothing changed, collector should be untouched.
+	assert.NoError(t, r.reload(config))
+	assert.True(t, c1 == r.getService("system:0").Collector)
+
+	// Disabled collector changed, collector should be rebuilt.
+	config.DisabledCollectors = []string{"system/loadaverage"}
+	assert.NoError(t, r.reload(config))
+	c2 := r.getService("system:0").Collector
+	assert.NotNil(t, c2)
+	assert.False(t, c1 == c2)
+
+	// Disabled collectors of other services changed, collector should be untouched.
+	config.DisabledCollectors = []string{"system/loadaverage", "postgres/activity"}
+	assert.NoError(t, r.reload(config))
+	assert.True(t, c2 == r.getService("system:0").Collector)
+
+	// Filters changed, collector should be rebuilt.
+	config.Filters = map[string]filter.Filter{"netdev/device": {Exclude: "docker"}}
+	assert.NoError(t, r.reload(config))
+	c3 := r.getService("system:0").Collector
+	assert.NotNil(t, c3)
+	assert.False(t, c2 == c3)
+
+}
+
+func TestRepository_reloadServicesFromConfig(t *testing.T) {
+	r := NewRepository()
+	s := TestPostgresService()
+	r.addService("postgres:127.0.0.1:5432", s)
+	r.addService("system:0", Service{ServiceID: "system:0", ConnSettings: ConnSetting{ServiceType: model.ServiceTypeSystem}})
+
+	// Service with the same connection settings should be kept.
+	r.reloadServicesFromConfig(Config{ConnSettings: []ConnSetting{s.ConnSettings}})
+	assert.Equal(t, 2, r.totalServices())
+
+	// Service which is not defined anymore should be removed, system service should be kept.
+	r.reloadServicesFromConfig(Config{ConnSettings: []ConnSetting{}})
+	assert.Equal(t, 1, r.totalServices())
+	assert.Equal(t, "system:0", r.getService("system:0").ServiceID)
+}
+
+func Test_enabledCollectors(t *testing.T) {
+	all := enabledCollectors(model.ServiceTypeSystem, nil)
+	assert.Contains(t, all, "system/loadaverage")
+
+	got := enabledCollectors(model.ServiceTypeSystem, []string{"system/loadaverage"})
+	assert.Len(t, got, len(all)-1)
+	assert.NotContains(t, got, "system/loadaverage")
+
+	assert.Len(t, enabledCollectors(model.ServiceTypeSystem, []string{"system"}), 0)
+	assert.Len(t, enabledCollectors("unknown", nil), 0)
+}
+
+func Test_filtersEqual(t *testing.T) {
+	a := filter.Filters{"netdev/device": {Exclude: "docker"}}
+	assert.True(t, filtersEqual(a, filter.Filters{"netdev/device": {Exclude: "docker"}}))
+	assert.False(t, filtersEqual(a, filter.Filters{"netdev/device": {Include: "docker"}}))
+	assert.False(t, filtersEqual(a, filter.Filters{"diskstats/device": {Exclude: "docker"}}))
+	assert.False(t, filtersEqual(a, filter.Filters{}))
+}
+
+func Test_relabelConfigsEqual(t *testing.T) {
+	a := relabel.Configs{{SourceLabels: []string{"datname"}, Regex: "app.*", Action: "keep"}}
+	assert.True(t, relabelConfigsEqual(a, relabel.Configs{{SourceLabels: []string{"datname"}, Regex: "app.*", Action: "keep"}}))
+	assert.False(t, relabelConfigsEqual(a, relabel.Configs{{SourceLabels: []string{"datname"}, Regex: "app.*", Action: "drop"}}))
+	assert.False(t, relabelConfigsEqual(a, relabel.Configs{{SourceLabels: []string{"schema"}, Regex: "app.*", Action: "keep"}}))
+	assert.False(t, relabelConfigsEqual(a, relabel.Configs{}))
+}
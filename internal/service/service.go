@@ -7,11 +7,13 @@ import (
 	"fmt"
 	"github.com/jackc/pgx/v4"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/shirou/gopsutil/process"
 	"github.com/weaponry/pgscv/internal/collector"
 	"github.com/weaponry/pgscv/internal/filter"
 	"github.com/weaponry/pgscv/internal/log"
 	"github.com/weaponry/pgscv/internal/model"
+	"github.com/weaponry/pgscv/internal/relabel"
 	"github.com/weaponry/pgscv/internal/store"
 	"io"
 	"os"
@@ -47,6 +49,24 @@ type Service struct {
 	// TotalErrors represents total number of times where service's health checks failed. When errors limit is reached service
 	// removed from the repo.
 	TotalErrors int
+	// HealthcheckFailures represents total number of failed health checks of the service, unlike TotalErrors it is not
+	// reset when health check succeeds.
+	HealthcheckFailures int
+	// ConfigChanges represents total number of times where service's properties have been changed and its collector
+	// has been re-created.
+	ConfigChanges int
+	// source is the connection settings before the password is read from file or command, they are used for re-reading
+	// the password when it has been changed.
+	source ConnSetting
+	// sdFile is the file where the service is defined, empty for services defined in config file or auto-discovered.
+	sdFile string
+	// static is true for services defined in config file or in service discovery files.
+	static bool
+	// container is true for services running in containers. Their files are not accessible at paths reported by the
+	// services, hence collectors which read files of the service are not used.
+	container bool
+	// skipChecks defines number of health checks which are skipped, it is used for backing off checks of failing service.
+	skipChecks int
 }
 
 // Config defines service's configuration.
@@ -55,23 +75,67 @@ type Config struct {
 	NoTrackMode        bool
 	ConnDefaults       map[string]string `yaml:"defaults"` // Defaults
 	ConnSettings       []ConnSetting
+	DiscoveryRules     []DiscoveryRule
+	FileSD             FileSDConfig
 	Filters            map[string]filter.Filter
 	DisabledCollectors []string
+	CollectorsSettings collector.CollectorsSettings
+	RelabelConfigs     relabel.Configs
+	CardinalityLimits  collector.CardinalityLimits
+	RefreshInterval    time.Duration // Interval between re-reading properties of services
+	Healthcheck        HealthcheckConfig
 }
 
 // Exporter is an interface for prometheus.Collector.
 type Collector interface {
 	Describe(chan<- *prometheus.Desc)
 	Collect(chan<- prometheus.Metric)
+	Gather(context.Context) ([]*dto.MetricFamily, error)
+	Close()
 }
 
 // ConnSetting describes connection settings required for connecting to particular service. This struct primarily
-// is used for representing services defined by user in the config file.
+// is used for representing services defined by user in the config file or in service discovery files.
 type ConnSetting struct {
 	// ServiceType defines type of service for which these connection settings are used.
-	ServiceType string `yaml:"service_type"`
+	ServiceType string `yaml:"service_type" json:"service_type"`
 	// Conninfo is the connection string in service-specific format.
-	Conninfo string `yaml:"conninfo"`
+	Conninfo string `yaml:"conninfo" json:"conninfo"`
+	// PasswordFile defines the file which content is used as password.
+	PasswordFile string `yaml:"password_file" json:"password_file"`
+	// PasswordCommand defines the shell command which output is used as password.
+	PasswordCommand string `yaml:"password_command" json:"password_command"`
+	// Overrides defines settings of the service which override global settings.
+	Overrides `yaml:",inline"`
+}
+
+// equal returns true if connection settings are the same.
+func (cs ConnSetting) equal(other ConnSetting) bool {
+	return cs.ServiceType == other.ServiceType && cs.Conninfo == other.Conninfo && cs.PasswordFile == other.PasswordFile &&
+		cs.PasswordCommand == other.PasswordCommand && cs.Overrides.equal(other.Overrides)
+}
+
+// Validate checks connection settings of the service defined by user.
+func (cs ConnSetting) Validate() error {
+	if cs.ServiceType == "" {
+		return fmt.Errorf("service_type is not specified for %s", cs.Conninfo)
+	}
+
+	// Validation is performed using pgx.ParseConfig method which does all dirty work.
+	_, err := pgx.ParseConfig(cs.Conninfo)
+	if err != nil {
+		return fmt.Errorf("invalid conninfo: %s", err)
+	}
+
+	if cs.PasswordFile != "" && cs.PasswordCommand != "" {
+		return fmt.Errorf("password_file and password_command can not be used together for %s", cs.Conninfo)
+	}
+
+	if err := cs.Overrides.Validate(); err != nil {
+		return fmt.Errorf("invalid settings of service %s: %s", cs.Conninfo, err)
+	}
+
+	return nil
 }
 
 // connectionParams is the set of parameters that may be required when constructing connection string.
@@ -90,12 +154,23 @@ type connectionParams struct {
 type Repository struct {
 	sync.RWMutex                    // protect concurrent access
 	Services     map[string]Service // service repo store
+	config       Config             // current services configuration, replaced at configuration reload
+	discovered   bool               // true when services have been discovered (or added from config) at least once
+	fileSDCh     chan struct{}      // notifies file discovery about configuration reload
+	notifyCh     chan notification  // notifications sent by collectors of services during scrapes
+	// updateMu serializes changes of the set of services and of their collectors: adding and removing services,
+	// closing and re-creating collectors. Changes are made by auto-discovery, file discovery, configuration reload,
+	// health checks, properties refresh and handling of notifications sent by collectors. Each of them reads the
+	// services, decides what to change and applies the change, which should not interleave with other changes.
+	updateMu sync.Mutex
 }
 
 // NewRepository creates new services repository.
 func NewRepository() *Repository {
 	return &Repository{
 		Services: make(map[string]Service),
+		fileSDCh: make(chan struct{}, 1),
+		notifyCh: make(chan notification, notificationsBuffer),
 	}
 }
 
@@ -106,6 +181,11 @@ func (repo *Repository) GetService(id string) Service {
 	return repo.getService(id)
 }
 
+//
+func (repo *Repository) GetConfig() Config {
+	return repo.getConfig()
+}
+
 //
 func (repo *Repository) TotalServices() int {
 	return repo.totalServices()
@@ -131,8 +211,78 @@ func (repo *Repository) StartBackgroundDiscovery(ctx context.Context, config Con
 	repo.startBackgroundDiscovery(ctx, config)
 }
 
+//
+func (repo *Repository) StartFileDiscovery(ctx context.Context, config Config) error {
+	return repo.startFileDiscovery(ctx, config)
+}
+
+//
+func (repo *Repository) StartHealthchecks(ctx context.Context) {
+	repo.startHealthchecks(ctx)
+}
+
+//
+func (repo *Repository) StartServicesRefresh(ctx context.Context) {
+	repo.startServicesRefresh(ctx)
+}
+
+//
+func (repo *Repository) StartNotificationsHandling(ctx context.Context) {
+	repo.startNotificationsHandling(ctx)
+}
+
+//
+func (repo *Repository) Reload(config Config) error {
+	return repo.reload(config)
+}
+
+//
+func (repo *Repository) NewGatherer(ctx context.Context) prometheus.Gatherer {
+	return repo.newGatherer(ctx)
+}
+
+//
+func (repo *Repository) Close() {
+	repo.close()
+}
+
+//
+func (repo *Repository) Status() []ServiceStatus {
+	return repo.status()
+}
+
+//
+func (repo *Repository) CollectorsStatus() []CollectorsStatus {
+	return repo.collectorsStatus()
+}
+
+//
+func (repo *Repository) Readiness() Readiness {
+	return repo.readiness()
+}
+
+//
+func (repo *Repository) Check(ctx context.Context, config Config) []ServiceCheck {
+	return repo.check(ctx, config)
+}
+
 /* Private methods of Repository */
 
+// setConfig saves current services configuration.
+func (repo *Repository) setConfig(config Config) {
+	repo.Lock()
+	repo.config = config
+	repo.Unlock()
+}
+
+// getConfig returns current services configuration.
+func (repo *Repository) getConfig() Config {
+	repo.RLock()
+	c := repo.config
+	repo.RUnlock()
+	return c
+}
+
 // addService adds service to the repo.
 func (repo *Repository) addService(id string, s Service) {
 	repo.Lock()
@@ -140,6 +290,21 @@ func (repo *Repository) addService(id string, s Service) {
 	repo.Unlock()
 }
 
+// markDiscovered remembers services have been discovered at least once.
+func (repo *Repository) markDiscovered() {
+	repo.Lock()
+	repo.discovered = true
+	repo.Unlock()
+}
+
+// isDiscovered returns true if services have been discovered at least once.
+func (repo *Repository) isDiscovered() bool {
+	repo.RLock()
+	discovered := repo.discovered
+	repo.RUnlock()
+	return discovered
+}
+
 // getService returns the service from repo with specified ID.
 func (repo *Repository) getService(id string) Service {
 	repo.RLock()
@@ -148,11 +313,12 @@ func (repo *Repository) getService(id string) Service {
 	return s
 }
 
-// markServiceFailed increments total number of health check errors.
+// markServiceFailed increments number of health check errors in a row and total number of failed health checks.
 func (repo *Repository) markServiceFailed(id string) {
 	repo.Lock()
 	s := repo.Services[id]
 	s.TotalErrors++
+	s.HealthcheckFailures++
 	repo.Services[id] = s
 	repo.Unlock()
 }
@@ -165,20 +331,35 @@ func (repo *Repository) getServiceStatus(id string) int {
 	return n
 }
 
-// markServiceHealthy resets health check errors counter to zero.
+// markServiceHealthy resets health check errors counter to zero and cancels backoff of health checks.
 func (repo *Repository) markServiceHealthy(id string) {
 	repo.Lock()
 	s := repo.Services[id]
 	s.TotalErrors = 0
+	s.skipChecks = 0
 	repo.Services[id] = s
 	repo.Unlock()
 }
 
-// removeService removes service from the repo.
+// removeService removes service from the repo and closes its collector.
 func (repo *Repository) removeService(id string) {
 	repo.Lock()
+	s := repo.Services[id]
 	delete(repo.Services, id)
 	repo.Unlock()
+
+	if s.Collector != nil {
+		s.Collector.Close()
+	}
+}
+
+// close closes collectors of all services in the repo, services are kept in the repo.
+func (repo *Repository) close() {
+	for _, id := range repo.getServiceIDs() {
+		if c := repo.getService(id).Collector; c != nil {
+			c.Close()
+		}
+	}
 }
 
 // totalServices returns the number of services registered in the repo.
@@ -204,6 +385,8 @@ func (repo *Repository) getServiceIDs() []string {
 func (repo *Repository) addServicesFromConfig(config Config) {
 	log.Debug("config: add services from config file")
 
+	repo.setConfig(config)
+
 	// Always add system service.
 	repo.addService("system:0", Service{ServiceID: "system:0", ConnSettings: ConnSetting{ServiceType: model.ServiceTypeSystem}})
 	log.Info("registered new service [system:0]")
@@ -217,59 +400,79 @@ func (repo *Repository) addServicesFromConfig(config Config) {
 	// Check all passed connection settings and try to connect using them. In case of success, create a 'Service' instance
 	// in the repo.
 	for _, cs := range config.ConnSettings {
-		// *ConnConfig struct will be used for
-		//   1) doing connection;
-		//   2) getting connection properties to define service-specific parameters.
-		pgconfig, err := pgx.ParseConfig(cs.Conninfo)
-		if err != nil {
-			log.Warnf("%s: %s, skip", cs.Conninfo, err)
-			continue
-		}
+		repo.addServiceFromConnSetting(cs)
+	}
 
-		// Check connection using created *ConnConfig, go next if connection failed.
-		db, err := store.NewWithConfig(pgconfig)
-		if err != nil {
-			log.Warnf("%s: %s, skip", cs.Conninfo, err)
-			continue
-		}
-		db.Close()
+	repo.markDiscovered()
+}
 
-		// Connection was successful, create 'Service' struct with service-related properties and add it to service repo.
-		s := Service{
-			ServiceID:    cs.ServiceType + ":" + strconv.Itoa(int(pgconfig.Port)),
-			ConnSettings: cs,
-			Collector:    nil,
-		}
+// addServiceFromConnSetting checks connection settings of the service defined in config file, and adds the service
+// to the repo if connection was successful.
+func (repo *Repository) addServiceFromConnSetting(source ConnSetting) {
+	key, s, err := newServiceFromConnSetting(source)
+	if err != nil {
+		log.Warnf("%s: %s, skip", source.Conninfo, err)
+		return
+	}
+
+	repo.addService(key, s)
+	log.Infof("registered new service [%s]", s.ServiceID)
+}
+
+// newServiceFromConnSetting checks connection settings of the service and returns the service and its key in the repo
+// if connection was successful.
+func newServiceFromConnSetting(source ConnSetting) (string, Service, error) {
+	cs, err := source.ResolvePassword()
+	if err != nil {
+		return "", Service{}, err
+	}
+
+	// *ConnConfig struct will be used for
+	//   1) doing connection;
+	//   2) getting connection properties to define service-specific parameters.
+	pgconfig, err := pgx.ParseConfig(cs.Conninfo)
+	if err != nil {
+		return "", Service{}, err
+	}
+
+	// Check connection using created *ConnConfig, go next if connection failed.
+	db, err := store.NewWithConfig(pgconfig)
+	if err != nil {
+		return "", Service{}, err
+	}
+	db.Close()
 
-		// Add "host", because user might manually specify services with the same port (but the are running on different hosts).
-		var key = strings.Join([]string{cs.ServiceType, pgconfig.Host, strconv.Itoa(int(pgconfig.Port))}, ":")
-		repo.addService(key, s)
-		log.Infof("registered new service [%s]", s.ServiceID)
-		log.Debugf("new service available through: %s@%s:%d/%s", pgconfig.User, pgconfig.Host, pgconfig.Port, pgconfig.Database)
+	// Connection was successful, create 'Service' struct with service-related properties.
+	s := Service{
+		ServiceID:    cs.ServiceType + ":" + strconv.Itoa(int(pgconfig.Port)),
+		ConnSettings: cs,
+		Collector:    nil,
+		source:       source,
+		static:       true,
 	}
+
+	log.Debugf("new service available through: %s@%s:%d/%s", pgconfig.User, pgconfig.Host, pgconfig.Port, pgconfig.Database)
+	return newServiceKey(cs.ServiceType, pgconfig), s, nil
+}
+
+// newServiceKey returns key of the service defined in config file.
+func newServiceKey(serviceType string, pgconfig *pgx.ConnConfig) string {
+	// Add "host", because user might manually specify services with the same port (but the are running on different hosts).
+	return strings.Join([]string{serviceType, pgconfig.Host, strconv.Itoa(int(pgconfig.Port))}, ":")
 }
 
 // startBackgroundDiscovery looking for services and add them to the repo.
 func (repo *Repository) startBackgroundDiscovery(ctx context.Context, config Config) {
 	log.Debug("starting background auto-discovery loop")
 
+	repo.setConfig(config)
+
 	// add pseudo-service for system metrics
 	repo.addService("system:0", Service{ServiceID: "system:0", ConnSettings: ConnSetting{ServiceType: model.ServiceTypeSystem}})
 	log.Infoln("auto-discovery: service added [system:0]")
 
 	for {
-		if err := repo.lookupServices(config); err != nil {
-			log.Warnf("auto-discovery: services lookup failed: %s; skip", err)
-			continue
-		}
-		if err := repo.setupServices(config); err != nil {
-			log.Warnf("auto-discovery: services setup failed: %s; skip", err)
-			continue
-		}
-
-		// Perform health check for services with remote endpoints (e.g. Postgres or Pgbouncer). Services which continuously
-		// don't respond are removed from the repo (but if they appear later they will be discovered again).
-		repo.healthcheckServices()
+		repo.discoverServices()
 
 		// Sleep until timeout or exit if context canceled.
 		select {
@@ -282,6 +485,26 @@ func (repo *Repository) startBackgroundDiscovery(ctx context.Context, config Con
 	}
 }
 
+// discoverServices makes single iteration of auto-discovery using current configuration.
+func (repo *Repository) discoverServices() {
+	// Configuration might be reloaded concurrently, don't allow reload in the middle of iteration.
+	repo.updateMu.Lock()
+	defer repo.updateMu.Unlock()
+
+	config := repo.getConfig()
+
+	if err := repo.lookupServices(config); err != nil {
+		log.Warnf("auto-discovery: services lookup failed: %s; skip", err)
+		return
+	}
+	if err := repo.setupServices(config); err != nil {
+		log.Warnf("auto-discovery: services setup failed: %s; skip", err)
+		return
+	}
+
+	repo.markDiscovered()
+}
+
 // lookupServices scans PIDs and looking for required services
 func (repo *Repository) lookupServices(config Config) error {
 	log.Debug("auto-discovery: looking up for new services...")
@@ -307,8 +530,7 @@ func (repo *Repository) lookupServices(config Config) error {
 
 		switch name {
 		case "postgres":
-			ppid, _ := proc.Ppid() // error doesn't matter here, even if ppid will be 0 - we're interested in ppid == 1
-			if ppid == 1 {
+			if isPostmaster(proc) {
 				postgres, err := discoverPostgres(proc, config)
 				if err != nil {
 					log.Warnf("auto-discovery [postgres]: discovery failed: %s; skip", err)
@@ -354,26 +576,44 @@ func (repo *Repository) setupServices(config Config) error {
 		var service = repo.getService(id)
 		if service.Collector == nil {
 			factories := collector.Factories{}
+			overrides := service.ConnSettings.Overrides
+			disabled := overrides.DisabledCollectors(config.DisabledCollectors)
 			collectorConfig := collector.Config{
-				NoTrackMode: config.NoTrackMode,
-				ServiceType: service.ConnSettings.ServiceType,
-				ConnString:  service.ConnSettings.Conninfo,
-				Filters:     config.Filters,
+				NoTrackMode:       config.NoTrackMode,
+				ServiceType:       service.ConnSettings.ServiceType,
+				ConnString:        service.ConnSettings.Conninfo,
+				Filters:           overrides.MergeFilters(config.Filters),
+				Settings:          config.CollectorsSettings,
+				RelabelConfigs:    config.RelabelConfigs,
+				CardinalityLimits: config.CardinalityLimits,
+				ConstLabels:       overrides.Labels,
+				ConfigChanges:     service.ConfigChanges,
+			}
+
+			if service.source.hasPasswordSource() {
+				collectorConfig.OnAuthFailure = repo.newAuthFailureHandler(id)
 			}
 
 			switch service.ConnSettings.ServiceType {
 			case model.ServiceTypeSystem:
-				factories.RegisterSystemCollectors(config.DisabledCollectors)
+				factories.RegisterSystemCollectors(disabled)
 			case model.ServiceTypePostgresql:
-				factories.RegisterPostgresCollectors(config.DisabledCollectors)
+				factories.RegisterPostgresCollectors(disabled)
+				if service.container {
+					factories.UnregisterLocalCollectors()
+				}
 				cfg, err := collector.NewPostgresServiceConfig(collectorConfig.ConnString)
 				if err != nil {
 					log.Errorf("service [%s] setup failed: %s; skip", service.ServiceID, err)
 					continue
 				}
 				collectorConfig.PostgresServiceConfig = cfg
+
+				if overrides.PatroniURL != "" {
+					repo.setupPatroni(id, overrides.PatroniURL, &collectorConfig)
+				}
 			case model.ServiceTypePgbouncer:
-				factories.RegisterPgbouncerCollectors(config.DisabledCollectors)
+				factories.RegisterPgbouncerCollectors(disabled)
 			default:
 				continue
 			}
@@ -384,9 +624,6 @@ func (repo *Repository) setupServices(config Config) error {
 			}
 			service.Collector = mc
 
-			// Register collector.
-			prometheus.MustRegister(service.Collector)
-
 			// put updated service copy into repo
 			repo.addService(id, service)
 			log.Debugf("service configured [%s]", id)
@@ -396,45 +633,9 @@ func (repo *Repository) setupServices(config Config) error {
 	return nil
 }
 
-// healthcheckServices performs services health checks and remove those who don't respond too long
-func (repo *Repository) healthcheckServices() {
-	log.Debug("services healthcheck started")
-
-	// Remove service after 10 failed health checks.
-	var errorThreshold = 10
-
-	for _, id := range repo.getServiceIDs() {
-		var service = repo.getService(id)
-
-		switch service.ConnSettings.ServiceType {
-		case model.ServiceTypePostgresql, model.ServiceTypePgbouncer:
-			totalErrors := repo.getServiceStatus(id)
-			err := attemptConnect(service.ConnSettings.Conninfo)
-			if err != nil {
-				totalErrors++
-				if totalErrors < errorThreshold {
-					repo.markServiceFailed(id)
-					log.Warnf("service [%s] failed: tries remain %d/%d", id, totalErrors, errorThreshold)
-				} else {
-					// unregister collector and remove the service.
-					if repo.Services[id].Collector != nil {
-						prometheus.Unregister(repo.Services[id].Collector)
-					}
-
-					repo.removeService(id)
-					log.Errorf("service [%s] removed: too many failures %d/%d", id, totalErrors, errorThreshold)
-				}
-			}
-		default:
-			continue
-		}
-	}
-
-	log.Debug("services healthcheck finished")
-}
-
 // discoverPostgres reads "datadir" argument from Postmaster's cmdline string and reads postmaster.pid stored in data
-// directory. Using postmaster.pid data construct "conninfo" string and test it through making a connection.
+// directory. Using postmaster.pid data construct "conninfo" string and test it through making a connection. Files of
+// Postgres running in container are accessed through the root directory of the process.
 func discoverPostgres(proc *process.Process, config Config) (Service, error) {
 	log.Debugf("auto-discovery [postgres]: analyzing process with pid %d", proc.Pid)
 
@@ -444,36 +645,112 @@ func discoverPostgres(proc *process.Process, config Config) (Service, error) {
 	}
 	// parse cmdline
 	datadirCmdPath, err := parsePostgresProcessCmdline(cmdline)
+	if err != nil {
+		// Data directory might be specified in environment, e.g. in official Docker images.
+		if datadirCmdPath = readProcessEnv(proc.Pid, "PGDATA"); datadirCmdPath == "" {
+			return Service{}, err
+		}
+	}
+
+	container, err := newContainerInfo(proc.Pid)
+	if err != nil {
+		log.Debugf("auto-discovery [postgres]: read cgroup of pid %d failed: %s; assume it is not in container", proc.Pid, err)
+	}
+
+	var root string
+	if container.id != "" {
+		root = fmt.Sprintf("/proc/%d/root", proc.Pid)
+	}
+
+	connParams, err := newPostgresConnectionParams(filepath.Join(root, datadirCmdPath, "postmaster.pid"))
 	if err != nil {
 		return Service{}, err
 	}
 
-	connParams, err := newPostgresConnectionParams(datadirCmdPath + "/postmaster.pid")
+	serviceID := model.ServiceTypePostgresql + ":" + strconv.Itoa(connParams.listenPort)
+	unixParams, tcpParams := connParams, connParams
+	if container.id != "" {
+		// Containers might use the same ports, add container ID for distinguishing them.
+		serviceID = model.ServiceTypePostgresql + ":" + container.shortID() + ":" + strconv.Itoa(connParams.listenPort)
+		unixParams, tcpParams = containerConnectionParams(connParams, root, container, sameNetNamespace(proc.Pid))
+	}
+
+	source := ConnSetting{
+		ServiceType:     model.ServiceTypePostgresql,
+		PasswordFile:    config.ConnDefaults["postgres_password_file"],
+		PasswordCommand: config.ConnDefaults["postgres_password_command"],
+		Overrides:       discoveryOverrides(config.DiscoveryRules, model.ServiceTypePostgresql, connParams.listenPort, connParams.datadirPath),
+	}
+	if source.Overrides.PatroniURL == "" {
+		source.Overrides.PatroniURL = config.ConnDefaults["patroni_url"]
+	}
+	if container.id != "" {
+		source.Overrides.Labels = container.labels(source.Overrides.Labels)
+	}
+
+	password, err := source.readPassword()
 	if err != nil {
 		return Service{}, err
 	}
 
 	// Construct the connection string using the data from postmaster.pid and user-defined defaults.
 	// Depending on configured Postgres there can be UNIX-based or TCP-based connection string
-	var connString string
+	var cs ConnSetting
 	for _, v := range []bool{true, false} {
-		connString = newPostgresConnectionString(connParams, config.ConnDefaults, v)
-		if err := attemptConnect(connString); err == nil {
+		params := unixParams
+		if !v {
+			params = tcpParams
+			// Postgres in container is not reachable through TCP, don't connect to something else.
+			if container.id != "" && params.listenAddr == "" {
+				break
+			}
+		}
+
+		source.Conninfo = newPostgresConnectionString(params, config.ConnDefaults, v)
+		cs, err = source.withPassword(password)
+		if err != nil {
+			return Service{}, err
+		}
+
+		if err := attemptConnect(cs.Conninfo); err == nil {
 			// no need to continue because connection with created connString was successful
 			break
 		}
 	}
 
 	s := Service{
-		ServiceID:    model.ServiceTypePostgresql + ":" + strconv.Itoa(connParams.listenPort),
-		ConnSettings: ConnSetting{ServiceType: model.ServiceTypePostgresql, Conninfo: connString},
+		ServiceID:    serviceID,
+		ConnSettings: cs,
 		Collector:    nil,
+		source:       source,
+		container:    container.id != "",
 	}
 
-	log.Debugf("auto-discovery [postgres]: service has been found, pid %d, available through %s", proc.Pid, connString)
+	log.Debugf("auto-discovery [postgres]: service has been found, pid %d, available through %s", proc.Pid, sanitizeConninfo(cs.Conninfo))
 	return s, nil
 }
 
+// isPostmaster returns true if the process is the postmaster - the postgres process which parent is not postgres. Parent
+// of postmaster is init or service manager, or container's shim or init process when postmaster is running in container.
+func isPostmaster(proc *process.Process) bool {
+	ppid, err := proc.Ppid()
+	if err != nil {
+		return false
+	}
+
+	parent, err := process.NewProcess(ppid)
+	if err != nil {
+		return false
+	}
+
+	name, err := parent.Name()
+	if err != nil {
+		return false
+	}
+
+	return name != "postgres"
+}
+
 // parsePostgresProcessCmdline parses postgres process cmdline for data directory argument
 func parsePostgresProcessCmdline(cmdline []string) (string, error) {
 	for i, arg := range cmdline {
@@ -532,6 +809,8 @@ func newPostgresConnectionParams(pidFilePath string) (connectionParams, error) {
 }
 
 // newPostgresConnectionString creates special connection string for connecting to Postgres using passed connection parameters.
+// When password is not specified in defaults, it is looked up in the password file (~/.pgpass or file specified in
+// PGPASSFILE) during connecting.
 func newPostgresConnectionString(connParams connectionParams, defaults map[string]string, unix bool) string {
 	var password, connString string
 	var username = defaultPostgresUsername
@@ -592,16 +871,28 @@ func discoverPgbouncer(proc *process.Process, config Config) (Service, error) {
 		return Service{}, err
 	}
 
-	connString := newPgbouncerConnectionString(connParams, config.ConnDefaults)
+	source := ConnSetting{
+		ServiceType:     model.ServiceTypePgbouncer,
+		Conninfo:        newPgbouncerConnectionString(connParams, config.ConnDefaults),
+		PasswordFile:    config.ConnDefaults["pgbouncer_password_file"],
+		PasswordCommand: config.ConnDefaults["pgbouncer_password_command"],
+		Overrides:       discoveryOverrides(config.DiscoveryRules, model.ServiceTypePgbouncer, connParams.listenPort, ""),
+	}
 
-	if err := attemptConnect(connString); err != nil {
+	cs, err := source.ResolvePassword()
+	if err != nil {
+		return Service{}, err
+	}
+
+	if err := attemptConnect(cs.Conninfo); err != nil {
 		return Service{}, err
 	}
 
 	s := Service{
 		ServiceID:    model.ServiceTypePgbouncer + ":" + strconv.Itoa(connParams.listenPort),
-		ConnSettings: ConnSetting{ServiceType: model.ServiceTypePgbouncer, Conninfo: connString},
+		ConnSettings: cs,
 		Collector:    nil,
+		source:       source,
 	}
 
 	log.Debugf("auto-discovery: pgbouncer service has been found, pid %d, available through %s:%d", proc.Pid, connParams.listenAddr, connParams.listenPort)
@@ -705,8 +996,20 @@ func newPgbouncerConnectionString(connParams connectionParams, defaults map[stri
 
 // attemptConnect tries to make a real connection using passed connection string.
 func attemptConnect(connString string) error {
-	log.Debugln("making test connection: ", connString)
-	db, err := store.New(connString)
+	return attemptConnectContext(context.Background(), connString, 0)
+}
+
+// attemptConnectContext tries to make a real connection using passed connection string. Connecting is canceled when
+// context is done or timeout is exceeded, zero timeout means no limit.
+func attemptConnectContext(ctx context.Context, connString string, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	log.Debugln("making test connection: ", sanitizeConninfo(connString))
+	db, err := store.NewContext(ctx, connString)
 	if err != nil {
 		return err
 	}
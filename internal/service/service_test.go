@@ -3,7 +3,9 @@ package service
 import (
 	"context"
 	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
 	"github.com/stretchr/testify/assert"
+	"github.com/weaponry/pgscv/internal/collector"
 	"github.com/weaponry/pgscv/internal/log"
 	"github.com/weaponry/pgscv/internal/model"
 	"os"
@@ -59,7 +61,40 @@ func TestRepository_removeService(t *testing.T) {
 	assert.Equal(t, 1, r.totalServices())
 	r.removeService(s.ServiceID)
 	assert.Equal(t, 0, r.totalServices())
+
+	// Collector of removed service is closed.
+	c := &closeCountingCollector{}
+	s.Collector = c
+	r.addService(s.ServiceID, s)
+	r.removeService(s.ServiceID)
+	assert.Equal(t, 1, c.closed)
+}
+
+func TestRepository_close(t *testing.T) {
+	r := NewRepository()
+	c := &closeCountingCollector{}
+
+	s := TestSystemService()
+	s.Collector = c
+	r.addService(s.ServiceID, s)
+	r.addService("test:0", Service{ServiceID: "test:0"}) // service without collector
+
+	r.close()
+	assert.Equal(t, 1, c.closed)
+	assert.Equal(t, 2, r.totalServices())
+}
+
+// closeCountingCollector is the stub collector which counts Close calls.
+type closeCountingCollector struct {
+	closed int
+}
+
+func (c *closeCountingCollector) Describe(_ chan<- *prometheus.Desc) {}
+func (c *closeCountingCollector) Collect(_ chan<- prometheus.Metric) {}
+func (c *closeCountingCollector) Gather(_ context.Context) ([]*dto.MetricFamily, error) {
+	return nil, nil
 }
+func (c *closeCountingCollector) Close() { c.closed++ }
 
 func TestRepository_getServiceIDs(t *testing.T) {
 	r := NewRepository()
@@ -115,19 +150,34 @@ func TestRepository_addServicesFromConfig(t *testing.T) {
 	}
 }
 
+func TestConnSetting_Validate(t *testing.T) {
+	testcases := []struct {
+		valid bool
+		in    ConnSetting
+	}{
+		{valid: true, in: ConnSetting{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1 user=pgscv"}},
+		{valid: true, in: ConnSetting{ServiceType: model.ServiceTypePgbouncer, Conninfo: "postgres://pgscv@127.0.0.1:6432/pgbouncer", PasswordFile: "/etc/pgscv.password"}},
+		{valid: false, in: ConnSetting{Conninfo: "host=127.0.0.1 user=pgscv"}},
+		{valid: false, in: ConnSetting{ServiceType: model.ServiceTypePostgresql, Conninfo: "invalid conninfo"}},
+		{valid: false, in: ConnSetting{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1", PasswordFile: "/etc/pgscv.password", PasswordCommand: "cat /etc/pgscv.password"}},
+		{valid: false, in: ConnSetting{ServiceType: model.ServiceTypePostgresql, Conninfo: "host=127.0.0.1", Overrides: Overrides{Labels: map[string]string{"service_id": "main"}}}},
+	}
+
+	for _, tc := range testcases {
+		if tc.valid {
+			assert.NoError(t, tc.in.Validate())
+		} else {
+			assert.Error(t, tc.in.Validate())
+		}
+	}
+}
+
 func TestRepository_startBackgroundDiscovery(t *testing.T) {
 	r := NewRepository()
 	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
 	defer cancel()
 	r.startBackgroundDiscovery(ctx, Config{})
 	assert.NotEqual(t, 0, r.totalServices())
-
-	// During discovery collectors are registered for found services,
-	// They should be unregistered to avoid register failures in concurrent tests.
-	for _, id := range r.GetServiceIDs() {
-		s := r.GetService(id)
-		prometheus.Unregister(s.Collector)
-	}
 }
 
 func TestRepository_lookupServices(t *testing.T) {
@@ -165,13 +215,26 @@ func TestRepository_setupServices(t *testing.T) {
 		assert.NoError(t, r.setupServices(tc.config))
 		s := r.GetService("postgres:127.0.0.1:5432")
 		assert.NotNil(t, s.Collector)
+	}
+
+	// Collectors which read files of the service are not used for services running in containers.
+	r := NewRepository()
+	s := TestPostgresService()
+	s.container = true
+	r.addService(s.ServiceID, s)
 
-		prometheus.Unregister(s.Collector)
+	assert.NoError(t, r.setupServices(Config{}))
+	if mc, ok := r.getService(s.ServiceID).Collector.(*collector.PgscvCollector); assert.True(t, ok) {
+		assert.NotContains(t, mc.Collectors, "postgres/logs")
+		assert.NotContains(t, mc.Collectors, "postgres/storage")
+		assert.Contains(t, mc.Collectors, "postgres/activity")
 	}
 }
 
 func Test_healthcheckServices(t *testing.T) {
 	r := NewRepository()
+	// Max backoff is equal to interval, hence failed services are checked every time.
+	r.setConfig(Config{Healthcheck: HealthcheckConfig{Interval: time.Minute, MaxBackoff: time.Minute}})
 	s1 := TestSystemService()
 	r.addService(s1.ServiceID, s1)
 
@@ -182,7 +245,7 @@ func Test_healthcheckServices(t *testing.T) {
 	assert.Equal(t, 2, r.totalServices())
 
 	for i := 0; i < 10; i++ {
-		r.healthcheckServices()
+		r.healthcheckServices(context.Background())
 	}
 
 	assert.Equal(t, 1, r.totalServices())
@@ -0,0 +1,159 @@
+package service
+
+import (
+	"github.com/weaponry/pgscv/internal/collector"
+	"github.com/weaponry/pgscv/internal/model"
+	"net/url"
+	"regexp"
+	"sort"
+)
+
+// passwordRE matches password in connection string of 'keyword = value' format, value might be quoted.
+var passwordRE = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// ServiceStatus describes the service in the repo: its connection settings, health and collectors.
+type ServiceStatus struct {
+	ServiceID   string          `json:"service_id"`
+	ServiceType string          `json:"service_type"`
+	Conninfo    string          `json:"conninfo"`     // Connection string with removed password
+	TotalErrors int             `json:"total_errors"` // Number of failed health checks in a row
+	Collectors  []string        `json:"collectors"`   // Enabled collectors, empty until the service is set up
+	Postgres    *PostgresStatus `json:"postgres,omitempty"`
+}
+
+// PostgresStatus describes properties of Postgres service detected during the service setup.
+type PostgresStatus struct {
+	ServerVersionNum       int    `json:"server_version_num"`
+	DataDirectory          string `json:"data_directory"`
+	BlockSize              int    `json:"block_size"`
+	LoggingCollector       bool   `json:"logging_collector"`
+	PgStatStatements       bool   `json:"pg_stat_statements"`
+	PgStatStatementsSource string `json:"pg_stat_statements_source"`
+	InRecovery             bool   `json:"in_recovery"`
+}
+
+// CollectorsStatus describes results of the last runs of the service's collectors.
+type CollectorsStatus struct {
+	ServiceID  string                      `json:"service_id"`
+	Collectors []collector.CollectorStatus `json:"collectors"`
+}
+
+// status returns statuses of all services in the repo sorted by services IDs.
+func (repo *Repository) status() []ServiceStatus {
+	ids := repo.getServiceIDs()
+	sort.Strings(ids)
+
+	statuses := make([]ServiceStatus, 0, len(ids))
+	for _, id := range ids {
+		s := repo.getService(id)
+
+		status := ServiceStatus{
+			ServiceID:   s.ServiceID,
+			ServiceType: s.ConnSettings.ServiceType,
+			Conninfo:    sanitizeConninfo(s.ConnSettings.Conninfo),
+			TotalErrors: s.TotalErrors,
+			Collectors:  []string{},
+		}
+
+		if mc, ok := s.Collector.(*collector.PgscvCollector); ok {
+			for _, cs := range mc.Status() {
+				status.Collectors = append(status.Collectors, cs.Name)
+			}
+
+			if s.ConnSettings.ServiceType == model.ServiceTypePostgresql {
+				cfg := mc.Config.PostgresServiceConfig
+				status.Postgres = &PostgresStatus{
+					ServerVersionNum:       cfg.ServerVersionNum,
+					DataDirectory:          cfg.DataDirectory,
+					BlockSize:              cfg.BlockSize,
+					LoggingCollector:       cfg.LoggingCollector,
+					PgStatStatements:       cfg.PgStatStatements,
+					PgStatStatementsSource: cfg.PgStatStatementsSource,
+					InRecovery:             cfg.InRecovery,
+				}
+			}
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses
+}
+
+// collectorsStatus returns statuses of collectors of all set up services sorted by services IDs.
+func (repo *Repository) collectorsStatus() []CollectorsStatus {
+	ids := repo.getServiceIDs()
+	sort.Strings(ids)
+
+	statuses := make([]CollectorsStatus, 0, len(ids))
+	for _, id := range ids {
+		s := repo.getService(id)
+
+		mc, ok := s.Collector.(*collector.PgscvCollector)
+		if !ok {
+			continue
+		}
+
+		statuses = append(statuses, CollectorsStatus{ServiceID: s.ServiceID, Collectors: mc.Status()})
+	}
+
+	return statuses
+}
+
+// sanitizeConninfo removes password from connection string in URL or 'keyword = value' formats.
+func sanitizeConninfo(conninfo string) string {
+	if u, err := url.Parse(conninfo); err == nil && (u.Scheme == "postgres" || u.Scheme == "postgresql") {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), "xxxxx")
+		}
+
+		q := u.Query()
+		if q.Get("password") != "" {
+			q.Set("password", "xxxxx")
+			u.RawQuery = q.Encode()
+		}
+
+		return u.String()
+	}
+
+	return passwordRE.ReplaceAllString(conninfo, "${1}xxxxx")
+}
+
+// Readiness describes whether services are discovered and healthy.
+type Readiness struct {
+	Ready      bool            `json:"ready"`
+	Discovered bool            `json:"discovered"` // True when the first discovery pass has been finished
+	Services   []ServiceHealth `json:"services"`
+}
+
+// ServiceHealth describes the result of the service's health checks.
+type ServiceHealth struct {
+	ServiceID   string `json:"service_id"`
+	ServiceType string `json:"service_type"`
+	Status      string `json:"status"`       // 'ok' or 'failing'
+	TotalErrors int    `json:"total_errors"` // Number of failed health checks in a row
+}
+
+// readiness returns readiness of the repo. The repo is not ready until services have been discovered, and when any
+// service fails health checks.
+func (repo *Repository) readiness() Readiness {
+	discovered := repo.isDiscovered()
+	r := Readiness{Ready: discovered, Discovered: discovered, Services: []ServiceHealth{}}
+
+	ids := repo.getServiceIDs()
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		s := repo.getService(id)
+
+		h := ServiceHealth{ServiceID: s.ServiceID, ServiceType: s.ConnSettings.ServiceType, Status: "ok", TotalErrors: s.TotalErrors}
+		if s.TotalErrors > 0 {
+			h.Status = "failing"
+			r.Ready = false
+		}
+
+		r.Services = append(r.Services, h)
+	}
+
+	return r
+}
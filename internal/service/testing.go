@@ -14,22 +14,18 @@ func TestSystemService() Service {
 
 // TestPostgresService returns postgres service for testing purposes
 func TestPostgresService() Service {
-	return Service{
-		ServiceID: "postgres:5432",
-		ConnSettings: ConnSetting{
-			ServiceType: model.ServiceTypePostgresql,
-			Conninfo:    "host=127.0.0.1 port=5432 user=pgscv dbname=pgscv_fixtures",
-		},
+	cs := ConnSetting{
+		ServiceType: model.ServiceTypePostgresql,
+		Conninfo:    "host=127.0.0.1 port=5432 user=pgscv dbname=pgscv_fixtures",
 	}
+	return Service{ServiceID: "postgres:5432", ConnSettings: cs, source: cs}
 }
 
 // TestPgbouncerService returns pgbouncer service for testing purposes
 func TestPgbouncerService() Service {
-	return Service{
-		ServiceID: "pgbouncer:6432",
-		ConnSettings: ConnSetting{
-			ServiceType: model.ServiceTypePgbouncer,
-			Conninfo:    "host=127.0.0.1 port=6432 user=pgscv dbname=pgbouncer",
-		},
+	cs := ConnSetting{
+		ServiceType: model.ServiceTypePgbouncer,
+		Conninfo:    "host=127.0.0.1 port=6432 user=pgscv dbname=pgbouncer",
 	}
+	return Service{ServiceID: "pgbouncer:6432", ConnSettings: cs, source: cs}
 }
@@ -3,6 +3,7 @@ package store
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"github.com/jackc/pgx/v4"
 	"github.com/weaponry/pgscv/internal/log"
 	"github.com/weaponry/pgscv/internal/model"
@@ -15,16 +16,27 @@ type DB struct {
 
 // New creates new connection to Postgres/Pgbouncer using passed DSN
 func New(connString string) (*DB, error) {
+	return NewContext(context.Background(), connString)
+}
+
+// NewContext creates new connection to Postgres/Pgbouncer using passed DSN, connecting is canceled when context is done.
+func NewContext(ctx context.Context, connString string) (*DB, error) {
 	config, err := pgx.ParseConfig(connString)
 	if err != nil {
 		return nil, err
 	}
 
-	return NewWithConfig(config)
+	return NewWithConfigContext(ctx, config)
 }
 
 // NewWithConfig creates new connection to Postgres/Pgbouncer using passed Config.
 func NewWithConfig(config *pgx.ConnConfig) (*DB, error) {
+	return NewWithConfigContext(context.Background(), config)
+}
+
+// NewWithConfigContext creates new connection to Postgres/Pgbouncer using passed Config, connecting is canceled when
+// context is done.
+func NewWithConfigContext(ctx context.Context, config *pgx.ConnConfig) (*DB, error) {
 	// Enable simple protocol for compatibility with Pgbouncer.
 	config.PreferSimpleProtocol = true
 
@@ -33,7 +45,7 @@ func NewWithConfig(config *pgx.ConnConfig) (*DB, error) {
 		"standard_conforming_strings": "on",
 	}
 
-	conn, err := pgx.ConnectConfig(context.Background(), config)
+	conn, err := pgx.ConnectConfig(ctx, config)
 	if err != nil {
 		return nil, err
 	}
@@ -41,10 +53,32 @@ func NewWithConfig(config *pgx.ConnConfig) (*DB, error) {
 	return &DB{conn: conn}, nil
 }
 
+// IsAuthError returns true if error is caused by failed authentication, e.g. invalid password.
+func IsAuthError(err error) bool {
+	var pgErr interface{ SQLState() string }
+	if !errors.As(err, &pgErr) {
+		return false
+	}
+
+	switch pgErr.SQLState() {
+	case "28P01", "28000": // invalid_password, invalid_authorization_specification
+		return true
+	default:
+		return false
+	}
+}
+
 /* public db methods */
 
 // Query is a wrapper on private query() method.
-func (db *DB) Query(query string) (*model.PGResult, error) { return db.query(query) }
+func (db *DB) Query(query string) (*model.PGResult, error) {
+	return db.query(context.Background(), query)
+}
+
+// QueryContext is a wrapper on private query() method. When context is done, query is canceled on the server side.
+func (db *DB) QueryContext(ctx context.Context, query string) (*model.PGResult, error) {
+	return db.query(ctx, query)
+}
 
 // Close is wrapper on private close() method.
 func (db *DB) Close() { db.close() }
@@ -55,8 +89,8 @@ func (db *DB) Conn() *pgx.Conn { return db.conn }
 /* private db methods */
 
 // Query method executes passed query and wraps result into model.PGResult struct.
-func (db *DB) query(query string) (*model.PGResult, error) {
-	rows, err := db.Conn().Query(context.Background(), query)
+func (db *DB) query(ctx context.Context, query string) (*model.PGResult, error) {
+	rows, err := db.Conn().Query(ctx, query)
 	if err != nil {
 		return nil, err
 	}
@@ -94,6 +128,11 @@ func (db *DB) query(query string) (*model.PGResult, error) {
 
 	rows.Close()
 
+	// Query might be interrupted (e.g. context is done), don't return partial result in this case.
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
 	return &model.PGResult{
 		Nrows:    nrows,
 		Ncols:    ncols,
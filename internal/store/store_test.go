@@ -1,12 +1,15 @@
 package store
 
 import (
+	"context"
 	"database/sql"
+	"fmt"
 	"github.com/jackc/pgproto3/v2"
 	"github.com/jackc/pgx/v4"
 	"github.com/stretchr/testify/assert"
 	"github.com/weaponry/pgscv/internal/model"
 	"testing"
+	"time"
 )
 
 func TestNew(t *testing.T) {
@@ -106,9 +109,51 @@ func TestDB_Query(t *testing.T) {
 	}
 }
 
+func TestDB_QueryContext(t *testing.T) {
+	db := NewTest(t)
+
+	res, err := db.QueryContext(context.Background(), "SELECT 1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res.Nrows)
+
+	// Query should be canceled when context is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err = db.QueryContext(ctx, "SELECT pg_sleep(10)")
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start).Seconds(), float64(5))
+
+	// Cancelled query closes connection, connect again.
+	db, err = NewContext(context.Background(), TestPostgresConnStr)
+	assert.NoError(t, err)
+	db.Close()
+
+	// Connecting should be canceled when context is done.
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	_, err = NewContext(ctx, TestPostgresConnStr)
+	assert.Error(t, err)
+}
+
 func TestDB_Close(t *testing.T) {
 	db := NewTest(t)
 	assert.NotNil(t, db)
 
 	db.Close()
 }
+
+// testSQLStateError imitates errors returned by Postgres.
+type testSQLStateError string
+
+func (e testSQLStateError) Error() string    { return "test error " + string(e) }
+func (e testSQLStateError) SQLState() string { return string(e) }
+
+func TestIsAuthError(t *testing.T) {
+	assert.True(t, IsAuthError(testSQLStateError("28P01")))
+	assert.True(t, IsAuthError(fmt.Errorf("connect failed: %w", testSQLStateError("28000"))))
+	assert.False(t, IsAuthError(testSQLStateError("42501")))
+	assert.False(t, IsAuthError(fmt.Errorf("connection refused")))
+	assert.False(t, IsAuthError(nil))
+}